@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultServer  = "http://localhost:8080"
+	defaultRefresh = 2 * time.Second
+)
+
+// config is read from the config file, then overridden by TODO_SERVER and TODO_TOKEN, then by flags.
+type config struct {
+	Server    string `yaml:"server"`
+	Token     string `yaml:"token"`
+	Workspace string `yaml:"workspace"`
+	// Refresh is how often tui reloads the list, 30s for example
+	Refresh time.Duration `yaml:"refresh"`
+}
+
+// defaultConfigPath is todo/config.yaml in the user config dir, ~/.config on linux.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "todo", "config.yaml")
+}
+
+// loadConfig reads the config file at path, a missing file at the default path is no error.
+func loadConfig(path string, explicit bool) (config, error) {
+	cfg := config{Server: defaultServer, Refresh: defaultRefresh}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && !explicit:
+		case err != nil:
+			return config{}, fmt.Errorf("problem reading config file, %v", err)
+		default:
+			if err := yaml.UnmarshalStrict(b, &cfg); err != nil {
+				return config{}, fmt.Errorf("problem parsing config file %s, %v", path, err)
+			}
+		}
+	}
+
+	if server, ok := os.LookupEnv("TODO_SERVER"); ok {
+		cfg.Server = server
+	}
+	if token, ok := os.LookupEnv("TODO_TOKEN"); ok {
+		cfg.Token = token
+	}
+
+	return cfg, nil
+}
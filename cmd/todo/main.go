@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/client"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/types"
+)
+
+const usage = `usage: todo [flags] <command> [args]
+
+commands:
+  ls                  list todos
+  add <content>       add a todo
+  edit <id> <content> change the content of a todo
+  rm <id>             remove a todo
+  tui                 browse and edit todos full screen
+
+flags go before or right after the command:`
+
+// Exit codes tell scripts why a command failed without parsing its output.
+const (
+	exitOk = iota
+	exitError
+	exitUsage
+	// exitInvalid is a request rejected by the server as invalid, an empty content for instance
+	exitInvalid
+	exitNotFound
+	exitUnauthorized
+	// exitForbidden is a missing role on the list or an exceeded quota
+	exitForbidden
+	exitRateLimited
+	// exitUnavailable is a server which can't be reached or fails with a 5xx
+	exitUnavailable
+)
+
+var usageErr = errors.New("invalid usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("todo", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	configPath := flags.String("config", defaultConfigPath(), "config file with server, token and workspace")
+	server := flags.String("server", "", "url of the todos server, "+defaultServer+" by default")
+	token := flags.String("token", "", "session or personal access token")
+	workspace := flags.String("workspace", "", "workspace slug, the default workspace otherwise")
+	list := flags.Int("list", 0, "id of a list shared with you, your own list otherwise")
+	asJSON := flags.Bool("json", false, "print json instead of a table")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of a request")
+	refresh := flags.Duration("refresh", 0, "how often tui reloads the list, "+defaultRefresh.String()+" by default")
+
+	// flags are parsed again after the command, so both todo --json ls and todo ls --json work
+	if err := flags.Parse(args); err != nil {
+		return usageExit(err)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	command := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return usageExit(err)
+	}
+
+	explicitConfig := false
+	flags.Visit(func(f *flag.Flag) { explicitConfig = explicitConfig || f.Name == "config" })
+
+	cfg, err := loadConfig(*configPath, explicitConfig)
+	if err != nil {
+		fmt.Fprintf(stderr, "todo: %v\n", err)
+		return exitUsage
+	}
+	if *server != "" {
+		cfg.Server = *server
+	}
+	if *token != "" {
+		cfg.Token = *token
+	}
+	if *workspace != "" {
+		cfg.Workspace = *workspace
+	}
+	if *refresh != 0 {
+		cfg.Refresh = *refresh
+	}
+
+	options := []client.Option{
+		client.WithToken(cfg.Token),
+		client.WithWorkspace(cfg.Workspace),
+		client.WithList(*list),
+		client.WithTimeout(*timeout),
+	}
+	c, err := client.New(cfg.Server, options...)
+	if err != nil {
+		fmt.Fprintf(stderr, "todo: %v\n", err)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Refresh <= 0 {
+		fmt.Fprintln(stderr, "todo: refresh has to be positive")
+		return exitUsage
+	}
+
+	out := &output{stdout: stdout, stderr: stderr, json: *asJSON}
+	if command == "tui" && flags.NArg() == 0 {
+		err = runTUI(ctx, c, cfg.Refresh)
+	} else {
+		err = runCommand(ctx, c, out, command, flags.Args())
+	}
+	if errors.Is(err, usageErr) {
+		flags.Usage()
+		return exitUsage
+	}
+	if err != nil {
+		out.printErr(err)
+		return exitCode(err)
+	}
+
+	return exitOk
+}
+
+func runCommand(ctx context.Context, c *client.Client, out *output, command string, args []string) error {
+	switch command {
+	case "ls":
+		if len(args) != 0 {
+			return usageErr
+		}
+		todos, err := c.List(ctx)
+		if err != nil {
+			return err
+		}
+		return out.printTodos(todos)
+	case "add":
+		if len(args) == 0 {
+			return usageErr
+		}
+		content := strings.Join(args, " ")
+		if err := c.Create(ctx, content); err != nil {
+			return err
+		}
+		out.printDone("added %q", content)
+		return nil
+	case "edit":
+		if len(args) < 2 {
+			return usageErr
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return usageErr
+		}
+		if err := c.Update(ctx, id, strings.Join(args[1:], " ")); err != nil {
+			return err
+		}
+		out.printDone("updated %d", id)
+		return nil
+	case "rm":
+		if len(args) != 1 {
+			return usageErr
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return usageErr
+		}
+		if err := c.Delete(ctx, id); err != nil {
+			return err
+		}
+		out.printDone("removed %d", id)
+		return nil
+	}
+
+	return usageErr
+}
+
+func usageExit(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOk
+	}
+
+	return exitUsage
+}
+
+// exitCode maps the errors of the server to exit codes, by error where the status is shared.
+func exitCode(err error) int {
+	var clientErr *client.Error
+	if !errors.As(err, &clientErr) {
+		return exitUnavailable
+	}
+
+	switch {
+	case errors.Is(err, db.UpdatedIdNotExistErr), errors.Is(err, db.DeleteIdNotExistErr), errors.Is(err, db.WorkspaceNotExistErr):
+		return exitNotFound
+	case clientErr.StatusCode == http.StatusUnauthorized:
+		return exitUnauthorized
+	case clientErr.StatusCode == http.StatusForbidden:
+		return exitForbidden
+	case clientErr.StatusCode == http.StatusTooManyRequests:
+		return exitRateLimited
+	case clientErr.StatusCode >= http.StatusInternalServerError:
+		return exitUnavailable
+	case clientErr.StatusCode >= http.StatusBadRequest:
+		return exitInvalid
+	}
+
+	return exitError
+}
+
+type output struct {
+	stdout io.Writer
+	stderr io.Writer
+	json   bool
+}
+
+func (o *output) printTodos(todos types.Todos) error {
+	if o.json {
+		if todos == nil {
+			todos = types.Todos{}
+		}
+		encoder := json.NewEncoder(o.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(todos)
+	}
+
+	w := tabwriter.NewWriter(o.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCONTENT\tCREATED")
+	for _, todo := range todos {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", todo.Id, todo.Content, todo.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// printDone confirms a change in table mode, json mode only relies on the exit code.
+func (o *output) printDone(format string, args ...any) {
+	if !o.json {
+		fmt.Fprintf(o.stdout, format+"\n", args...)
+	}
+}
+
+func (o *output) printErr(err error) {
+	if !o.json {
+		fmt.Fprintf(o.stderr, "todo: %v\n", err)
+		return
+	}
+
+	body := map[string]any{"error": err.Error()}
+	var clientErr *client.Error
+	if errors.As(err, &clientErr) {
+		body = map[string]any{"error": clientErr.Message, "status": clientErr.StatusCode, "requestId": clientErr.RequestId}
+	}
+	json.NewEncoder(o.stderr).Encode(body)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	isolateEnv(t)
+
+	t.Run("commands", func(t *testing.T) {
+		cases := []struct {
+			name        string
+			args        []string
+			wantRequest string
+			wantStdout  string
+		}{
+			{"ls", []string{"ls"}, "GET / ", "ID  CONTENT   CREATED\n1   buy milk  "},
+			{"ls as json", []string{"ls", "--json"}, "GET / ", "[\n  {\n    \"id\": 1,\n    \"content\": \"buy milk\",\n    \"createdAt\": \"2024-01-02T03:04:05Z\"\n  }\n]\n"},
+			{"ls of a shared list", []string{"--list", "2", "ls", "--json"}, "GET /?list=2 ", "[\n  {\n"},
+			{"add", []string{"add", "buy", "eggs"}, `POST / {"content":"buy eggs"}`, "added \"buy eggs\"\n"},
+			{"add as json", []string{"--json", "add", "buy eggs"}, `POST / {"content":"buy eggs"}`, ""},
+			{"edit", []string{"edit", "1", "buy", "bread"}, `PUT /update {"id":1,"content":"buy bread"}`, "updated 1\n"},
+			{"rm", []string{"rm", "1"}, "DELETE /delete/1 ", "removed 1\n"},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				srv := newStubServer(t, http.StatusOK, `[{"id":1,"content":"buy milk","createdAt":"2024-01-02T03:04:05Z"}]`)
+
+				code, stdout, stderr := runTodo(t, append([]string{"--server", srv.URL}, c.args...)...)
+
+				assertEqual(t, code, exitOk)
+				assertEqual(t, stderr, "")
+				assertEqual(t, srv.requests(), []string{c.wantRequest})
+				if !strings.HasPrefix(stdout, c.wantStdout) {
+					t.Errorf("want stdout starting with %q, but got %q", c.wantStdout, stdout)
+				}
+			})
+		}
+	})
+	t.Run("exit codes", func(t *testing.T) {
+		cases := []struct {
+			name       string
+			status     int
+			body       string
+			wantCode   int
+			wantStderr string
+		}{
+			{"missing todo", http.StatusBadRequest, "Deleted todo id is not exist!\nRequest id: abc", exitNotFound, "todo: Deleted todo id is not exist! (request id abc)\n"},
+			{"invalid request", http.StatusBadRequest, "Invalid id!", exitInvalid, "todo: Invalid id!\n"},
+			{"unauthorized", http.StatusUnauthorized, "Unauthorized!", exitUnauthorized, "todo: Unauthorized!\n"},
+			{"forbidden", http.StatusForbidden, "Permission denied!", exitForbidden, "todo: Permission denied!\n"},
+			{"rate limited", http.StatusTooManyRequests, "Too many requests!", exitRateLimited, "todo: Too many requests!\n"},
+			{"server error", http.StatusInternalServerError, "Internal server error!", exitUnavailable, "todo: Internal server error!\n"},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				srv := newStubServer(t, c.status, c.body)
+
+				code, stdout, stderr := runTodo(t, "--server", srv.URL, "rm", "1")
+
+				assertEqual(t, code, c.wantCode)
+				assertEqual(t, stdout, "")
+				assertEqual(t, stderr, c.wantStderr)
+			})
+		}
+	})
+	t.Run("errors as json", func(t *testing.T) {
+		srv := newStubServer(t, http.StatusForbidden, "Permission denied!\nRequest id: abc")
+
+		code, _, stderr := runTodo(t, "--server", srv.URL, "--json", "rm", "1")
+
+		assertEqual(t, code, exitForbidden)
+		assertEqual(t, stderr, `{"error":"Permission denied!","requestId":"abc","status":403}`+"\n")
+	})
+	t.Run("unreachable server", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+
+		code, _, stderr := runTodo(t, "--server", srv.URL, "rm", "1")
+
+		assertEqual(t, code, exitUnavailable)
+		if !strings.Contains(stderr, "connection refused") {
+			t.Errorf("want a connection error, but got %q", stderr)
+		}
+	})
+	t.Run("invalid usage", func(t *testing.T) {
+		cases := []struct {
+			name       string
+			args       []string
+			wantStderr string
+		}{
+			{"no command", nil, "usage: todo"},
+			{"unknown command", []string{"mv", "1"}, "usage: todo"},
+			{"unknown flag", []string{"--verbose", "ls"}, "flag provided but not defined: -verbose"},
+			{"ls with arguments", []string{"ls", "all"}, "usage: todo"},
+			{"add without content", []string{"add"}, "usage: todo"},
+			{"edit without content", []string{"edit", "1"}, "usage: todo"},
+			{"edit of a non numeric id", []string{"edit", "one", "buy milk"}, "usage: todo"},
+			{"rm without id", []string{"rm"}, "usage: todo"},
+			{"rm of several ids", []string{"rm", "1", "2"}, "usage: todo"},
+			{"rm of a non numeric id", []string{"rm", "one"}, "usage: todo"},
+			{"tui with arguments", []string{"tui", "now"}, "usage: todo"},
+			{"invalid server url", []string{"ls", "--server", "localhost"}, `todo: invalid server url "localhost"`},
+			{"non positive refresh", []string{"--refresh", "-1s", "tui"}, "todo: refresh has to be positive"},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				srv := newStubServer(t, http.StatusOK, "[]")
+
+				code, stdout, stderr := runTodo(t, append([]string{"--server", srv.URL}, c.args...)...)
+
+				assertEqual(t, code, exitUsage)
+				assertEqual(t, stdout, "")
+				if !strings.Contains(stderr, c.wantStderr) {
+					t.Errorf("want stderr containing %q, but got %q", c.wantStderr, stderr)
+				}
+				assertEqual(t, len(srv.requests()), 0)
+			})
+		}
+	})
+	t.Run("help", func(t *testing.T) {
+		code, _, stderr := runTodo(t, "--help")
+
+		assertEqual(t, code, exitOk)
+		if !strings.HasPrefix(stderr, usage) {
+			t.Errorf("want the usage, but got %q", stderr)
+		}
+	})
+}
+
+func TestConfig(t *testing.T) {
+	isolateEnv(t)
+
+	t.Run("config file, env and flags", func(t *testing.T) {
+		cases := []struct {
+			name          string
+			env           map[string]string
+			args          []string
+			wantToken     string
+			wantWorkspace string
+		}{
+			{"config file", nil, nil, "file token", "file"},
+			{"env over config file", map[string]string{"TODO_TOKEN": "env token"}, nil, "env token", "file"},
+			{"flags over env", map[string]string{"TODO_TOKEN": "env token"}, []string{"--token", "flag token", "--workspace", "flag"}, "flag token", "flag"},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				srv := newStubServer(t, http.StatusOK, "[]")
+				file := writeConfigFile(t, "server: "+srv.URL+"\ntoken: file token\nworkspace: file\n")
+				for key, value := range c.env {
+					t.Setenv(key, value)
+				}
+
+				code, _, stderr := runTodo(t, append([]string{"--config", file, "ls"}, c.args...)...)
+
+				assertEqual(t, code, exitOk)
+				assertEqual(t, stderr, "")
+				assertEqual(t, srv.authorization, "Bearer "+c.wantToken)
+				assertEqual(t, srv.workspace, c.wantWorkspace)
+			})
+		}
+	})
+	t.Run("server from env", func(t *testing.T) {
+		srv := newStubServer(t, http.StatusOK, "[]")
+		t.Setenv("TODO_SERVER", srv.URL)
+
+		code, _, _ := runTodo(t, "ls")
+
+		assertEqual(t, code, exitOk)
+		assertEqual(t, srv.requests(), []string{"GET / "})
+	})
+	t.Run("missing default config file", func(t *testing.T) {
+		srv := newStubServer(t, http.StatusOK, "[]")
+
+		code, _, stderr := runTodo(t, "--server", srv.URL, "ls")
+
+		assertEqual(t, code, exitOk)
+		assertEqual(t, stderr, "")
+	})
+	t.Run("invalid config", func(t *testing.T) {
+		cases := []struct {
+			name       string
+			content    string
+			wantStderr string
+		}{
+			{"missing file", "", "todo: problem reading config file"},
+			{"unknown setting", "colour: red\n", "todo: problem parsing config file"},
+			{"non positive refresh", "refresh: 0s\n", "todo: refresh has to be positive"},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				file := filepath.Join(t.TempDir(), "missing.yaml")
+				if c.content != "" {
+					file = writeConfigFile(t, c.content)
+				}
+
+				code, _, stderr := runTodo(t, "--config", file, "ls")
+
+				assertEqual(t, code, exitUsage)
+				if !strings.HasPrefix(stderr, c.wantStderr) {
+					t.Errorf("want stderr starting with %q, but got %q", c.wantStderr, stderr)
+				}
+			})
+		}
+	})
+	t.Run("refresh from config file", func(t *testing.T) {
+		cfg, err := loadConfig(writeConfigFile(t, "refresh: 30s\n"), true)
+
+		assertEqual(t, err, nil)
+		assertEqual(t, cfg.Refresh.String(), "30s")
+	})
+}
+
+// stubServer answers every request with the same status and body and records the requests.
+type stubServer struct {
+	*httptest.Server
+	status int
+	body   string
+
+	mu            sync.Mutex
+	received      []string
+	authorization string
+	workspace     string
+}
+
+func newStubServer(t *testing.T, status int, body string) *stubServer {
+	t.Helper()
+
+	srv := &stubServer{status: status, body: body}
+	srv.Server = httptest.NewServer(http.HandlerFunc(srv.serveHTTP))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func (s *stubServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.received = append(s.received, r.Method+" "+r.URL.RequestURI()+" "+strings.TrimSpace(string(body)))
+	s.authorization = r.Header.Get("Authorization")
+	s.workspace = r.Header.Get("X-Workspace")
+	status, responseBody := s.status, s.body
+	s.mu.Unlock()
+
+	if status >= http.StatusBadRequest {
+		http.Error(w, responseBody, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, responseBody)
+}
+
+// respond changes the answer to the requests which follow.
+func (s *stubServer) respond(status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status, s.body = status, body
+}
+
+// requests are the requests received, as method, uri and body.
+func (s *stubServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.received
+}
+
+// isolateEnv hides the config file of the user and the TODO_ environment from the cli.
+func isolateEnv(t *testing.T) {
+	t.Helper()
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, key := range []string{"TODO_SERVER", "TODO_TOKEN"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func runTodo(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+
+	var out, errOut bytes.Buffer
+	code = run(args, &out, &errOut)
+
+	return code, out.String(), errOut.String()
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("problem writing config file, %v", err)
+	}
+
+	return path
+}
+
+func assertEqual[T any](t testing.TB, got, want T) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Want %v (type %T), but got %v (type %T)", want, want, got, got)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/gorgemul/todos/pkg/client"
+	"github.com/gorgemul/todos/types"
+)
+
+const (
+	tuiHelp = "j/k move  a add  e edit  d delete  / filter  r refresh  q quit"
+	// maxRefreshBackoff is how many times the refresh interval doubles while loading fails
+	maxRefreshBackoff = 5
+)
+
+type tuiMode int
+
+const (
+	browsing tuiMode = iota
+	adding
+	editing
+	filtering
+	confirmingDelete
+)
+
+var (
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	dimStyle      = lipgloss.NewStyle().Faint(true)
+	errStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+)
+
+type (
+	todosMsg struct {
+		todos types.Todos
+		err   error
+		// refresh is a load of the refresh loop, which schedules the next one once it is done
+		refresh bool
+	}
+	// changedMsg reports a write, the list is reloaded after every one
+	changedMsg struct {
+		status string
+		err    error
+	}
+	refreshMsg struct{}
+)
+
+// tui is a full screen view of the list, reloading it every refresh interval so changes of
+// other users show up. It only needs a terminal, an ssh session will do.
+type tui struct {
+	ctx     context.Context
+	client  *client.Client
+	refresh time.Duration
+	// failures are the loads which failed in a row, they back the refresh off
+	failures int
+
+	todos   types.Todos
+	visible types.Todos
+	cursor  int
+	mode    tuiMode
+	input   textinput.Model
+	filter  string
+	status  string
+	err     error
+	height  int
+}
+
+func runTUI(ctx context.Context, c *client.Client, refresh time.Duration) error {
+	input := textinput.New()
+	input.CharLimit = 50
+
+	program := tea.NewProgram(
+		&tui{ctx: ctx, client: c, refresh: refresh, input: input},
+		tea.WithAltScreen(),
+		tea.WithContext(ctx),
+	)
+
+	model, err := program.Run()
+	if err != nil {
+		return err
+	}
+
+	// a failing server is reported once the screen is restored
+	if t, ok := model.(*tui); ok && t.todos == nil && t.err != nil {
+		return t.err
+	}
+	return nil
+}
+
+func (t *tui) Init() tea.Cmd {
+	return t.reload
+}
+
+func (t *tui) load() tea.Msg {
+	todos, err := t.client.List(t.ctx)
+	return todosMsg{todos: todos, err: err}
+}
+
+// reload is the load of the refresh loop, only one of them runs at a time.
+func (t *tui) reload() tea.Msg {
+	msg := t.load().(todosMsg)
+	msg.refresh = true
+	return msg
+}
+
+// refreshDelay doubles the interval for every failed load, so a server which is down or
+// throttling isn't asked again every interval.
+func (t *tui) refreshDelay() time.Duration {
+	return t.refresh << min(t.failures, maxRefreshBackoff)
+}
+
+func (t *tui) scheduleRefresh() tea.Cmd {
+	return tea.Tick(t.refreshDelay(), func(time.Time) tea.Msg { return refreshMsg{} })
+}
+
+func (t *tui) change(status string, fn func(ctx context.Context) error) tea.Cmd {
+	return func() tea.Msg {
+		return changedMsg{status: status, err: fn(t.ctx)}
+	}
+}
+
+func (t *tui) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		t.height = msg.Height
+		return t, nil
+	case todosMsg:
+		first := t.todos == nil
+		if msg.err != nil {
+			t.err = msg.err
+			t.failures++
+		} else {
+			t.setTodos(msg.todos)
+			t.failures = 0
+		}
+		if first && t.todos == nil {
+			return t, tea.Quit
+		}
+		if msg.refresh {
+			return t, t.scheduleRefresh()
+		}
+		return t, nil
+	case refreshMsg:
+		return t, t.reload
+	case changedMsg:
+		t.status, t.err = msg.status, msg.err
+		return t, t.load
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return t, tea.Quit
+		}
+		if t.mode == browsing {
+			return t.browse(msg)
+		}
+		return t.edit(msg)
+	}
+
+	return t, nil
+}
+
+func (t *tui) browse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	// keys typed faster than they are read arrive together, "/milk" filters by milk
+	if msg.Type == tea.KeyRunes && len(msg.Runes) > 1 {
+		_, first := t.browse(tea.KeyMsg{Type: tea.KeyRunes, Runes: msg.Runes[:1]})
+		_, rest := t.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: msg.Runes[1:]})
+		return t, tea.Batch(first, rest)
+	}
+
+	switch msg.String() {
+	case "q":
+		return t, tea.Quit
+	case "j", "down":
+		t.cursor = min(t.cursor+1, max(len(t.visible)-1, 0))
+	case "k", "up":
+		t.cursor = max(t.cursor-1, 0)
+	case "g", "home":
+		t.cursor = 0
+	case "G", "end":
+		t.cursor = max(len(t.visible)-1, 0)
+	case "r":
+		return t, t.load
+	case "esc":
+		t.filter = ""
+		t.setTodos(t.todos)
+	case "a":
+		return t, t.prompt(adding, "")
+	case "e", "enter":
+		if todo, ok := t.selected(); ok {
+			return t, t.prompt(editing, todo.Content)
+		}
+	case "/":
+		return t, t.prompt(filtering, t.filter)
+	case "d", "x":
+		if _, ok := t.selected(); ok {
+			t.mode = confirmingDelete
+		}
+	}
+
+	return t, nil
+}
+
+func (t *tui) edit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if t.mode == confirmingDelete {
+		t.mode = browsing
+		todo, ok := t.selected()
+		if msg.String() != "y" || !ok {
+			return t, nil
+		}
+		return t, t.change(fmt.Sprintf("deleted %d", todo.Id), func(ctx context.Context) error {
+			return t.client.Delete(ctx, todo.Id)
+		})
+	}
+
+	switch msg.Type {
+	case tea.KeyEsc:
+		if t.mode == filtering {
+			t.filter = ""
+			t.setTodos(t.todos)
+		}
+		t.mode = browsing
+		t.input.Blur()
+		return t, nil
+	case tea.KeyEnter:
+		return t, t.submit()
+	}
+
+	var cmd tea.Cmd
+	t.input, cmd = t.input.Update(msg)
+	if t.mode == filtering {
+		t.filter = t.input.Value()
+		t.setTodos(t.todos)
+	}
+	return t, cmd
+}
+
+func (t *tui) prompt(mode tuiMode, value string) tea.Cmd {
+	t.mode = mode
+	t.input.SetValue(value)
+	t.input.CursorEnd()
+	return t.input.Focus()
+}
+
+func (t *tui) submit() tea.Cmd {
+	mode, value := t.mode, strings.TrimSpace(t.input.Value())
+	t.mode = browsing
+	t.input.Blur()
+
+	switch mode {
+	case adding:
+		if value == "" {
+			return nil
+		}
+		return t.change("added", func(ctx context.Context) error {
+			return t.client.Create(ctx, value)
+		})
+	case editing:
+		todo, ok := t.selected()
+		if !ok || value == "" || value == todo.Content {
+			return nil
+		}
+		return t.change(fmt.Sprintf("updated %d", todo.Id), func(ctx context.Context) error {
+			return t.client.Update(ctx, todo.Id, value)
+		})
+	}
+
+	return nil
+}
+
+// setTodos applies the filter and keeps the cursor on the same todo when it is still there.
+func (t *tui) setTodos(todos types.Todos) {
+	selected, hadSelection := t.selected()
+
+	if todos == nil {
+		todos = types.Todos{}
+	}
+	t.todos = todos
+	t.visible = t.visible[:0]
+	for _, todo := range todos {
+		if strings.Contains(strings.ToLower(todo.Content), strings.ToLower(t.filter)) {
+			t.visible = append(t.visible, todo)
+		}
+	}
+
+	if hadSelection {
+		for i, todo := range t.visible {
+			if todo.Id == selected.Id {
+				t.cursor = i
+				return
+			}
+		}
+	}
+	t.cursor = min(t.cursor, max(len(t.visible)-1, 0))
+}
+
+func (t *tui) selected() (types.Todo, bool) {
+	if t.cursor < 0 || t.cursor >= len(t.visible) {
+		return types.Todo{}, false
+	}
+
+	return t.visible[t.cursor], true
+}
+
+func (t *tui) View() string {
+	if t.todos == nil {
+		return "loading...\n"
+	}
+
+	var b strings.Builder
+
+	// header, prompt and footer take 4 lines, the rest scrolls with the cursor
+	rows := len(t.visible)
+	if t.height > 4 {
+		rows = min(rows, t.height-4)
+	}
+	start := max(0, t.cursor-rows+1)
+
+	fmt.Fprintf(&b, "%s\n", dimStyle.Render(fmt.Sprintf("%d todos, %d shown", len(t.todos), len(t.visible))))
+	for i := start; i < start+rows; i++ {
+		todo := t.visible[i]
+		line := fmt.Sprintf("%4d  %s", todo.Id, todo.Content)
+		if i == t.cursor {
+			line = selectedStyle.Render(line)
+		}
+		fmt.Fprintln(&b, line)
+	}
+
+	switch t.mode {
+	case adding:
+		fmt.Fprintf(&b, "add: %s\n", t.input.View())
+	case editing:
+		fmt.Fprintf(&b, "edit: %s\n", t.input.View())
+	case filtering:
+		fmt.Fprintf(&b, "/%s\n", t.input.View())
+	case confirmingDelete:
+		todo, _ := t.selected()
+		fmt.Fprintf(&b, "delete %q? y/n\n", todo.Content)
+	default:
+		if t.filter != "" {
+			fmt.Fprintf(&b, "filter: %s (esc clears)\n", t.filter)
+		} else {
+			fmt.Fprintln(&b)
+		}
+	}
+
+	switch {
+	case t.err != nil:
+		fmt.Fprintln(&b, errStyle.Render(t.err.Error()))
+	case t.status != "":
+		fmt.Fprintln(&b, dimStyle.Render(t.status))
+	default:
+		fmt.Fprintln(&b)
+	}
+	fmt.Fprint(&b, dimStyle.Render(tuiHelp))
+
+	return b.String()
+}
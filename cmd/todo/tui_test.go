@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/gorgemul/todos/pkg/client"
+)
+
+func TestTUI(t *testing.T) {
+	t.Run("refresh backs off while loading fails", func(t *testing.T) {
+		srv := newStubServer(t, http.StatusOK, `[{"id":1,"content":"buy milk","createdAt":"2024-01-02T03:04:05Z"}]`)
+		c, err := client.New(srv.URL)
+		assertEqual(t, err, nil)
+		view := &tui{ctx: context.Background(), client: c, refresh: time.Second}
+
+		assertScheduled(t, view, view.Init())
+		assertEqual(t, view.refreshDelay(), time.Second)
+
+		srv.respond(http.StatusInternalServerError, "Internal server error!")
+		for _, want := range []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, 32 * time.Second} {
+			_, cmd := view.Update(refreshMsg{})
+			assertScheduled(t, view, cmd)
+			assertEqual(t, view.refreshDelay(), want)
+		}
+
+		srv.respond(http.StatusOK, "[]")
+		_, cmd := view.Update(refreshMsg{})
+		assertScheduled(t, view, cmd)
+		assertEqual(t, view.refreshDelay(), time.Second)
+	})
+	t.Run("manual reloads don't schedule refreshes", func(t *testing.T) {
+		srv := newStubServer(t, http.StatusOK, "[]")
+		c, err := client.New(srv.URL)
+		assertEqual(t, err, nil)
+		view := &tui{ctx: context.Background(), client: c, refresh: time.Second}
+		assertScheduled(t, view, view.Init())
+
+		_, cmd := view.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+		msg, ok := cmd().(todosMsg)
+		assertEqual(t, ok, true)
+		assertEqual(t, msg.refresh, false)
+
+		_, cmd = view.Update(msg)
+		if cmd != nil {
+			t.Errorf("want no refresh scheduled by a manual reload, but got %T", cmd())
+		}
+	})
+}
+
+// assertScheduled runs the load of cmd and checks the next refresh is scheduled only once it is done.
+func assertScheduled(t *testing.T, view *tui, cmd tea.Cmd) {
+	t.Helper()
+
+	msg, ok := cmd().(todosMsg)
+	if !ok || !msg.refresh {
+		t.Fatalf("want a load of the refresh loop, but got %#v", msg)
+	}
+
+	_, next := view.Update(msg)
+	if next == nil {
+		t.Fatalf("want the next refresh scheduled")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+const (
+	exportUsage = "usage: todos export [flags] [workspace] > todos.json"
+	importUsage = "usage: todos import [flags] [workspace] < todos.json"
+)
+
+// exportCommand writes the todos of a workspace, the default one unless given, as json to stdout.
+func exportCommand(args []string) error {
+	cfg, err := loadConfig(args, exportUsage)
+	if err != nil {
+		return err
+	}
+
+	slug, err := workspaceArg(cfg.Args(), exportUsage)
+	if err != nil {
+		return err
+	}
+
+	store, err := db.New(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	workspace, err := store.GetWorkspaceBySlug(ctx, slug)
+	if err != nil {
+		return err
+	}
+
+	todos, err := store.ExportTodos(db.WithWorkspace(ctx, workspace.Id))
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(todos)
+}
+
+// importCommand adds the todos written by export to a workspace, all of them or none. Owners are
+// matched by username and have to exist already.
+func importCommand(args []string) error {
+	cfg, err := loadConfig(args, importUsage)
+	if err != nil {
+		return err
+	}
+
+	slug, err := workspaceArg(cfg.Args(), importUsage)
+	if err != nil {
+		return err
+	}
+
+	var todos types.ExportedTodos
+	if err := json.NewDecoder(os.Stdin).Decode(&todos); err != nil {
+		return fmt.Errorf("problem decoding todos from stdin, %v", err)
+	}
+	for i, todo := range todos {
+		if err := server.ValidateContent(todo.Content); err != nil {
+			return fmt.Errorf("todo %d: %v", i, err)
+		}
+	}
+
+	store, err := db.New(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	workspace, err := store.GetWorkspaceBySlug(ctx, slug)
+	if err != nil {
+		return err
+	}
+
+	checked := make(map[string]bool)
+	for _, todo := range todos {
+		if checked[todo.Owner] {
+			continue
+		}
+		if _, err := store.GetUserByUsername(ctx, todo.Owner); err != nil {
+			return fmt.Errorf("owner %s: %v", todo.Owner, err)
+		}
+		checked[todo.Owner] = true
+	}
+
+	if err := store.ImportTodos(db.WithWorkspace(ctx, workspace.Id), todos); err != nil {
+		return err
+	}
+
+	fmt.Printf("imported %d todos into %s\n", len(todos), workspace.Slug)
+	return nil
+}
+
+func workspaceArg(args []string, usage string) (string, error) {
+	switch len(args) {
+	case 0:
+		return db.DefaultWorkspace, nil
+	case 1:
+		return args[0], nil
+	default:
+		return "", errors.New(usage)
+	}
+}
@@ -1,22 +1,266 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/config"
 	"github.com/gorgemul/todos/pkg/db"
 	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/pkg/tracing"
+	"github.com/gorgemul/todos/pkg/webhook"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
+// logLevel is shared by every logger, so a reload can change it on the fly.
+var logLevel = new(slog.LevelVar)
+
 func main() {
-	db, err := db.New()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+
+	command, args := serve, os.Args[1:]
+	if len(args) > 0 {
+		if named, ok := lookupCommand(args[0]); ok {
+			command, args = named, args[1:]
+		}
+	}
+
+	if err := command(args); err != nil && !errors.Is(err, flag.ErrHelp) {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+const usage = `usage: todos [command] [flags] [args]
+
+commands:
+  serve        serve the api, the default
+  migrate      apply or roll back migrations
+  user         add users
+  token        create personal access tokens
+  workspace    add or remove the members of a workspace
+  export       write the todos of a workspace as json
+  import       read todos written by export into a workspace
+  purge-trash  delete expired and revoked sessions and tokens
+  stats        count users, sessions, tokens and todos
+
+every command takes the settings listed by todos <command> --help`
+
+func lookupCommand(name string) (func(args []string) error, bool) {
+	switch name {
+	case "serve":
+		return serve, true
+	case "migrate":
+		return migrateCommand, true
+	case "user":
+		return userCommand, true
+	case "token":
+		return tokenCommand, true
+	case "workspace":
+		return workspaceCommand, true
+	case "export":
+		return exportCommand, true
+	case "import":
+		return importCommand, true
+	case "purge-trash":
+		return purgeTrashCommand, true
+	case "stats":
+		return statsCommand, true
+	case "help":
+		return func([]string) error {
+			fmt.Println(usage)
+			return nil
+		}, true
+	}
+
+	return nil, false
+}
+
+// loadConfig loads the settings of a command, --help prints its usage after the settings.
+func loadConfig(args []string, usage string) (*config.Config, error) {
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Println(usage)
+	}
+
+	return cfg, err
+}
+
+// interruptible is canceled by SIGINT or SIGTERM, so one-off commands stop cleanly too.
+func interruptible() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// serve serves until SIGINT or SIGTERM, then drains in-flight requests for at most the shutdown
+// timeout. SIGHUP reloads the config, settings which can't change at runtime are kept until restart.
+func serve(args []string) error {
+	cfg, err := loadConfig(args, usage)
+	if err != nil {
+		return err
+	}
+
+	if cfg.PrintConfig {
+		return cfg.Print(os.Stdout)
+	}
+	if len(cfg.Args()) > 0 {
+		return fmt.Errorf("unknown command %s, see todos help", cfg.Args()[0])
+	}
+
+	logLevel.Set(cfg.LogLevel)
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	defer db.Close()
+	// deferred first so spans of the shutdown itself are flushed too
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Error(fmt.Sprintf("problem flushing traces, %v", err))
+		}
+	}()
+
+	if cfg.DB.AutoMigrate {
+		if err := db.Migrate(ctx, cfg.DB.URL, func(m *migrate.Migrate) error { return m.Up() }); err != nil {
+			return fmt.Errorf("problem migrating on startup, %v", err)
+		}
+		slog.Info("db migrated")
+	}
 
-	srv := server.New(db)
-	log.Println("listening port 8080")
-	log.Fatal(http.ListenAndServe(":8080", srv))
+	store, err := db.New(cfg.DB)
+	if err != nil {
+		return err
+	}
+
+	defer store.Close()
+
+	keys, err := auth.NewKeySet()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := keys.RotateEvery(ctx, auth.KeyRotation); !errors.Is(err, context.Canceled) {
+			slog.Error(fmt.Sprintf("signing key rotation stopped, %v", err))
+		}
+	}()
+
+	// every server dispatches, deliveries are claimed so each is sent by one of them
+	go func() {
+		if err := webhook.NewDispatcher(store, slog.Default(), webhook.WithAllowedNetworks(cfg.Webhooks.AllowedNetworks...)).Run(ctx, webhook.PollInterval); !errors.Is(err, context.Canceled) {
+			slog.Error(fmt.Sprintf("webhook dispatcher stopped, %v", err))
+		}
+	}()
+
+	srv := server.New(store,
+		server.WithKeySet(keys),
+		server.WithSettings(settingsFrom(cfg)),
+		server.WithReadinessCheck("key-rotation", func(ctx context.Context) error {
+			if rotatedAt := keys.RotatedAt(); time.Since(rotatedAt) > auth.KeyRotation+time.Minute {
+				return fmt.Errorf("signing key is not rotated since %s", rotatedAt.Format(time.RFC3339))
+			}
+			return nil
+		}),
+	)
+
+	// gRPC clients share the port over HTTP/2 without TLS
+	http2Server := &http2.Server{IdleTimeout: cfg.HTTP.IdleTimeout}
+	httpServer := &http.Server{
+		Handler:           h2c.NewHandler(srv, http2Server),
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+	// streams only end with their client otherwise, Shutdown would wait them out
+	httpServer.RegisterOnShutdown(srv.Shutdown)
+	// lets Shutdown tell HTTP/2 connections to go away too
+	if err := http2.ConfigureServer(httpServer, http2Server); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(listener)
+	}()
+	slog.Info("listening", "addr", listener.Addr().String())
+
+	for {
+		select {
+		case err := <-serveErr:
+			return err
+		case <-hangup:
+			cfg = reload(cfg, args, srv)
+		case <-ctx.Done():
+			stop()
+			slog.Info("shutting down, waiting for in-flight requests", "timeout", cfg.ShutdownTimeout.String())
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+
+			if err := httpServer.Shutdown(shutdownCtx); err != nil {
+				return err
+			}
+			return nil
+		}
+	}
+}
+
+// reload applies the reloaded config to the running server and returns the config in effect.
+func reload(cfg *config.Config, args []string, srv *server.Server) *config.Config {
+	next, err := config.Load(args)
+	if err != nil {
+		slog.Error(fmt.Sprintf("keeping the current config, problem reloading: %v", err))
+		return cfg
+	}
+
+	if changed := cfg.NeedsRestart(next); len(changed) > 0 {
+		slog.Warn("keeping the current config, settings changed which need a restart", "settings", changed)
+		return cfg
+	}
+
+	logLevel.Set(next.LogLevel)
+	srv.Reload(settingsFrom(next))
+	slog.Info("config reloaded")
+
+	return next
+}
+
+// settingsFrom picks the settings of cfg a running server can reload.
+func settingsFrom(cfg *config.Config) server.Settings {
+	return server.Settings{
+		BaseDomain:     cfg.BaseDomain,
+		MaxBodyBytes:   cfg.HTTP.MaxBodyBytes,
+		RateLimit:      cfg.RateLimit.Enabled,
+		RateLimitRate:  cfg.RateLimit.Rate,
+		RateLimitBurst: cfg.RateLimit.Burst,
+		TrustProxy:     cfg.TrustProxy,
+	}
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/gorgemul/todos/pkg/db"
+)
+
+const migrateUsage = "usage: todos migrate [flags] up | down | status | goto <version>"
+
+// migrateCommand applies the migrations embedded in the binary, down only rolls back one migration
+// so a typo can't drop the whole schema.
+func migrateCommand(args []string) error {
+	cfg, err := loadConfig(args, migrateUsage)
+	if err != nil {
+		return err
+	}
+
+	command := cfg.Args()
+	if len(command) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	var apply func(m *migrate.Migrate) error
+	switch {
+	case command[0] == "up" && len(command) == 1:
+		apply = func(m *migrate.Migrate) error { return m.Up() }
+	case command[0] == "down" && len(command) == 1:
+		apply = func(m *migrate.Migrate) error { return m.Steps(-1) }
+	case command[0] == "goto" && len(command) == 2:
+		version, err := strconv.ParseUint(command[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %s", command[1])
+		}
+		apply = func(m *migrate.Migrate) error { return m.Migrate(uint(version)) }
+	case command[0] == "status" && len(command) == 1:
+		apply = func(m *migrate.Migrate) error { return nil }
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	return db.Migrate(ctx, cfg.DB.URL, func(m *migrate.Migrate) error {
+		if err := apply(m); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+
+		status, err := db.GetMigrationStatus(m)
+		if err != nil {
+			return err
+		}
+
+		printMigrationStatus(status)
+		if command[0] != "status" {
+			slog.Info("db migrated", "version", status.Version)
+		}
+		return nil
+	})
+}
+
+func printMigrationStatus(status db.MigrationStatus) {
+	state := "clean"
+	if status.Dirty {
+		state = "dirty, fix the schema by hand and goto the last clean version"
+	}
+
+	fmt.Fprintf(os.Stdout, "version: %d (%s)\nlatest: %d\npending: %v\n", status.Version, state, status.Latest, status.Pending)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/db"
+)
+
+const (
+	purgeTrashUsage = "usage: todos purge-trash [flags] [older-than]"
+
+	// defaultTrashRetention keeps revoked tokens listed for a while, so users can see what was revoked
+	defaultTrashRetention = 30 * 24 * time.Hour
+)
+
+// purgeTrashCommand deletes the sessions and tokens which expired or were revoked longer than
+// older-than ago, they pile up since nothing else deletes them. Deleted todos are gone already.
+func purgeTrashCommand(args []string) error {
+	cfg, err := loadConfig(args, purgeTrashUsage)
+	if err != nil {
+		return err
+	}
+
+	retention := defaultTrashRetention
+	switch command := cfg.Args(); len(command) {
+	case 0:
+	case 1:
+		if retention, err = time.ParseDuration(command[0]); err != nil || retention < 0 {
+			return fmt.Errorf("invalid duration %s", command[0])
+		}
+	default:
+		return errors.New(purgeTrashUsage)
+	}
+
+	store, err := db.New(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	purged, err := store.PurgeTrash(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("sessions: %d\ntokens: %d\nrefresh tokens: %d\n", purged.Sessions, purged.Tokens, purged.RefreshTokens)
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/gorgemul/todos/pkg/db"
+)
+
+const statsUsage = "usage: todos stats [flags]"
+
+func statsCommand(args []string) error {
+	cfg, err := loadConfig(args, statsUsage)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Args()) > 0 {
+		return errors.New(statsUsage)
+	}
+
+	store, err := db.New(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	stats, err := store.GetStats(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("users: %d\nsessions: %d\ntokens: %d\ntodos:\n", stats.Users, stats.Sessions, stats.Tokens)
+
+	workspaces := make([]string, 0, len(stats.Todos))
+	for slug := range stats.Todos {
+		workspaces = append(workspaces, slug)
+	}
+	slices.Sort(workspaces)
+
+	for _, slug := range workspaces {
+		fmt.Printf("  %s: %d\n", slug, stats.Todos[slug])
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+const tokenUsage = "usage: todos token [flags] create [--scopes todos:read,todos:write] [--workspace slug] [--expires-in duration] <username> <name>"
+
+// tokenCommand creates a personal access token on behalf of a user, for instance to hand one to a
+// service account which can't log in. The token is printed once, only its hash is stored.
+func tokenCommand(args []string) error {
+	cfg, err := loadConfig(args, tokenUsage)
+	if err != nil {
+		return err
+	}
+
+	command := cfg.Args()
+	if len(command) == 0 || command[0] != "create" {
+		return errors.New(tokenUsage)
+	}
+
+	flags := flag.NewFlagSet("token create", flag.ContinueOnError)
+	scopes := flags.String("scopes", strings.Join(auth.Scopes, ","), "comma separated scopes of the token")
+	workspace := flags.String("workspace", "", "only workspace the token works in, any workspace when empty")
+	expiresIn := flags.Duration("expires-in", 0, "lifetime of the token, no expiry when 0")
+	if err := flags.Parse(command[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errors.New(tokenUsage)
+	}
+
+	username := flags.Arg(0)
+	newToken := types.NewToken{Name: flags.Arg(1), Scopes: strings.Split(*scopes, ",")}
+	if *workspace != "" {
+		newToken.Workspace = workspace
+	}
+	if *expiresIn != 0 {
+		expiresAt := time.Now().Add(*expiresIn)
+		newToken.ExpiresAt = &expiresAt
+	}
+
+	if err := server.ValidateNewToken(newToken); err != nil {
+		return err
+	}
+
+	store, err := db.New(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	user, err := store.GetUserByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+	if newToken.Workspace != nil {
+		if _, err := store.GetMemberWorkspace(ctx, user.Id, *newToken.Workspace); err != nil {
+			return err
+		}
+	}
+
+	secret, err := auth.NewAccessToken()
+	if err != nil {
+		return err
+	}
+
+	token, err := store.CreateToken(ctx, user.Id, auth.HashToken(secret), newToken)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "created token %s with id %d for %s, it isn't shown again\n", token.Name, token.Id, user.Username)
+	fmt.Println(secret)
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+const userUsage = "usage: todos user [flags] add <username> < password"
+
+// userCommand adds a user the way registering does, the password is the first line of stdin so
+// it stays out of the shell history.
+func userCommand(args []string) error {
+	cfg, err := loadConfig(args, userUsage)
+	if err != nil {
+		return err
+	}
+
+	command := cfg.Args()
+	if len(command) != 2 || command[0] != "add" {
+		return errors.New(userUsage)
+	}
+
+	password, err := readLine(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("problem reading password from stdin, %v", err)
+	}
+
+	credentials := types.Credentials{Username: command[1], Password: password}
+	if err := server.ValidateCredentials(credentials); err != nil {
+		return err
+	}
+
+	passwordHash, err := auth.HashPassword(credentials.Password)
+	if err != nil {
+		return err
+	}
+
+	store, err := db.New(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	user, err := store.CreateUser(ctx, credentials.Username, passwordHash)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created user %s with id %d\n", user.Username, user.Id)
+	return nil
+}
+
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gorgemul/todos/pkg/db"
+)
+
+const workspaceUsage = "usage: todos workspace [flags] add-member|remove-member <workspace> <username>"
+
+// workspaceCommand lets users into a workspace besides the default one, which every user is a
+// member of, or stops them from acting in it.
+func workspaceCommand(args []string) error {
+	cfg, err := loadConfig(args, workspaceUsage)
+	if err != nil {
+		return err
+	}
+
+	command := cfg.Args()
+	if len(command) != 3 {
+		return errors.New(workspaceUsage)
+	}
+
+	store, err := db.New(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	slug, username := command[1], command[2]
+
+	switch command[0] {
+	case "add-member":
+		if err := store.AddWorkspaceMember(ctx, slug, username); err != nil {
+			return err
+		}
+		fmt.Printf("added %s to workspace %s\n", username, slug)
+	case "remove-member":
+		if err := store.RemoveWorkspaceMember(ctx, slug, username); err != nil {
+			return err
+		}
+		fmt.Printf("removed %s from workspace %s\n", username, slug)
+	default:
+		return errors.New(workspaceUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS todozz_owner_id_idx;
+ALTER TABLE todozz DROP COLUMN IF EXISTS owner_id;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
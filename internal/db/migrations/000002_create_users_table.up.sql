@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS users(
+	id serial PRIMARY KEY,
+	username VARCHAR(50) NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS sessions(
+	id serial PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- todos created before accounts existed have no owner and are hidden from every user
+ALTER TABLE todozz ADD COLUMN owner_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS todozz_owner_id_idx ON todozz(owner_id);
@@ -0,0 +1,11 @@
+-- a list is every todo of its owner, sharing it grants another user a role on all of them
+CREATE TABLE IF NOT EXISTS list_shares(
+	owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role VARCHAR(10) NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+	created_at TIMESTAMP DEFAULT NOW(),
+	PRIMARY KEY (owner_id, user_id),
+	CHECK (owner_id <> user_id)
+);
+
+CREATE INDEX IF NOT EXISTS list_shares_user_id_idx ON list_shares(user_id);
@@ -0,0 +1,10 @@
+ALTER TABLE tokens DROP COLUMN IF EXISTS workspace_id;
+
+DROP POLICY IF EXISTS todozz_workspace_isolation ON todozz;
+ALTER TABLE todozz NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE todozz DISABLE ROW LEVEL SECURITY;
+DROP INDEX IF EXISTS todozz_workspace_id_idx;
+ALTER TABLE todozz DROP COLUMN IF EXISTS workspace_id;
+
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
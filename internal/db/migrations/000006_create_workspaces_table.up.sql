@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS workspaces(
+	id serial PRIMARY KEY,
+	slug VARCHAR(50) NOT NULL UNIQUE,
+	-- NULL means unlimited
+	todo_quota INTEGER CHECK (todo_quota >= 0),
+	created_at TIMESTAMP DEFAULT NOW()
+);
+
+INSERT INTO workspaces (slug) VALUES ('default');
+
+-- users only act in the workspaces they are members of, every user is a member of the default
+-- workspace from the start
+CREATE TABLE IF NOT EXISTS workspace_members(
+	workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP DEFAULT NOW(),
+	PRIMARY KEY (workspace_id, user_id)
+);
+
+INSERT INTO workspace_members (workspace_id, user_id) SELECT w.id, u.id FROM workspaces w, users u WHERE w.slug = 'default';
+
+ALTER TABLE todozz ADD COLUMN workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE;
+UPDATE todozz SET workspace_id = (SELECT id FROM workspaces WHERE slug = 'default');
+ALTER TABLE todozz ALTER COLUMN workspace_id SET NOT NULL;
+ALTER TABLE todozz ALTER COLUMN workspace_id SET DEFAULT NULLIF(current_setting('app.workspace_id', true), '')::INTEGER;
+CREATE INDEX IF NOT EXISTS todozz_workspace_id_idx ON todozz(workspace_id);
+
+-- the server sets app.workspace_id with SET LOCAL in every transaction touching todozz,
+-- rows of other workspaces are invisible. Superusers and BYPASSRLS roles skip policies,
+-- the server has to connect with a regular role for the isolation to hold.
+ALTER TABLE todozz ENABLE ROW LEVEL SECURITY;
+ALTER TABLE todozz FORCE ROW LEVEL SECURITY;
+CREATE POLICY todozz_workspace_isolation ON todozz
+	USING (workspace_id = NULLIF(current_setting('app.workspace_id', true), '')::INTEGER)
+	WITH CHECK (workspace_id = NULLIF(current_setting('app.workspace_id', true), '')::INTEGER);
+
+ALTER TABLE tokens ADD COLUMN workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE;
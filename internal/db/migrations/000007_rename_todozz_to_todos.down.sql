@@ -0,0 +1,8 @@
+DROP VIEW IF EXISTS todozz;
+
+ALTER POLICY todos_workspace_isolation ON todos RENAME TO todozz_workspace_isolation;
+ALTER INDEX todos_workspace_id_idx RENAME TO todozz_workspace_id_idx;
+ALTER INDEX todos_owner_id_idx RENAME TO todozz_owner_id_idx;
+ALTER INDEX todos_pkey RENAME TO todozz_pkey;
+ALTER SEQUENCE todos_id_seq RENAME TO todozz_id_seq;
+ALTER TABLE todos RENAME TO todozz;
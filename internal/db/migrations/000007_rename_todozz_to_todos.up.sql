@@ -0,0 +1,15 @@
+ALTER TABLE todozz RENAME TO todos;
+ALTER SEQUENCE todozz_id_seq RENAME TO todos_id_seq;
+ALTER INDEX todozz_pkey RENAME TO todos_pkey;
+ALTER INDEX todozz_owner_id_idx RENAME TO todos_owner_id_idx;
+ALTER INDEX todozz_workspace_id_idx RENAME TO todos_workspace_id_idx;
+ALTER POLICY todozz_workspace_isolation ON todos RENAME TO todos_workspace_isolation;
+
+-- servers of the previous release keep querying todozz while they are replaced, the view is
+-- dropped once none of them runs anymore. A view reads its table as the owner of the view,
+-- which skips row level security when migrations run as a superuser, so the view filters by
+-- workspace itself.
+CREATE VIEW todozz AS
+	SELECT * FROM todos
+	WHERE workspace_id = NULLIF(current_setting('app.workspace_id', true), '')::INTEGER
+	WITH CHECK OPTION;
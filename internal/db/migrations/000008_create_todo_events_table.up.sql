@@ -0,0 +1,27 @@
+-- every change to a todo, in order, so clients of /events resume where they left off. Deleted
+-- todos keep their events, todo_id doesn't reference todos. Events are inserted by the
+-- transaction of the change, ids are handed out before commit so they may commit out of order:
+-- readers go by tx_id, the transaction which inserted them, and only read the events of
+-- transactions older than every transaction still running.
+CREATE TABLE IF NOT EXISTS todo_events(
+	id BIGSERIAL PRIMARY KEY,
+	workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE
+		DEFAULT NULLIF(current_setting('app.workspace_id', true), '')::INTEGER,
+	-- the list is identified by the id of its owner
+	list_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	type VARCHAR(20) NOT NULL CHECK (type IN ('todo.created', 'todo.updated', 'todo.deleted')),
+	todo_id INTEGER NOT NULL,
+	-- NULL for deleted todos
+	content VARCHAR(50),
+	tx_id BIGINT NOT NULL DEFAULT txid_current(),
+	created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS todo_events_workspace_id_idx ON todo_events(workspace_id, tx_id, id);
+
+ALTER TABLE todo_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE todo_events FORCE ROW LEVEL SECURITY;
+CREATE POLICY todo_events_workspace_isolation ON todo_events
+	USING (workspace_id = NULLIF(current_setting('app.workspace_id', true), '')::INTEGER)
+	WITH CHECK (workspace_id = NULLIF(current_setting('app.workspace_id', true), '')::INTEGER);
@@ -0,0 +1,49 @@
+-- webhooks of users, secret signs the payloads so it is kept as is, not hashed
+CREATE TABLE IF NOT EXISTS webhooks(
+	id SERIAL PRIMARY KEY,
+	workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE
+		DEFAULT NULLIF(current_setting('app.workspace_id', true), '')::INTEGER,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	events TEXT[] NOT NULL,
+	created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhooks_workspace_id_idx ON webhooks(workspace_id, user_id);
+
+-- the outbox of the webhooks, todo mutations queue a delivery in their own transaction and the
+-- dispatcher sends it. Rows stay once delivered or failed as the delivery log.
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+	id BIGSERIAL PRIMARY KEY,
+	workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE
+		DEFAULT NULLIF(current_setting('app.workspace_id', true), '')::INTEGER,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_type VARCHAR(20) NOT NULL,
+	payload JSONB NOT NULL,
+	status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	-- claimed deliveries are pushed back by a lease, a dispatcher dying mid delivery doesn't lose them
+	next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	-- NULL until a receiver answered
+	response_status INTEGER,
+	error TEXT,
+	last_attempt_at TIMESTAMP,
+	delivered_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries(workspace_id, next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries(webhook_id, id);
+
+ALTER TABLE webhooks ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhooks FORCE ROW LEVEL SECURITY;
+CREATE POLICY webhooks_workspace_isolation ON webhooks
+	USING (workspace_id = NULLIF(current_setting('app.workspace_id', true), '')::INTEGER)
+	WITH CHECK (workspace_id = NULLIF(current_setting('app.workspace_id', true), '')::INTEGER);
+
+ALTER TABLE webhook_deliveries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries FORCE ROW LEVEL SECURITY;
+CREATE POLICY webhook_deliveries_workspace_isolation ON webhook_deliveries
+	USING (workspace_id = NULLIF(current_setting('app.workspace_id', true), '')::INTEGER)
+	WITH CHECK (workspace_id = NULLIF(current_setting('app.workspace_id', true), '')::INTEGER);
@@ -0,0 +1,8 @@
+// Package migrations embeds the golang-migrate migrations of the schema, so the binary can
+// migrate the db it serves without a checkout of the repo.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	SessionTTL = 7 * 24 * time.Hour
+
+	// TokenPrefix marks personal access tokens so they can be told apart from session tokens.
+	TokenPrefix = "todos_pat_"
+
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+
+	tokenBytes = 32
+)
+
+var Scopes = []string{ScopeTodosRead, ScopeTodosWrite}
+
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("problem hashing password, %v", err)
+	}
+
+	return string(hash), nil
+}
+
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NewToken returns a random url safe token, only its HashToken value should be stored.
+func NewToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("problem generating token, %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func NewAccessToken() (string, error) {
+	token, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	return TokenPrefix + token, nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
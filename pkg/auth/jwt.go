@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	KeyRotation     = 24 * time.Hour
+
+	Issuer = "todos"
+
+	jwtAlg       = "ES256"
+	p256ByteSize = 32
+)
+
+var InvalidJWTErr = errors.New("Invalid or expired jwt!")
+
+type Claims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Username  string `json:"username"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	Id        string `json:"jti"`
+}
+
+func (c Claims) UserId() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+type signingKey struct {
+	id        string
+	private   *ecdsa.PrivateKey
+	retiredAt time.Time
+}
+
+// KeySet signs access tokens with its newest key and verifies them with any key
+// which hasn't been retired for longer than AccessTokenTTL.
+type KeySet struct {
+	mu        sync.RWMutex
+	keys      []*signingKey
+	rotatedAt time.Time
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewKeySet() (*KeySet, error) {
+	keys := new(KeySet)
+	if err := keys.Rotate(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func MustNewKeySet() *KeySet {
+	keys, err := NewKeySet()
+	if err != nil {
+		panic(err)
+	}
+
+	return keys
+}
+
+func (ks *KeySet) Rotate() error {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("problem generating signing key, %v", err)
+	}
+
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return fmt.Errorf("problem generating key id, %v", err)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := time.Now()
+	var keys []*signingKey
+	for _, key := range ks.keys {
+		if key.retiredAt.IsZero() {
+			key.retiredAt = now
+		}
+		if now.Sub(key.retiredAt) < AccessTokenTTL {
+			keys = append(keys, key)
+		}
+	}
+	ks.keys = append(keys, &signingKey{id: hex.EncodeToString(kid), private: private})
+	ks.rotatedAt = now
+
+	return nil
+}
+
+// RotatedAt is when the current signing key was generated.
+func (ks *KeySet) RotatedAt() time.Time {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return ks.rotatedAt
+}
+
+func (ks *KeySet) RotateEvery(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := ks.Rotate(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (ks *KeySet) Sign(claims Claims) (string, error) {
+	ks.mu.RLock()
+	key := ks.keys[len(ks.keys)-1]
+	ks.mu.RUnlock()
+
+	header, err := json.Marshal(jwtHeader{Alg: jwtAlg, Typ: "JWT", Kid: key.id})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key.private, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("problem signing jwt, %v", err)
+	}
+
+	signature := make([]byte, 2*p256ByteSize)
+	r.FillBytes(signature[:p256ByteSize])
+	s.FillBytes(signature[p256ByteSize:])
+
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+// Verify checks signature, issuer and expiry. Any failure is reported as InvalidJWTErr.
+func (ks *KeySet) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, InvalidJWTErr
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != jwtAlg {
+		return Claims{}, InvalidJWTErr
+	}
+
+	key := ks.key(header.Kid)
+	if key == nil {
+		return Claims{}, InvalidJWTErr
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 2*p256ByteSize {
+		return Claims{}, InvalidJWTErr
+	}
+
+	r := new(big.Int).SetBytes(signature[:p256ByteSize])
+	s := new(big.Int).SetBytes(signature[p256ByteSize:])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(&key.private.PublicKey, digest[:], r, s) {
+		return Claims{}, InvalidJWTErr
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, InvalidJWTErr
+	}
+
+	if claims.Issuer != Issuer || time.Now().Unix() >= claims.ExpiresAt {
+		return Claims{}, InvalidJWTErr
+	}
+
+	return claims, nil
+}
+
+func (ks *KeySet) JWKS() (JWKS, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		public, err := key.private.PublicKey.ECDH()
+		if err != nil {
+			return JWKS{}, fmt.Errorf("problem encoding public key, %v", err)
+		}
+
+		// uncompressed point: 0x04 || X || Y
+		point := public.Bytes()
+		jwks.Keys = append(jwks.Keys, JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   encodeSegment(point[1 : 1+p256ByteSize]),
+			Y:   encodeSegment(point[1+p256ByteSize:]),
+			Kid: key.id,
+			Use: "sig",
+			Alg: jwtAlg,
+		})
+	}
+
+	return jwks, nil
+}
+
+func (ks *KeySet) key(kid string) *signingKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, key := range ks.keys {
+		if key.id == kid {
+			return key
+		}
+	}
+
+	return nil
+}
+
+// LooksLikeJWT tells compact serialized jwts apart from opaque session and access tokens.
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
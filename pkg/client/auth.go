@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/types"
+)
+
+func (c *Client) Register(ctx context.Context, credentials types.Credentials) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/register", body: credentials}, nil)
+}
+
+// Login returns a session, pass its token to WithToken for a client acting as the user.
+func (c *Client) Login(ctx context.Context, credentials types.Credentials) (types.Session, error) {
+	var session types.Session
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/login", body: credentials}, &session); err != nil {
+		return types.Session{}, err
+	}
+
+	return session, nil
+}
+
+// Logout ends the session the client was created with.
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/logout"}, nil)
+}
+
+// IssueTokenPair trades credentials for a jwt access token and a refresh token.
+func (c *Client) IssueTokenPair(ctx context.Context, credentials types.Credentials) (types.TokenPair, error) {
+	return c.tokenPair(ctx, "/auth/token", credentials)
+}
+
+// Refresh uses up refreshToken for a new pair.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (types.TokenPair, error) {
+	return c.tokenPair(ctx, "/auth/refresh", types.RefreshToken{RefreshToken: refreshToken})
+}
+
+func (c *Client) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/auth/revoke", body: types.RefreshToken{RefreshToken: refreshToken}}, nil)
+}
+
+func (c *Client) JWKS(ctx context.Context) (auth.JWKS, error) {
+	var jwks auth.JWKS
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/.well-known/jwks.json"}, &jwks); err != nil {
+		return auth.JWKS{}, err
+	}
+
+	return jwks, nil
+}
+
+func (c *Client) tokenPair(ctx context.Context, path string, body any) (types.TokenPair, error) {
+	var pair types.TokenPair
+	if err := c.do(ctx, request{method: http.MethodPost, path: path, body: body}, &pair); err != nil {
+		return types.TokenPair{}, err
+	}
+
+	return pair, nil
+}
@@ -0,0 +1,237 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	defaultRetries = 3
+	// backoff doubles from minBackoff up to maxBackoff between retries, unless the server asks
+	// for a longer wait with Retry-After
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 5 * time.Second
+)
+
+// Client calls the api of a todos server on behalf of the owner of its token. Every method
+// takes a context, failed requests come back as *Error which errors.Is matches against the
+// errors of pkg/db, db.UpdatedIdNotExistErr for instance.
+type Client struct {
+	baseURL    *url.URL
+	token      string
+	workspace  string
+	listId     int
+	httpClient *http.Client
+	timeout    time.Duration
+	retries    int
+}
+
+type Option func(*Client)
+
+// WithToken authenticates requests with a session, jwt access or personal access token.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithWorkspace sends requests to the workspace of slug, the default workspace otherwise.
+func WithWorkspace(slug string) Option {
+	return func(c *Client) {
+		c.workspace = slug
+	}
+}
+
+// WithList makes the todo methods act on a list shared by another user, the list of the token
+// owner otherwise.
+func WithList(listId int) Option {
+	return func(c *Client) {
+		c.listId = listId
+	}
+}
+
+// WithHTTPClient sends requests with httpClient, http.DefaultClient otherwise.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout bounds every attempt of a request, 30 seconds by default and no bound with 0.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetries sets how often a request is retried, 3 times by default. Throttled requests are
+// always retried, network errors and gateway failures only for requests which are safe to repeat.
+func WithRetries(retries int) Option {
+	return func(c *Client) {
+		c.retries = retries
+	}
+}
+
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid server url %q", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    parsed,
+		httpClient: http.DefaultClient,
+		timeout:    defaultTimeout,
+		retries:    defaultRetries,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	return c, nil
+}
+
+// request is an api call, query is added to the url and body sent as json.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	// decodeStatus is an error status whose body is decoded like a success, readyz answers 503
+	// with the failed checks
+	decodeStatus int
+}
+
+// do sends req, retrying it when allowed, and decodes the response into v unless v is nil.
+func (c *Client) do(ctx context.Context, req request, v any) error {
+	var body []byte
+	if req.body != nil {
+		b, err := json.Marshal(req.body)
+		if err != nil {
+			return fmt.Errorf("problem encoding request body, %v", err)
+		}
+		body = b
+	}
+
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := c.attempt(ctx, req, body, v)
+		if err == nil || attempt >= c.retries || !retryable(req.method, err) {
+			return err
+		}
+
+		wait := backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends req once, retryAfter is the wait asked for by the server.
+func (c *Client) attempt(ctx context.Context, req request, body []byte, v any) (retryAfter time.Duration, err error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	endpoint := c.baseURL.JoinPath(req.path)
+	if len(req.query) > 0 {
+		endpoint.RawQuery = req.query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, req.method, endpoint.String(), reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		httpRequest.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.workspace != "" {
+		httpRequest.Header.Set("X-Workspace", c.workspace)
+	}
+
+	response, err := c.httpClient.Do(httpRequest)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest && response.StatusCode != req.decodeStatus {
+		seconds, _ := strconv.Atoi(response.Header.Get("Retry-After"))
+		return time.Duration(seconds) * time.Second, responseErr(response)
+	}
+
+	if v == nil {
+		_, err = io.Copy(io.Discard, response.Body)
+		return 0, err
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+		return 0, fmt.Errorf("problem decoding response, %v", err)
+	}
+
+	return 0, nil
+}
+
+// retryable tells whether the server certainly didn't act on a request, or acting twice is
+// harmless. Deleting twice isn't, the second attempt reports the todo as missing.
+func retryable(method string, err error) bool {
+	var clientErr *Error
+	if !errors.As(err, &clientErr) {
+		return idempotent(method) && !errors.Is(err, context.Canceled)
+	}
+
+	switch clientErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent(method)
+	}
+
+	return false
+}
+
+func idempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodPut
+}
+
+// backoff is a random wait up to an exponentially growing bound, so clients throttled together
+// don't retry together.
+func backoff(attempt int) time.Duration {
+	bound := min(minBackoff<<attempt, maxBackoff)
+	return bound/2 + rand.N(bound/2)
+}
+
+func (c *Client) listQuery() url.Values {
+	if c.listId == 0 {
+		return nil
+	}
+
+	return url.Values{"list": {strconv.Itoa(c.listId)}}
+}
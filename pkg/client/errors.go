@@ -0,0 +1,81 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorgemul/todos/types"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	requestIdPrefix    = "Request id: "
+)
+
+// TodoNotExistErr is returned by Get, the server has no endpoint for a single todo to fail with.
+var TodoNotExistErr = errors.New("Todo is not exist!")
+
+// Error is a response of the server which isn't a success.
+type Error struct {
+	StatusCode int
+	// Message is the error message of the server, the detail of problem responses
+	Message   string
+	RequestId string
+}
+
+func (e *Error) Error() string {
+	if e.RequestId == "" {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%s (request id %s)", e.Message, e.RequestId)
+}
+
+// Is matches the error the server responded with, so errors.Is(err, db.DeleteIdNotExistErr)
+// holds for a delete of a missing todo. Problem details continue after the message of the
+// error, "Permission denied! editor access to list 2 is required." is a db.PermissionDeniedErr.
+func (e *Error) Is(target error) bool {
+	if target == nil {
+		return false
+	}
+
+	msg := target.Error()
+	return e.Message == msg || strings.HasPrefix(e.Message, msg+" ")
+}
+
+// responseErr reads either a problem body or the plain text errors of the server, whose first
+// line is the message and the last one the request id.
+func responseErr(response *http.Response) error {
+	clientErr := &Error{StatusCode: response.StatusCode, RequestId: response.Header.Get("X-Request-ID")}
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if mediaType == problemContentType {
+		var problem types.Problem
+		if err := json.NewDecoder(response.Body).Decode(&problem); err == nil {
+			clientErr.Message = problem.Detail
+			return clientErr
+		}
+	}
+
+	scanner := bufio.NewScanner(io.LimitReader(response.Body, 64<<10))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if requestId, ok := strings.CutPrefix(line, requestIdPrefix); ok {
+			clientErr.RequestId = requestId
+		} else if clientErr.Message == "" {
+			clientErr.Message = line
+		}
+	}
+
+	if clientErr.Message == "" {
+		clientErr.Message = http.StatusText(response.StatusCode)
+	}
+
+	return clientErr
+}
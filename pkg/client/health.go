@@ -0,0 +1,19 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorgemul/todos/types"
+)
+
+// Ready returns the readiness checks of the server, a failing check is reported by the status
+// of the health rather than an error.
+func (c *Client) Ready(ctx context.Context) (types.Health, error) {
+	var health types.Health
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/readyz", decodeStatus: http.StatusServiceUnavailable}, &health); err != nil {
+		return types.Health{}, err
+	}
+
+	return health, nil
+}
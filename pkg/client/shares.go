@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gorgemul/todos/types"
+)
+
+// Lists returns the list of the user and the lists shared with them.
+func (c *Client) Lists(ctx context.Context) (types.Lists, error) {
+	var lists types.Lists
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/lists"}, &lists); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+func (c *Client) Shares(ctx context.Context, listId int) (types.Shares, error) {
+	var shares types.Shares
+	if err := c.do(ctx, request{method: http.MethodGet, path: fmt.Sprintf("/lists/%d/shares", listId)}, &shares); err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+// PutShare shares the list with a user, or changes their role when it already is.
+func (c *Client) PutShare(ctx context.Context, listId int, newShare types.NewShare) (types.Share, error) {
+	var share types.Share
+	if err := c.do(ctx, request{method: http.MethodPut, path: fmt.Sprintf("/lists/%d/shares", listId), body: newShare}, &share); err != nil {
+		return types.Share{}, err
+	}
+
+	return share, nil
+}
+
+func (c *Client) DeleteShare(ctx context.Context, listId, userId int) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: fmt.Sprintf("/lists/%d/shares/%d", listId, userId)}, nil)
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gorgemul/todos/types"
+)
+
+func (c *Client) List(ctx context.Context) (types.Todos, error) {
+	var todos types.Todos
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/", query: c.listQuery()}, &todos); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// Get finds a todo in the list, TodoNotExistErr when it isn't there.
+func (c *Client) Get(ctx context.Context, id int) (types.Todo, error) {
+	todos, err := c.List(ctx)
+	if err != nil {
+		return types.Todo{}, err
+	}
+
+	for _, todo := range todos {
+		if todo.Id == id {
+			return todo, nil
+		}
+	}
+
+	return types.Todo{}, TodoNotExistErr
+}
+
+func (c *Client) Create(ctx context.Context, content string) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/", query: c.listQuery(), body: types.NewTodo{Content: content}}, nil)
+}
+
+func (c *Client) Update(ctx context.Context, id int, content string) error {
+	return c.do(ctx, request{method: http.MethodPut, path: "/update", query: c.listQuery(), body: types.UpdateTodo{Id: id, Content: content}}, nil)
+}
+
+func (c *Client) Delete(ctx context.Context, id int) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: fmt.Sprintf("/delete/%d", id), query: c.listQuery()}, nil)
+}
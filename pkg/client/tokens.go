@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gorgemul/todos/types"
+)
+
+// CreateToken mints a personal access token, only a login session may.
+func (c *Client) CreateToken(ctx context.Context, newToken types.NewToken) (types.CreatedToken, error) {
+	var token types.CreatedToken
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/tokens", body: newToken}, &token); err != nil {
+		return types.CreatedToken{}, err
+	}
+
+	return token, nil
+}
+
+func (c *Client) Tokens(ctx context.Context) (types.Tokens, error) {
+	var tokens types.Tokens
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/tokens"}, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (c *Client) RevokeToken(ctx context.Context, id int) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: fmt.Sprintf("/tokens/%d", id)}, nil)
+}
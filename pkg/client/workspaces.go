@@ -0,0 +1,18 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorgemul/todos/types"
+)
+
+// Workspace returns the workspace of the client along with how many todos it holds.
+func (c *Client) Workspace(ctx context.Context) (types.Workspace, error) {
+	var workspace types.Workspace
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/workspace"}, &workspace); err != nil {
+		return types.Workspace{}, err
+	}
+
+	return workspace, nil
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorgemul/todos/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// ExportTodos returns every todo of the workspace in ctx, todos older than accounts have no
+// owner and are left out. Operators may connect as a superuser skipping row level security,
+// so the workspace is filtered explicitly.
+func (db *DBStore) ExportTodos(ctx context.Context) (types.ExportedTodos, error) {
+	todos := types.ExportedTodos{}
+
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		rows, err := tx.Query(
+			ctx,
+			"SELECT u.username, t.content, t.created_at FROM "+db.tables.todos+" t JOIN users u ON u.id = t.owner_id WHERE t.workspace_id = $1 ORDER BY t.id ASC",
+			workspaceId,
+		)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var todo types.ExportedTodo
+			if err := rows.Scan(&todo.Owner, &todo.Content, &todo.CreatedAt); err != nil {
+				return err
+			}
+			todos = append(todos, todo)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// ImportTodos adds todos to the workspace in ctx keeping their creation time. Either all of
+// them are imported or none, when an owner doesn't exist or the quota of the workspace is exceeded.
+func (db *DBStore) ImportTodos(ctx context.Context, todos types.ExportedTodos) error {
+	return db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		if err := db.checkTodoQuota(ctx, tx, workspaceId, len(todos)); err != nil {
+			return err
+		}
+
+		for _, todo := range todos {
+			result, err := tx.Exec(
+				ctx,
+				"INSERT INTO "+db.tables.todos+" (content, owner_id, workspace_id, created_at) SELECT $1::VARCHAR, id, $2::INTEGER, $3::TIMESTAMP FROM users WHERE username = $4",
+				todo.Content, workspaceId, todo.CreatedAt, todo.Owner,
+			)
+			if err != nil {
+				return err
+			}
+
+			if result.RowsAffected() == 0 {
+				return UserNotExistErr
+			}
+		}
+
+		return nil
+	})
+}
+
+// PurgeTrash deletes sessions and tokens which expired or were revoked before the given time.
+// Used refresh tokens are kept until they expire, presenting one again revokes its family.
+func (db *DBStore) PurgeTrash(ctx context.Context, before time.Time) (types.Purged, error) {
+	var purged types.Purged
+
+	err := pgx.BeginFunc(ctx, db.Pool, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, "DELETE FROM sessions WHERE expires_at < $1", before)
+		if err != nil {
+			return err
+		}
+		purged.Sessions = int(result.RowsAffected())
+
+		result, err = tx.Exec(ctx, "DELETE FROM tokens WHERE revoked_at < $1 OR expires_at < $1", before)
+		if err != nil {
+			return err
+		}
+		purged.Tokens = int(result.RowsAffected())
+
+		result, err = tx.Exec(ctx, "DELETE FROM refresh_tokens WHERE expires_at < $1", before)
+		if err != nil {
+			return err
+		}
+		purged.RefreshTokens = int(result.RowsAffected())
+
+		return nil
+	})
+	if err != nil {
+		return types.Purged{}, err
+	}
+
+	return purged, nil
+}
+
+func (db *DBStore) GetStats(ctx context.Context) (types.Stats, error) {
+	var stats types.Stats
+
+	err := db.QueryRow(
+		ctx,
+		`SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(*) FROM sessions WHERE expires_at > NOW()),
+			(SELECT COUNT(*) FROM tokens WHERE revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW()))`,
+	).Scan(&stats.Users, &stats.Sessions, &stats.Tokens)
+	if err != nil {
+		return types.Stats{}, err
+	}
+
+	if stats.Todos, err = db.CountTodos(ctx); err != nil {
+		return types.Stats{}, err
+	}
+
+	return stats, nil
+}
@@ -4,92 +4,554 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
+	"sync/atomic"
+	"time"
 
+	"github.com/gorgemul/todos/pkg/config"
 	"github.com/gorgemul/todos/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
 )
 
 var (
 	noContext            = context.Background()
 	UpdatedIdNotExistErr = errors.New("Updated todo id is not exist!")
 	DeleteIdNotExistErr  = errors.New("Deleted todo id is not exist!")
+	UsernameTakenErr     = errors.New("Username is already taken!")
+	UserNotExistErr      = errors.New("User is not exist!")
+	SessionNotExistErr   = errors.New("Session is not exist or expired!")
+	TokenNotExistErr     = errors.New("Token is not exist, expired or revoked!")
+	RevokedIdNotExistErr = errors.New("Revoked token id is not exist!")
+
+	PermissionDeniedErr     = errors.New("Permission denied!")
+	ShareWithOwnerErr       = errors.New("Can't share a list with its owner!")
+	DeletedShareNotExistErr = errors.New("Deleted share is not exist!")
+
+	WorkspaceNotExistErr  = errors.New("Workspace is not exist!")
+	NotWorkspaceMemberErr = errors.New("Not a member of the workspace!")
+	NoWorkspaceErr        = errors.New("No workspace selected!")
+	TodoQuotaExceededErr  = errors.New("Todo quota of the workspace is exceeded!")
+	MemberNotExistErr     = errors.New("Member is not exist!")
+
+	RefreshTokenNotExistErr = errors.New("Refresh token is not exist, expired or revoked!")
+	RefreshTokenReusedErr   = errors.New("Refresh token was already used, all of its descendants are revoked!")
 )
 
+const uniqueViolationCode = "23505"
+
 type DBStore struct {
 	*pgxpool.Pool
+	// tables are picked by Open from the schema version
+	tables tables
+	// claimStart rotates the workspace ClaimDeliveries starts at
+	claimStart atomic.Uint64
 }
 
-func (db *DBStore) GetTodos() (types.Todos, error) {
-	rows, err := db.Query(noContext, "SELECT * FROM todozz ORDER BY id ASC")
+// tables names the tables every query runs against. A renamed table stays reachable under its
+// old name through a view for a release, the store queries the names of the schema it opened
+// so it runs on both sides of a rename.
+type tables struct {
+	// version is the oldest schema the names are valid for
+	version int
+	todos   string
+	// events is empty before the schema has the event log
+	events string
+	// webhooks and deliveries are empty before the schema has webhooks
+	webhooks   string
+	deliveries string
+}
 
-	if err != nil {
+var (
+	legacyTables = tables{version: MinSchemaVersion, todos: "todozz"}
+	// todozz is renamed to todos by migration 7
+	renamedTables = tables{version: 7, todos: "todos"}
+	// todo_events is created by migration 8
+	eventTables = tables{version: 8, todos: "todos", events: "todo_events"}
+	// webhooks and webhook_deliveries are created by migration 9
+	latestTables = tables{version: 9, todos: "todos", events: "todo_events", webhooks: "webhooks", deliveries: "webhook_deliveries"}
+)
+
+func tablesFor(schemaVersion int) tables {
+	switch {
+	case schemaVersion < renamedTables.version:
+		return legacyTables
+	case schemaVersion < eventTables.version:
+		return renamedTables
+	case schemaVersion < latestTables.version:
+		return eventTables
+	}
+
+	return latestTables
+}
+
+func (db *DBStore) GetTodos(ctx context.Context, userId, listId int) (types.Todos, error) {
+	if err := db.checkRole(ctx, userId, listId, readRoles); err != nil {
 		return nil, err
 	}
 
 	var todos types.Todos
 
-	for rows.Next() {
-		var todo types.Todo
-		if err := rows.Scan(&todo.Id, &todo.Content, &todo.CreatedAt); err != nil {
-			return nil, err
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		rows, err := tx.Query(
+			ctx,
+			"SELECT id, content, created_at FROM "+db.tables.todos+" WHERE owner_id = $2 AND "+hasRoleSQL(1, 2, 3)+" ORDER BY id ASC",
+			userId, listId, readRoles,
+		)
+
+		if err != nil {
+			return err
 		}
-		todos = append(todos, todo)
-	}
+		defer rows.Close()
 
-	if err = rows.Err(); err != nil {
+		for rows.Next() {
+			var todo types.Todo
+			if err := rows.Scan(&todo.Id, &todo.Content, &todo.CreatedAt); err != nil {
+				return err
+			}
+			todos = append(todos, todo)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
 		return nil, err
 	}
 
 	return todos, nil
 }
 
-func (db *DBStore) PostTodo(content string) error {
-	_, err := db.Exec(noContext, "INSERT INTO todozz (content) VALUES ($1);", content)
+// GetTodosOfLists is GetTodos for many lists in one query, lists the user can't read are left out
+// of the result rather than failing the batch.
+func (db *DBStore) GetTodosOfLists(ctx context.Context, userId int, listIds []int) (map[int]types.Todos, error) {
+	todosOfLists := make(map[int]types.Todos)
+
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		rows, err := tx.Query(
+			ctx,
+			`SELECT l.id, t.id, t.content, t.created_at
+			FROM unnest($2::INTEGER[]) AS l(id) LEFT JOIN `+db.tables.todos+` t ON t.owner_id = l.id
+			WHERE l.id = $1 OR EXISTS (SELECT 1 FROM list_shares s WHERE s.owner_id = l.id AND s.user_id = $1 AND s.role = ANY($3::TEXT[]))
+			ORDER BY l.id ASC, t.id ASC`,
+			userId, listIds, readRoles,
+		)
+
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var listId int
+			var id *int
+			var content *string
+			var createdAt *time.Time
+			if err := rows.Scan(&listId, &id, &content, &createdAt); err != nil {
+				return err
+			}
+			todos := todosOfLists[listId]
+			// lists without todos come back as a single row of nulls
+			if id != nil {
+				todos = append(todos, types.Todo{Id: *id, Content: *content, CreatedAt: *createdAt})
+			}
+			todosOfLists[listId] = todos
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return todosOfLists, nil
+}
+
+// PostTodo returns the todo it added, with the id and creation time the db gave it.
+func (db *DBStore) PostTodo(ctx context.Context, userId, listId int, content string) (types.Todo, error) {
+	var todo types.Todo
+
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		if err := db.checkTodoQuota(ctx, tx, workspaceId, 1); err != nil {
+			return err
+		}
+
+		err := tx.QueryRow(
+			ctx,
+			"INSERT INTO "+db.tables.todos+" (content, owner_id, workspace_id) SELECT $4::VARCHAR, $2::INTEGER, $5::INTEGER WHERE "+hasRoleSQL(1, 2, 3)+
+				" RETURNING id, content, created_at",
+			userId, listId, writeRoles, content, workspaceId,
+		).Scan(&todo.Id, &todo.Content, &todo.CreatedAt)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			return PermissionDeniedErr
+		}
+		if err != nil {
+			return err
+		}
+
+		return db.changed(ctx, tx, workspaceId, types.NewEvent{Type: types.EventTodoCreated, ListId: listId, UserId: userId, TodoId: todo.Id, Content: todo.Content})
+	})
+
+	if err != nil {
+		return types.Todo{}, err
+	}
+
+	return todo, nil
+}
+
+func (db *DBStore) UpdateTodo(ctx context.Context, userId, listId, id int, content string) (types.Todo, error) {
+	var todo types.Todo
+
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		err := tx.QueryRow(
+			ctx,
+			"UPDATE "+db.tables.todos+" SET content = $4 WHERE id = $5 AND owner_id = $2 AND "+hasRoleSQL(1, 2, 3)+
+				" RETURNING id, content, created_at",
+			userId, listId, writeRoles, content, id,
+		).Scan(&todo.Id, &todo.Content, &todo.CreatedAt)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			if err := db.checkRole(ctx, userId, listId, writeRoles); err != nil {
+				return err
+			}
+			return UpdatedIdNotExistErr
+		}
+		if err != nil {
+			return err
+		}
+
+		return db.changed(ctx, tx, workspaceId, types.NewEvent{Type: types.EventTodoUpdated, ListId: listId, UserId: userId, TodoId: id, Content: content})
+	})
+
+	if err != nil {
+		return types.Todo{}, err
+	}
+
+	return todo, nil
+}
+
+func (db *DBStore) DeleteTodo(ctx context.Context, userId, listId, id int) error {
+	return db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		result, err := tx.Exec(
+			ctx,
+			"DELETE FROM "+db.tables.todos+" WHERE id = $4 AND owner_id = $2 AND "+hasRoleSQL(1, 2, 3),
+			userId, listId, writeRoles, id,
+		)
+		if err != nil {
+			return err
+		}
+
+		if result.RowsAffected() == 0 {
+			if err := db.checkRole(ctx, userId, listId, writeRoles); err != nil {
+				return err
+			}
+			return DeleteIdNotExistErr
+		}
+
+		return db.changed(ctx, tx, workspaceId, types.NewEvent{Type: types.EventTodoDeleted, ListId: listId, UserId: userId, TodoId: id})
+	})
+}
+
+// CreateUser adds a user as a member of the default workspace.
+func (db *DBStore) CreateUser(ctx context.Context, username, passwordHash string) (types.User, error) {
+	var user types.User
+	err := db.QueryRow(
+		ctx,
+		`WITH u AS (INSERT INTO users (username, password_hash) VALUES ($1, $2) RETURNING id, username, password_hash, created_at),
+			m AS (INSERT INTO workspace_members (workspace_id, user_id) SELECT w.id, u.id FROM workspaces w, u WHERE w.slug = $3)
+		SELECT id, username, password_hash, created_at FROM u`,
+		username, passwordHash, DefaultWorkspace,
+	).Scan(&user.Id, &user.Username, &user.PasswordHash, &user.CreatedAt)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+		return types.User{}, UsernameTakenErr
+	}
+	if err != nil {
+		return types.User{}, err
+	}
+
+	return user, nil
+}
+
+func (db *DBStore) GetUserByUsername(ctx context.Context, username string) (types.User, error) {
+	var user types.User
+	err := db.QueryRow(
+		ctx,
+		"SELECT id, username, password_hash, created_at FROM users WHERE username = $1",
+		username,
+	).Scan(&user.Id, &user.Username, &user.PasswordHash, &user.CreatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, UserNotExistErr
+	}
+	if err != nil {
+		return types.User{}, err
+	}
+
+	return user, nil
+}
+
+func (db *DBStore) CreateSession(ctx context.Context, userId int, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Exec(ctx, "INSERT INTO sessions (user_id, token_hash, expires_at) VALUES ($1, $2, $3)", userId, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *DBStore) GetUserBySession(ctx context.Context, tokenHash string) (types.User, error) {
+	var user types.User
+	err := db.QueryRow(
+		ctx,
+		`SELECT u.id, u.username, u.password_hash, u.created_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > NOW()`,
+		tokenHash,
+	).Scan(&user.Id, &user.Username, &user.PasswordHash, &user.CreatedAt)
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, SessionNotExistErr
+	}
+	if err != nil {
+		return types.User{}, err
+	}
+
+	return user, nil
+}
+
+func (db *DBStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	result, err := db.Exec(ctx, "DELETE FROM sessions WHERE token_hash = $1", tokenHash)
 	if err != nil {
 		return err
 	}
 
+	if result.RowsAffected() == 0 {
+		return SessionNotExistErr
+	}
+
 	return nil
 }
 
-func (db *DBStore) UpdateTodo(id int, content string) error {
-	result, err := db.Exec(noContext, "UPDATE todozz SET content = $1 WHERE id = $2", content, id)
+func (db *DBStore) CreateToken(ctx context.Context, userId int, tokenHash string, newToken types.NewToken) (types.Token, error) {
+	var token types.Token
+	err := db.QueryRow(
+		ctx,
+		`INSERT INTO tokens (user_id, name, token_hash, scopes, expires_at, workspace_id)
+		VALUES ($1, $2, $3, $4, $5, (SELECT id FROM workspaces WHERE slug = $6))
+		RETURNING id, name, scopes, expires_at, revoked_at, last_used_at, created_at`,
+		userId, newToken.Name, tokenHash, newToken.Scopes, newToken.ExpiresAt, newToken.Workspace,
+	).Scan(&token.Id, &token.Name, &token.Scopes, &token.ExpiresAt, &token.RevokedAt, &token.LastUsedAt, &token.CreatedAt)
+	if err != nil {
+		return types.Token{}, err
+	}
+
+	token.Workspace = newToken.Workspace
+	return token, nil
+}
+
+func (db *DBStore) GetTokens(ctx context.Context, userId int) (types.Tokens, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT t.id, t.name, t.scopes, t.expires_at, t.revoked_at, t.last_used_at, w.slug, t.created_at
+		FROM tokens t LEFT JOIN workspaces w ON w.id = t.workspace_id
+		WHERE t.user_id = $1 ORDER BY t.id ASC`,
+		userId,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens types.Tokens
+
+	for rows.Next() {
+		var token types.Token
+		if err := rows.Scan(&token.Id, &token.Name, &token.Scopes, &token.ExpiresAt, &token.RevokedAt, &token.LastUsedAt, &token.Workspace, &token.CreatedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (db *DBStore) RevokeToken(ctx context.Context, userId, id int) error {
+	result, err := db.Exec(ctx, "UPDATE tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL", id, userId)
 	if err != nil {
 		return err
 	}
 
 	if result.RowsAffected() == 0 {
-		return UpdatedIdNotExistErr
+		return RevokedIdNotExistErr
 	}
 
 	return nil
 }
 
-func (db *DBStore) DeleteTodo(id int) error {
-	result, err := db.Exec(noContext, "DELETE FROM todozz WHERE id = $1", id)
+// GetUserByToken returns the owner of a token which is neither expired nor revoked, along with the token.
+func (db *DBStore) GetUserByToken(ctx context.Context, tokenHash string) (types.User, types.Token, error) {
+	var user types.User
+	var token types.Token
+	err := db.QueryRow(
+		ctx,
+		`UPDATE tokens t SET last_used_at = NOW()
+		FROM users u
+		WHERE u.id = t.user_id AND t.token_hash = $1 AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > NOW())
+		RETURNING u.id, u.username, u.password_hash, u.created_at,
+			t.id, t.name, t.scopes, t.expires_at, t.revoked_at, t.last_used_at,
+			(SELECT slug FROM workspaces WHERE id = t.workspace_id), t.created_at`,
+		tokenHash,
+	).Scan(
+		&user.Id, &user.Username, &user.PasswordHash, &user.CreatedAt,
+		&token.Id, &token.Name, &token.Scopes, &token.ExpiresAt, &token.RevokedAt, &token.LastUsedAt,
+		&token.Workspace, &token.CreatedAt,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, types.Token{}, TokenNotExistErr
+	}
+	if err != nil {
+		return types.User{}, types.Token{}, err
+	}
+
+	return user, token, nil
+}
+
+func (db *DBStore) CreateRefreshToken(ctx context.Context, userId int, familyId, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Exec(
+		ctx,
+		"INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		userId, familyId, tokenHash, expiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RotateRefreshToken uses up a refresh token and stores its successor in the same family.
+// Presenting an already used token revokes the family since either the client or an attacker holds a stolen copy.
+func (db *DBStore) RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt time.Time) (types.User, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return types.User{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var user types.User
+	var familyId string
+	var used, revoked, expired bool
+	err = tx.QueryRow(
+		ctx,
+		`SELECT r.family_id, r.used_at IS NOT NULL, r.revoked_at IS NOT NULL, r.expires_at <= NOW(),
+			u.id, u.username, u.password_hash, u.created_at
+		FROM refresh_tokens r JOIN users u ON u.id = r.user_id
+		WHERE r.token_hash = $1
+		FOR UPDATE OF r`,
+		tokenHash,
+	).Scan(&familyId, &used, &revoked, &expired, &user.Id, &user.Username, &user.PasswordHash, &user.CreatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.User{}, RefreshTokenNotExistErr
+	}
+	if err != nil {
+		return types.User{}, err
+	}
+
+	if revoked || expired {
+		return types.User{}, RefreshTokenNotExistErr
+	}
+
+	if used {
+		if _, err := tx.Exec(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL", familyId); err != nil {
+			return types.User{}, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return types.User{}, err
+		}
+		return types.User{}, RefreshTokenReusedErr
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE refresh_tokens SET used_at = NOW() WHERE token_hash = $1", tokenHash); err != nil {
+		return types.User{}, err
+	}
+
+	if _, err := tx.Exec(
+		ctx,
+		"INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		user.Id, familyId, newTokenHash, expiresAt,
+	); err != nil {
+		return types.User{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return types.User{}, err
+	}
+
+	return user, nil
+}
+
+func (db *DBStore) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	result, err := db.Exec(
+		ctx,
+		`UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1) AND revoked_at IS NULL`,
+		tokenHash,
+	)
 	if err != nil {
 		return err
 	}
 
 	if result.RowsAffected() == 0 {
-		return DeleteIdNotExistErr
+		return RefreshTokenNotExistErr
 	}
 
 	return nil
 }
 
-func New() (*DBStore, error) {
-	if err := godotenv.Load(); err != nil {
-		return nil, err
+func New(cfg config.DB) (*DBStore, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("problem parsing db url: %v", err)
 	}
 
-	pool, err := pgxpool.New(noContext, os.Getenv("TODO_DB"))
+	poolConfig.MaxConns = int32(cfg.MaxConns)
+	poolConfig.MinConns = int32(cfg.MinConns)
+	poolConfig.ConnConfig.ConnectTimeout = cfg.ConnectTimeout
+	poolConfig.ConnConfig.Tracer = newQueryTracer()
+
+	pool, err := pgxpool.NewWithConfig(noContext, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("problem connecting to db: %v", err)
 	}
 
-	return &DBStore{pool}, nil
+	db, err := Open(noContext, pool)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Open returns a store querying pool, refusing a schema the code can't run against.
+func Open(ctx context.Context, pool *pgxpool.Pool) (*DBStore, error) {
+	db := &DBStore{Pool: pool}
+
+	version, err := db.CheckSchema(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("problem checking db schema, %v", err)
+	}
+	db.tables = tablesFor(version)
+
+	return db, nil
 }
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gorgemul/todos/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// EventsChannel is notified of every event appended, with a types.EventNotification, once the
+// change it logs commits.
+const EventsChannel = "todo_events"
+
+// EventLogNotMigratedErr is returned by the event log of a store opened on a schema older than
+// migration 8, which servers of the previous release still run against.
+var EventLogNotMigratedErr = errors.New("Event log is not migrated yet!")
+
+// committedSQL holds back the events of transactions which may still be followed by the events
+// of older transactions committing later, a cursor past them would skip those for good.
+const committedSQL = "e.tx_id < txid_snapshot_xmin(txid_current_snapshot())"
+
+// changed logs a change to a todo in the transaction which made it, the event of the log and the
+// deliveries of the webhooks subscribed to it are kept if and only if the change is.
+func (db *DBStore) changed(ctx context.Context, tx pgx.Tx, workspaceId int, newEvent types.NewEvent) error {
+	if err := db.appendEvent(ctx, tx, workspaceId, newEvent); err != nil {
+		return fmt.Errorf("problem appending %s event, %v", newEvent.Type, err)
+	}
+
+	return db.enqueueWebhooks(ctx, tx, workspaceId, types.WebhookPayload{
+		Type: newEvent.Type, ListId: newEvent.ListId, UserId: newEvent.UserId, TodoId: newEvent.TodoId, Content: newEvent.Content,
+	})
+}
+
+// appendEvent adds an event to the log and notifies EventsChannel of it, postgres holds the
+// notification back until tx commits and drops it if tx rolls back.
+func (db *DBStore) appendEvent(ctx context.Context, tx pgx.Tx, workspaceId int, newEvent types.NewEvent) error {
+	if db.tables.events == "" {
+		return nil
+	}
+
+	event := types.Event{Type: newEvent.Type, ListId: newEvent.ListId, UserId: &newEvent.UserId, TodoId: newEvent.TodoId, Content: newEvent.Content}
+
+	err := tx.QueryRow(
+		ctx,
+		"INSERT INTO "+db.tables.events+" (workspace_id, list_id, user_id, type, todo_id, content) VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')) RETURNING id, created_at",
+		workspaceId, newEvent.ListId, newEvent.UserId, string(newEvent.Type), newEvent.TodoId, newEvent.Content,
+	).Scan(&event.Id, &event.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(types.EventNotification{WorkspaceId: workspaceId, Event: event})
+	if err != nil {
+		return fmt.Errorf("problem marshal event, %v", err)
+	}
+
+	_, err = tx.Exec(ctx, "SELECT pg_notify($1, $2)", EventsChannel, string(payload))
+	return err
+}
+
+// GetEvents returns up to limit events after the event afterId of the lists the user can read
+// now. Events come in the order their transactions began, so ids aren't always increasing and
+// clients resume from the id of the last event they saw rather than the greatest. An id the log
+// doesn't have resumes from the start. The events of transactions younger than one still
+// running are held back until it ends.
+func (db *DBStore) GetEvents(ctx context.Context, userId int, afterId int64, limit int) (types.Events, error) {
+	if db.tables.events == "" {
+		return nil, EventLogNotMigratedErr
+	}
+
+	var events types.Events
+
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		rows, err := tx.Query(
+			ctx,
+			`SELECT e.id, e.type, e.list_id, e.user_id, e.todo_id, COALESCE(e.content, ''), e.created_at
+			FROM `+db.tables.events+` e
+			WHERE `+committedSQL+` AND (e.tx_id, e.id) > (COALESCE((SELECT a.tx_id FROM `+db.tables.events+` a WHERE a.id = $4), 0), $4)
+				AND (e.list_id = $1 OR EXISTS (SELECT 1 FROM list_shares s WHERE s.owner_id = e.list_id AND s.user_id = $1 AND s.role = ANY($2::TEXT[])))
+			ORDER BY e.tx_id ASC, e.id ASC LIMIT $3`,
+			userId, readRoles, limit, afterId,
+		)
+
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var event types.Event
+			if err := rows.Scan(&event.Id, &event.Type, &event.ListId, &event.UserId, &event.TodoId, &event.Content, &event.CreatedAt); err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// GetLastEventId is the id of the last event of the workspace of ctx GetEvents returns so far, 0
+// before the first one.
+func (db *DBStore) GetLastEventId(ctx context.Context) (int64, error) {
+	if db.tables.events == "" {
+		return 0, EventLogNotMigratedErr
+	}
+
+	var id int64
+
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		return tx.QueryRow(
+			ctx,
+			"SELECT COALESCE((SELECT e.id FROM "+db.tables.events+" e WHERE "+committedSQL+" ORDER BY e.tx_id DESC, e.id DESC LIMIT 1), 0)",
+		).Scan(&id)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
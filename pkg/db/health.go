@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// SchemaVersion is the latest migration the code is written against.
+	SchemaVersion = 9
+	// MinSchemaVersion is the oldest schema the code still runs against, the server refuses to
+	// start and isn't ready on an older one. Keeping it a release behind SchemaVersion lets the
+	// server be rolled out before its migrations run.
+	MinSchemaVersion = 6
+)
+
+const undefinedTableCode = "42P01"
+
+var (
+	SchemaNotMigratedErr = errors.New("Schema is not migrated!")
+	SchemaDirtyErr       = errors.New("Schema is dirty, a migration failed halfway!")
+)
+
+// CheckSchema returns the applied migration version, and an error unless it is at least
+// MinSchemaVersion, isn't older than the tables the store queries and applied cleanly.
+func (db *DBStore) CheckSchema(ctx context.Context) (int, error) {
+	var version int
+	var dirty bool
+
+	err := db.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) || errors.As(err, &pgErr) && pgErr.Code == undefinedTableCode {
+		return 0, SchemaNotMigratedErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return version, SchemaDirtyErr
+	}
+	if version < MinSchemaVersion {
+		return version, fmt.Errorf("Schema version %d is older than %d!", version, MinSchemaVersion)
+	}
+	if version < db.tables.version {
+		return version, fmt.Errorf("Schema version %d was rolled back below %d the server started on!", version, db.tables.version)
+	}
+
+	return version, nil
+}
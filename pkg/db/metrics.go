@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+
+	"github.com/gorgemul/todos/types"
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *DBStore) PoolStats() types.PoolStats {
+	stat := db.Stat()
+
+	return types.PoolStats{
+		AcquiredConns:     stat.AcquiredConns(),
+		IdleConns:         stat.IdleConns(),
+		TotalConns:        stat.TotalConns(),
+		MaxConns:          stat.MaxConns(),
+		AcquireCount:      stat.AcquireCount(),
+		EmptyAcquireCount: stat.EmptyAcquireCount(),
+		AcquireDuration:   stat.AcquireDuration(),
+	}
+}
+
+// CountTodos returns the number of todos of every workspace by slug. Row level security hides
+// other workspaces, so every workspace is counted in a transaction of its own, the metrics
+// reuse the counts between scrapes.
+func (db *DBStore) CountTodos(ctx context.Context) (map[string]int, error) {
+	rows, err := db.Query(ctx, "SELECT id, slug FROM workspaces ORDER BY id ASC")
+	if err != nil {
+		return nil, err
+	}
+
+	var workspaces types.Workspaces
+
+	for rows.Next() {
+		var workspace types.Workspace
+		if err := rows.Scan(&workspace.Id, &workspace.Slug); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(workspaces))
+	for _, workspace := range workspaces {
+		var count int
+		err := db.inWorkspace(WithWorkspace(ctx, workspace.Id), func(tx pgx.Tx, workspaceId int) error {
+			return tx.QueryRow(ctx, "SELECT COUNT(*) FROM "+db.tables.todos+" WHERE workspace_id = $1", workspaceId).Scan(&count)
+		})
+		if err != nil {
+			return nil, err
+		}
+		counts[workspace.Slug] = count
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/gorgemul/todos/internal/db/migrations"
+	"github.com/jackc/pgx/v5"
+)
+
+// migrationLockKey is the advisory lock held while migrating, any constant works as long as
+// every replica agrees on it.
+const migrationLockKey int64 = 0x746f646f73
+
+type MigrationStatus struct {
+	// Version is 0 before the first migration
+	Version uint
+	Dirty   bool
+	Latest  uint
+	Pending []uint
+}
+
+// NewMigrator returns a golang-migrate instance applying the embedded migrations to databaseURL.
+func NewMigrator(databaseURL string) (*migrate.Migrate, error) {
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("problem reading embedded migrations, %v", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("problem connecting migrations to db, %v", err)
+	}
+
+	return m, nil
+}
+
+// Migrate runs fn with a migrator while holding an advisory lock, so replicas migrating on
+// startup wait for each other instead of racing. Having nothing to migrate is not an error.
+func Migrate(ctx context.Context, databaseURL string, fn func(m *migrate.Migrate) error) error {
+	conn, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		return fmt.Errorf("problem connecting to db, %v", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("problem taking migration lock, %v", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	m, err := NewMigrator(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := fn(m); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	return nil
+}
+
+func GetMigrationStatus(m *migrate.Migrate) (MigrationStatus, error) {
+	var status MigrationStatus
+
+	version, dirty, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return MigrationStatus{}, err
+	}
+	status.Version, status.Dirty = version, dirty
+
+	available, err := MigrationVersions()
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	for _, v := range available {
+		if v > status.Version {
+			status.Pending = append(status.Pending, v)
+		}
+		status.Latest = v
+	}
+
+	return status, nil
+}
+
+// MigrationVersions lists the versions of the embedded migrations in ascending order.
+func MigrationVersions() ([]uint, error) {
+	names, err := fs.Glob(migrations.FS, "*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]uint, 0, len(names))
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name %s", name)
+		}
+		versions = append(versions, uint(version))
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	return versions, nil
+}
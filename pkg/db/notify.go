@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gorgemul/todos/pkg/logging"
+	"github.com/gorgemul/todos/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// Notify sends payload to every listener of channel, on every server sharing the db.
+func (db *DBStore) Notify(ctx context.Context, channel, payload string) error {
+	_, err := db.Exec(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
+
+// Listen delivers what is notified on channels until ctx is done or the connection fails, then
+// closes the returned channel. The notifications sent before Listen returns are missed.
+func (db *DBStore) Listen(ctx context.Context, channels ...string) (<-chan types.Notification, error) {
+	poolConn, err := db.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// listening ties the connection up for as long as ctx, it leaves the pool for good
+	conn := poolConn.Hijack()
+
+	for _, channel := range channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			conn.Close(noContext)
+			return nil, err
+		}
+	}
+
+	notifications := make(chan types.Notification)
+	go func() {
+		defer close(notifications)
+		defer conn.Close(noContext)
+
+		for {
+			notification, err := conn.WaitForNotification(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logging.FromContext(ctx).Error(fmt.Sprintf("problem waiting for notifications on %s, %v", strings.Join(channels, ", "), err))
+				}
+				return
+			}
+
+			select {
+			case notifications <- types.Notification{Channel: notification.Channel, Payload: notification.Payload}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return notifications, nil
+}
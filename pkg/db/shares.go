@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gorgemul/todos/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// Roles which grant a permission on a list, owners implicitly hold every permission.
+var (
+	readRoles  = []string{string(types.RoleViewer), string(types.RoleEditor), string(types.RoleAdmin)}
+	writeRoles = []string{string(types.RoleEditor), string(types.RoleAdmin)}
+	adminRoles = []string{string(types.RoleAdmin)}
+)
+
+// hasRoleSQL is a condition which holds when the user at query parameter userParam owns the list
+// at listParam, or was shared it with one of the roles at rolesParam. Every query touching a list
+// includes it, so a handler forgetting a permission check can't leak rows.
+func hasRoleSQL(userParam, listParam, rolesParam int) string {
+	return fmt.Sprintf(
+		"($%[2]d::INTEGER = $%[1]d::INTEGER OR EXISTS (SELECT 1 FROM list_shares WHERE owner_id = $%[2]d AND user_id = $%[1]d AND role = ANY($%[3]d::TEXT[])))",
+		userParam, listParam, rolesParam,
+	)
+}
+
+func (db *DBStore) checkRole(ctx context.Context, userId, listId int, roles []string) error {
+	var ok bool
+	err := db.QueryRow(ctx, "SELECT "+hasRoleSQL(1, 2, 3), userId, listId, roles).Scan(&ok)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return PermissionDeniedErr
+	}
+
+	return nil
+}
+
+// GetLists returns the list of the user followed by every list shared with them.
+func (db *DBStore) GetLists(ctx context.Context, userId int) (types.Lists, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT id, username, $2::VARCHAR FROM users WHERE id = $1
+		UNION ALL
+		(SELECT u.id, u.username, s.role FROM list_shares s JOIN users u ON u.id = s.owner_id WHERE s.user_id = $1 ORDER BY u.id ASC)`,
+		userId, string(types.RoleOwner),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var lists types.Lists
+
+	for rows.Next() {
+		var list types.List
+		if err := rows.Scan(&list.Id, &list.Owner, &list.Role); err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+func (db *DBStore) GetShares(ctx context.Context, userId, listId int) (types.Shares, error) {
+	if err := db.checkRole(ctx, userId, listId, adminRoles); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT s.user_id, u.username, s.role, s.created_at
+		FROM list_shares s JOIN users u ON u.id = s.user_id
+		WHERE s.owner_id = $2 AND `+hasRoleSQL(1, 2, 3)+`
+		ORDER BY s.user_id ASC`,
+		userId, listId, adminRoles,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var shares types.Shares
+
+	for rows.Next() {
+		var share types.Share
+		if err := rows.Scan(&share.UserId, &share.Username, &share.Role, &share.CreatedAt); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+// PutShare shares the list with a user or changes the role they already have.
+func (db *DBStore) PutShare(ctx context.Context, userId, listId int, newShare types.NewShare) (types.Share, error) {
+	if err := db.checkRole(ctx, userId, listId, adminRoles); err != nil {
+		return types.Share{}, err
+	}
+
+	share := types.Share{Username: newShare.Username, Role: newShare.Role}
+	err := db.QueryRow(ctx, "SELECT id FROM users WHERE username = $1", newShare.Username).Scan(&share.UserId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.Share{}, UserNotExistErr
+	}
+	if err != nil {
+		return types.Share{}, err
+	}
+
+	if share.UserId == listId {
+		return types.Share{}, ShareWithOwnerErr
+	}
+
+	err = db.QueryRow(
+		ctx,
+		`INSERT INTO list_shares (owner_id, user_id, role) SELECT $2::INTEGER, $4::INTEGER, $5::VARCHAR WHERE `+hasRoleSQL(1, 2, 3)+`
+		ON CONFLICT (owner_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING created_at`,
+		userId, listId, adminRoles, share.UserId, string(share.Role),
+	).Scan(&share.CreatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.Share{}, PermissionDeniedErr
+	}
+	if err != nil {
+		return types.Share{}, err
+	}
+
+	return share, nil
+}
+
+// DeleteShare lets admins unshare the list with anyone, and everyone leave a list shared with them.
+func (db *DBStore) DeleteShare(ctx context.Context, userId, listId, shareUserId int) error {
+	result, err := db.Exec(
+		ctx,
+		"DELETE FROM list_shares WHERE owner_id = $2 AND user_id = $4 AND ($4 = $1 OR "+hasRoleSQL(1, 2, 3)+")",
+		userId, listId, adminRoles, shareUserId,
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		if shareUserId != userId {
+			if err := db.checkRole(ctx, userId, listId, adminRoles); err != nil {
+				return err
+			}
+		}
+		return DeletedShareNotExistErr
+	}
+
+	return nil
+}
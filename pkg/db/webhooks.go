@@ -0,0 +1,346 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorgemul/todos/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// deliveryLogSize is how many of the latest deliveries GetDeliveries returns.
+const deliveryLogSize = 100
+
+var (
+	// WebhooksNotMigratedErr is returned by the webhooks of a store opened on a schema older than migration 9.
+	WebhooksNotMigratedErr = errors.New("Webhooks are not migrated yet!")
+	WebhookNotExistErr     = errors.New("Webhook is not exist!")
+	DeliveryNotExistErr    = errors.New("Delivery is not exist!")
+)
+
+const deliveryColumns = `d.id, d.webhook_id, d.payload, d.status, d.attempts, d.response_status, COALESCE(d.error, ''),
+	CASE WHEN d.status = 'pending' THEN d.next_attempt_at END, d.last_attempt_at, d.delivered_at, d.created_at`
+
+func (db *DBStore) CreateWebhook(ctx context.Context, userId int, newWebhook types.NewWebhook, secret string) (types.Webhook, error) {
+	if db.tables.webhooks == "" {
+		return types.Webhook{}, WebhooksNotMigratedErr
+	}
+
+	var webhook types.Webhook
+
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		var events []string
+		err := tx.QueryRow(
+			ctx,
+			"INSERT INTO "+db.tables.webhooks+" (workspace_id, user_id, url, secret, events) VALUES ($1, $2, $3, $4, $5) RETURNING id, url, events, created_at",
+			workspaceId, userId, newWebhook.Url, secret, eventStrings(newWebhook.Events),
+		).Scan(&webhook.Id, &webhook.Url, &events, &webhook.CreatedAt)
+		webhook.Events = eventTypes(events)
+		return err
+	})
+
+	if err != nil {
+		return types.Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+func (db *DBStore) GetWebhooks(ctx context.Context, userId int) (types.Webhooks, error) {
+	if db.tables.webhooks == "" {
+		return nil, WebhooksNotMigratedErr
+	}
+
+	var webhooks types.Webhooks
+
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		rows, err := tx.Query(ctx, "SELECT id, url, events, created_at FROM "+db.tables.webhooks+" WHERE user_id = $1 ORDER BY id ASC", userId)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var webhook types.Webhook
+			var events []string
+			if err := rows.Scan(&webhook.Id, &webhook.Url, &events, &webhook.CreatedAt); err != nil {
+				return err
+			}
+			webhook.Events = eventTypes(events)
+			webhooks = append(webhooks, webhook)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes the webhook along with its delivery log.
+func (db *DBStore) DeleteWebhook(ctx context.Context, userId, id int) error {
+	if db.tables.webhooks == "" {
+		return WebhooksNotMigratedErr
+	}
+
+	return db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		result, err := tx.Exec(ctx, "DELETE FROM "+db.tables.webhooks+" WHERE id = $1 AND user_id = $2", id, userId)
+		if err != nil {
+			return err
+		}
+
+		if result.RowsAffected() == 0 {
+			return WebhookNotExistErr
+		}
+
+		return nil
+	})
+}
+
+// GetDeliveries returns the latest deliveries of a webhook of the user, latest first.
+func (db *DBStore) GetDeliveries(ctx context.Context, userId, webhookId int) (types.WebhookDeliveries, error) {
+	if db.tables.webhooks == "" {
+		return nil, WebhooksNotMigratedErr
+	}
+
+	var deliveries types.WebhookDeliveries
+
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM "+db.tables.webhooks+" WHERE id = $1 AND user_id = $2)", webhookId, userId).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return WebhookNotExistErr
+		}
+
+		rows, err := tx.Query(ctx, "SELECT "+deliveryColumns+" FROM "+db.tables.deliveries+" d WHERE d.webhook_id = $1 ORDER BY d.id DESC LIMIT $2", webhookId, deliveryLogSize)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			delivery, err := scanDelivery(rows)
+			if err != nil {
+				return err
+			}
+			deliveries = append(deliveries, delivery)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver queues the payload of a delivery of a webhook of the user again, as a new delivery.
+func (db *DBStore) Redeliver(ctx context.Context, userId, webhookId int, deliveryId int64) (types.WebhookDelivery, error) {
+	if db.tables.webhooks == "" {
+		return types.WebhookDelivery{}, WebhooksNotMigratedErr
+	}
+
+	var delivery types.WebhookDelivery
+
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		var err error
+		delivery, err = scanDelivery(tx.QueryRow(
+			ctx,
+			`INSERT INTO `+db.tables.deliveries+` AS d (workspace_id, webhook_id, event_type, payload)
+			SELECT $1, o.webhook_id, o.event_type, o.payload
+			FROM `+db.tables.deliveries+` o JOIN `+db.tables.webhooks+` w ON w.id = o.webhook_id
+			WHERE o.id = $2 AND o.webhook_id = $3 AND w.user_id = $4
+			RETURNING `+deliveryColumns,
+			workspaceId, deliveryId, webhookId, userId,
+		))
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			return DeliveryNotExistErr
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return types.WebhookDelivery{}, err
+	}
+
+	return delivery, nil
+}
+
+func scanDelivery(row pgx.Row) (types.WebhookDelivery, error) {
+	var delivery types.WebhookDelivery
+	err := row.Scan(
+		&delivery.Id, &delivery.WebhookId, &delivery.Payload, &delivery.Status, &delivery.Attempts, &delivery.ResponseStatus, &delivery.Error,
+		&delivery.NextAttemptAt, &delivery.LastAttemptAt, &delivery.DeliveredAt, &delivery.CreatedAt,
+	)
+	return delivery, err
+}
+
+// enqueueWebhooks queues a delivery of payload for every webhook subscribed to it whose user can
+// read the list, in the transaction of the change.
+func (db *DBStore) enqueueWebhooks(ctx context.Context, tx pgx.Tx, workspaceId int, payload types.WebhookPayload) error {
+	if db.tables.webhooks == "" {
+		return nil
+	}
+
+	payload.CreatedAt = time.Now().UTC()
+
+	_, err := tx.Exec(
+		ctx,
+		`INSERT INTO `+db.tables.deliveries+` (workspace_id, webhook_id, event_type, payload)
+		SELECT $1::INTEGER, w.id, $2::VARCHAR, $3::JSONB FROM `+db.tables.webhooks+` w
+		WHERE $2::TEXT = ANY(w.events) AND (w.user_id = $4::INTEGER OR EXISTS (SELECT 1 FROM list_shares s WHERE s.owner_id = $4 AND s.user_id = w.user_id AND s.role = ANY($5::TEXT[])))`,
+		workspaceId, string(payload.Type), payload, payload.ListId, readRoles,
+	)
+
+	return err
+}
+
+// ClaimDeliveries claims up to limit deliveries which are due, of every workspace. Their next
+// attempt is pushed lease into the future, so other dispatchers skip them while they are sent
+// and pick them up again if the claiming dispatcher dies. Before migration 9 there is nothing
+// to claim.
+//
+// Workspaces share the limit: every call starts at the workspace after the one the last call
+// started at and claims at most an even share of each workspace first, so a busy workspace
+// can't starve the others. Whatever the share leaves of the limit goes to the workspaces which
+// still have deliveries due.
+func (db *DBStore) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]types.PendingDelivery, error) {
+	if db.tables.deliveries == "" || limit <= 0 {
+		return nil, nil
+	}
+
+	workspaceIds, err := db.workspaceIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(workspaceIds) == 0 {
+		return nil, nil
+	}
+
+	first := int((db.claimStart.Add(1) - 1) % uint64(len(workspaceIds)))
+	workspaceIds = append(workspaceIds[first:], workspaceIds[:first]...)
+	share := max(1, limit/len(workspaceIds))
+
+	var claimed []types.PendingDelivery
+	var busy []int
+
+	for _, workspaceId := range workspaceIds {
+		if len(claimed) >= limit {
+			break
+		}
+
+		deliveries, err := db.claimDeliveries(ctx, workspaceId, min(share, limit-len(claimed)), lease)
+		if err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, deliveries...)
+		if len(deliveries) == share {
+			busy = append(busy, workspaceId)
+		}
+	}
+
+	for _, workspaceId := range busy {
+		if len(claimed) >= limit {
+			break
+		}
+
+		deliveries, err := db.claimDeliveries(ctx, workspaceId, limit-len(claimed), lease)
+		if err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, deliveries...)
+	}
+
+	return claimed, nil
+}
+
+// claimDeliveries claims up to limit due deliveries of one workspace, oldest first.
+func (db *DBStore) claimDeliveries(ctx context.Context, workspaceId int, limit int, lease time.Duration) ([]types.PendingDelivery, error) {
+	var claimed []types.PendingDelivery
+
+	err := db.inWorkspace(WithWorkspace(ctx, workspaceId), func(tx pgx.Tx, workspaceId int) error {
+		rows, err := tx.Query(
+			ctx,
+			`UPDATE `+db.tables.deliveries+` d SET attempts = d.attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+			FROM `+db.tables.webhooks+` w
+			WHERE w.id = d.webhook_id AND d.id IN (
+				SELECT id FROM `+db.tables.deliveries+` WHERE status = 'pending' AND next_attempt_at <= NOW()
+				ORDER BY id ASC LIMIT $1 FOR UPDATE SKIP LOCKED
+			)
+			RETURNING d.id, w.url, w.secret, d.payload, d.attempts`,
+			limit, lease.Seconds(),
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			delivery := types.PendingDelivery{WorkspaceId: workspaceId}
+			if err := rows.Scan(&delivery.Id, &delivery.Url, &delivery.Secret, &delivery.Payload, &delivery.Attempts); err != nil {
+				return err
+			}
+			claimed = append(claimed, delivery)
+		}
+
+		return rows.Err()
+	})
+
+	return claimed, err
+}
+
+// RecordAttempt logs the outcome of sending a claimed delivery.
+func (db *DBStore) RecordAttempt(ctx context.Context, attempt types.DeliveryAttempt) error {
+	if db.tables.deliveries == "" {
+		return WebhooksNotMigratedErr
+	}
+
+	return db.inWorkspace(WithWorkspace(ctx, attempt.WorkspaceId), func(tx pgx.Tx, workspaceId int) error {
+		_, err := tx.Exec(
+			ctx,
+			`UPDATE `+db.tables.deliveries+` SET status = $2::VARCHAR, response_status = $3, error = NULLIF($4::TEXT, ''), last_attempt_at = NOW(),
+				next_attempt_at = CASE WHEN $2::VARCHAR = 'pending' THEN NOW() + make_interval(secs => $5) ELSE next_attempt_at END,
+				delivered_at = CASE WHEN $2::VARCHAR = 'delivered' THEN NOW() END
+			WHERE id = $1`,
+			attempt.DeliveryId, string(attempt.Status), attempt.ResponseStatus, attempt.Error, attempt.RetryIn.Seconds(),
+		)
+		return err
+	})
+}
+
+// workspaceIds lists every workspace, row level security makes cross workspace work go through
+// them one transaction at a time.
+func (db *DBStore) workspaceIds(ctx context.Context) ([]int, error) {
+	rows, err := db.Query(ctx, "SELECT id FROM workspaces ORDER BY id ASC")
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+func eventStrings(events []types.EventType) []string {
+	strings := make([]string, len(events))
+	for i, event := range events {
+		strings[i] = string(event)
+	}
+	return strings
+}
+
+func eventTypes(strings []string) []types.EventType {
+	events := make([]types.EventType, len(strings))
+	for i, event := range strings {
+		events[i] = types.EventType(event)
+	}
+	return events
+}
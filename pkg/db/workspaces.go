@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gorgemul/todos/pkg/logging"
+	"github.com/gorgemul/todos/types"
+	"github.com/jackc/pgx/v5"
+)
+
+const DefaultWorkspace = "default"
+
+type contextKey int
+
+const workspaceContextKey contextKey = iota
+
+// WithWorkspace scopes every todo query made with the returned context to the workspace.
+func WithWorkspace(ctx context.Context, workspaceId int) context.Context {
+	return context.WithValue(ctx, workspaceContextKey, workspaceId)
+}
+
+func WorkspaceFromContext(ctx context.Context) (int, bool) {
+	workspaceId, ok := ctx.Value(workspaceContextKey).(int)
+	return workspaceId, ok
+}
+
+// inWorkspace runs fn in a transaction where the row level security policies of the todos table
+// only expose rows of the workspace in ctx. Without a workspace nothing runs at all.
+func (db *DBStore) inWorkspace(ctx context.Context, fn func(tx pgx.Tx, workspaceId int) error) error {
+	workspaceId, ok := WorkspaceFromContext(ctx)
+	if !ok {
+		return NoWorkspaceErr
+	}
+
+	logging.FromContext(ctx).Debug("workspace transaction", "workspace_id", workspaceId)
+
+	return pgx.BeginFunc(ctx, db.Pool, func(tx pgx.Tx) error {
+		// SET doesn't take bind parameters, workspaceId is an int so formatting it is safe
+		if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL app.workspace_id = %d", workspaceId)); err != nil {
+			return err
+		}
+
+		return fn(tx, workspaceId)
+	})
+}
+
+func (db *DBStore) GetWorkspaceBySlug(ctx context.Context, slug string) (types.Workspace, error) {
+	var workspace types.Workspace
+	err := db.QueryRow(
+		ctx,
+		"SELECT id, slug, todo_quota, created_at FROM workspaces WHERE slug = $1",
+		slug,
+	).Scan(&workspace.Id, &workspace.Slug, &workspace.TodoQuota, &workspace.CreatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.Workspace{}, WorkspaceNotExistErr
+	}
+	if err != nil {
+		return types.Workspace{}, err
+	}
+
+	return workspace, nil
+}
+
+// GetMemberWorkspace is GetWorkspaceBySlug for a user, returning NotWorkspaceMemberErr unless
+// they are a member of the workspace.
+func (db *DBStore) GetMemberWorkspace(ctx context.Context, userId int, slug string) (types.Workspace, error) {
+	var workspace types.Workspace
+	var member bool
+	err := db.QueryRow(
+		ctx,
+		`SELECT w.id, w.slug, w.todo_quota, w.created_at, EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = w.id AND m.user_id = $2)
+		FROM workspaces w WHERE w.slug = $1`,
+		slug, userId,
+	).Scan(&workspace.Id, &workspace.Slug, &workspace.TodoQuota, &workspace.CreatedAt, &member)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.Workspace{}, WorkspaceNotExistErr
+	}
+	if err != nil {
+		return types.Workspace{}, err
+	}
+
+	if !member {
+		return types.Workspace{}, NotWorkspaceMemberErr
+	}
+
+	return workspace, nil
+}
+
+// AddWorkspaceMember lets a user act in a workspace, adding a member again changes nothing.
+func (db *DBStore) AddWorkspaceMember(ctx context.Context, slug, username string) error {
+	workspace, err := db.GetWorkspaceBySlug(ctx, slug)
+	if err != nil {
+		return err
+	}
+
+	user, err := db.GetUserByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, "INSERT INTO workspace_members (workspace_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", workspace.Id, user.Id)
+	return err
+}
+
+// RemoveWorkspaceMember stops a user from acting in a workspace, their todos stay in it.
+func (db *DBStore) RemoveWorkspaceMember(ctx context.Context, slug, username string) error {
+	result, err := db.Exec(
+		ctx,
+		`DELETE FROM workspace_members m USING workspaces w, users u
+		WHERE m.workspace_id = w.id AND m.user_id = u.id AND w.slug = $1 AND u.username = $2`,
+		slug, username,
+	)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return MemberNotExistErr
+	}
+
+	return nil
+}
+
+// GetWorkspace returns the workspace in ctx along with how many todos it holds.
+func (db *DBStore) GetWorkspace(ctx context.Context) (types.Workspace, error) {
+	var workspace types.Workspace
+	err := db.inWorkspace(ctx, func(tx pgx.Tx, workspaceId int) error {
+		return tx.QueryRow(
+			ctx,
+			`SELECT w.id, w.slug, w.todo_quota, w.created_at, (SELECT COUNT(*) FROM `+db.tables.todos+` WHERE workspace_id = w.id)
+			FROM workspaces w WHERE w.id = $1`,
+			workspaceId,
+		).Scan(&workspace.Id, &workspace.Slug, &workspace.TodoQuota, &workspace.CreatedAt, &workspace.TodoCount)
+	})
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.Workspace{}, WorkspaceNotExistErr
+	}
+	if err != nil {
+		return types.Workspace{}, err
+	}
+
+	return workspace, nil
+}
+
+// checkTodoQuota checks there is room for adding more todos, it locks the workspace row so
+// concurrent inserts can't overshoot the quota together.
+func (db *DBStore) checkTodoQuota(ctx context.Context, tx pgx.Tx, workspaceId, adding int) error {
+	var quota *int
+	if err := tx.QueryRow(ctx, "SELECT todo_quota FROM workspaces WHERE id = $1 FOR UPDATE", workspaceId).Scan(&quota); err != nil {
+		return err
+	}
+
+	if quota == nil {
+		return nil
+	}
+
+	var count int
+	if err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM "+db.tables.todos+" WHERE workspace_id = $1", workspaceId).Scan(&count); err != nil {
+		return err
+	}
+
+	if count+adding > *quota {
+		return TodoQuotaExceededErr
+	}
+
+	return nil
+}
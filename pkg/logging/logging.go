@@ -0,0 +1,33 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type contextKey int
+
+const (
+	loggerContextKey contextKey = iota
+	requestIdContextKey
+)
+
+// WithRequest carries the id of the request being served and a logger tagged with it down to the store.
+func WithRequest(ctx context.Context, requestId string, logger *slog.Logger) context.Context {
+	ctx = context.WithValue(ctx, requestIdContextKey, requestId)
+	return context.WithValue(ctx, loggerContextKey, logger.With("request_id", requestId))
+}
+
+// FromContext returns the logger of the request in ctx, or the default logger outside of requests.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+func RequestIdFromContext(ctx context.Context) (string, bool) {
+	requestId, ok := ctx.Value(requestIdContextKey).(string)
+	return requestId, ok
+}
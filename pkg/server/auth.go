@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/types"
+)
+
+const (
+	sessionCookieName = "session"
+
+	minUsernameLen = 3
+	maxUsernameLen = 50
+	minPasswordLen = 8
+	// bcrypt ignores anything after 72 bytes
+	maxPasswordLen = 72
+)
+
+var invalidCredentialsErr = errors.New(InvalidCredentialsErrMsg)
+
+type contextKey int
+
+const (
+	principalContextKey contextKey = iota
+	todoLoaderContextKey
+)
+
+func (s *Server) registerHandler(w http.ResponseWriter, r *http.Request) {
+	credentials, err := s.extractCredentialsFromRequestBody(r)
+	if err != nil {
+		s.responseDecodeErr(w, r, err)
+		return
+	}
+
+	if err := ValidateCredentials(credentials); err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(credentials.Password)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := s.store.CreateUser(r.Context(), credentials.Username, passwordHash); err != nil {
+		switch err {
+		case db.UsernameTakenErr:
+			s.logAndResponse(w, r, err, http.StatusConflict)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.dbExecuteSuccess(w, "register user")
+}
+
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	credentials, err := s.extractCredentialsFromRequestBody(r)
+	if err != nil {
+		s.responseDecodeErr(w, r, err)
+		return
+	}
+
+	user, err := s.userByCredentials(r.Context(), credentials)
+	if err != nil {
+		switch err {
+		case invalidCredentialsErr:
+			s.logAndResponse(w, r, err, http.StatusUnauthorized)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(auth.SessionTTL)
+	if err := s.store.CreateSession(r.Context(), user.Id, auth.HashToken(token), expiresAt); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if err := s.responseInJSON(w, types.Session{Token: token, ExpiresAt: expiresAt}); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// userByCredentials doesn't tell unknown usernames apart from wrong passwords.
+func (s *Server) userByCredentials(ctx context.Context, credentials types.Credentials) (types.User, error) {
+	user, err := s.store.GetUserByUsername(ctx, credentials.Username)
+	if err != nil && err != db.UserNotExistErr {
+		return types.User{}, err
+	}
+
+	if err == db.UserNotExistErr || !auth.CheckPassword(user.PasswordHash, credentials.Password) {
+		return types.User{}, invalidCredentialsErr
+	}
+
+	return user, nil
+}
+
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	token := s.extractTokenFromRequest(r)
+
+	if err := s.store.DeleteSession(r.Context(), auth.HashToken(token)); err != nil {
+		switch err {
+		case db.SessionNotExistErr:
+			s.logAndResponse(w, r, err, http.StatusBadRequest)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	s.dbExecuteSuccess(w, "logout")
+}
+
+// principal is whoever the credentials of a request belong to.
+type principal struct {
+	user   types.User
+	scopes []string
+	// session is false for personal access tokens
+	session bool
+	// workspace is the slug a personal access token is bound to
+	workspace *string
+}
+
+func (p principal) hasScope(scope string) bool {
+	return slices.Contains(p.scopes, scope)
+}
+
+// authenticate resolves the credentials of the request, if any, to a principal stored in the request context.
+// Requests without credentials pass through anonymously, routes opt into requireScope or requireSession.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := s.extractTokenFromRequest(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := s.clientIp(r)
+		if result, throttled := s.authThrottled(ip); throttled {
+			s.tooManyRequests(w, r, result)
+			return
+		}
+
+		p, err := s.resolvePrincipal(r.Context(), token)
+		if err != nil {
+			switch err {
+			case db.SessionNotExistErr, db.TokenNotExistErr, auth.InvalidJWTErr:
+				s.authFailed(ip)
+				s.logAndResponse(w, r, errors.New(UnauthorizedErrMsg), http.StatusUnauthorized)
+			default:
+				s.logAndResponse(w, r, err, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalContextKey, p)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (s *Server) resolvePrincipal(ctx context.Context, token string) (principal, error) {
+	if strings.HasPrefix(token, auth.TokenPrefix) {
+		user, accessToken, err := s.store.GetUserByToken(ctx, auth.HashToken(token))
+		if err != nil {
+			return principal{}, err
+		}
+		return principal{user: user, scopes: accessToken.Scopes, workspace: accessToken.Workspace}, nil
+	}
+
+	// jwts are issued to browser logins, so they are as good as a session
+	if auth.LooksLikeJWT(token) {
+		claims, err := s.keys.Verify(token)
+		if err != nil {
+			return principal{}, err
+		}
+		userId, err := claims.UserId()
+		if err != nil {
+			return principal{}, auth.InvalidJWTErr
+		}
+		return principal{user: types.User{Id: userId, Username: claims.Username}, scopes: auth.Scopes, session: true}, nil
+	}
+
+	user, err := s.store.GetUserBySession(ctx, auth.HashToken(token))
+	if err != nil {
+		return principal{}, err
+	}
+
+	return principal{user: user, scopes: auth.Scopes, session: true}, nil
+}
+
+func (s *Server) requireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principalFromContext(r.Context())
+		if !ok {
+			s.logAndResponse(w, r, errors.New(UnauthorizedErrMsg), http.StatusUnauthorized)
+			return
+		}
+
+		if !p.hasScope(scope) {
+			s.forbidden(w, r, InsufficientScopeErrMsg+" "+scope+" is required.")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireSession keeps personal access tokens away from account management, a leaked token can't mint new ones.
+func (s *Server) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principalFromContext(r.Context())
+		if !ok {
+			s.logAndResponse(w, r, errors.New(UnauthorizedErrMsg), http.StatusUnauthorized)
+			return
+		}
+
+		if !p.session {
+			s.forbidden(w, r, SessionRequiredErrMsg)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireWriteScope is requireScope for the writes of /graphql and /lists/{list}/live, their
+// routes only require todos:read.
+func requireWriteScope(ctx context.Context) error {
+	if p, _ := principalFromContext(ctx); !p.hasScope(auth.ScopeTodosWrite) {
+		return errors.New(InsufficientScopeErrMsg + " " + auth.ScopeTodosWrite + " is required.")
+	}
+
+	return nil
+}
+
+func principalFromContext(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalContextKey).(principal)
+	return p, ok
+}
+
+func userFromContext(ctx context.Context) types.User {
+	p, _ := principalFromContext(ctx)
+	return p.user
+}
+
+// extractTokenFromRequest prefers the Authorization header over the session cookie.
+func (s *Server) extractTokenFromRequest(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
+
+func (s *Server) extractCredentialsFromRequestBody(r *http.Request) (types.Credentials, error) {
+	var credentials types.Credentials
+	err := decodeBody(r, &credentials)
+	if err != nil {
+		return types.Credentials{}, err
+	}
+
+	return credentials, nil
+}
+
+// ValidateCredentials applies the rules of registering to the credentials of a new user.
+func ValidateCredentials(credentials types.Credentials) error {
+	switch {
+	case !validUsername(credentials.Username):
+		return errors.New(InvalidUsernameErrMsg)
+	case !validPassword(credentials.Password):
+		return errors.New(InvalidPasswordErrMsg)
+	}
+
+	return nil
+}
+
+func validUsername(username string) bool {
+	return len(username) >= minUsernameLen && len(username) <= maxUsernameLen
+}
+
+func validPassword(password string) bool {
+	return len(password) >= minPasswordLen && len(password) <= maxPasswordLen
+}
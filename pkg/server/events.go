@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/logging"
+	"github.com/gorgemul/todos/types"
+)
+
+const (
+	InvalidLastEventIdErrMsg = "Invalid Last-Event-ID!"
+
+	// eventsPageSize is how many events /events reads from the log at once
+	eventsPageSize = 100
+	// eventsHeartbeat keeps idle streams from being cut by proxies
+	eventsHeartbeat = 15 * time.Second
+)
+
+// eventHub wakes up the /events streams of this server when the live hub is notified of an event
+// committed by any server, streams also poll the log every watch interval in case a notification
+// is missed.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan struct{}]struct{})}
+}
+
+func (h *eventHub) subscribe() (<-chan struct{}, func()) {
+	notify := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	h.subscribers[notify] = struct{}{}
+	h.mu.Unlock()
+
+	return notify, func() {
+		h.mu.Lock()
+		delete(h.subscribers, notify)
+		h.mu.Unlock()
+	}
+}
+
+func (h *eventHub) publish() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for notify := range h.subscribers {
+		// a pending notification already makes the stream read the log
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// eventsHandler streams the events of the lists the caller can read as server-sent events. A
+// Last-Event-ID header, or the lastEventId query of a first connect, resumes after that event,
+// otherwise the stream starts with the next one.
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	lastId, err := s.extractLastEventId(r)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	// subscribed before reading the log so no event slips in between
+	notify, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+	// without the live hub listening the stream still polls
+	if err := s.live.hold(); err != nil {
+		logging.FromContext(r.Context()).Warn(err.Error())
+	} else {
+		defer s.live.release()
+	}
+
+	if lastId < 0 {
+		lastId, err = s.store.GetLastEventId(r.Context())
+		if err != nil {
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// streams outlive the write timeout of the http server
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	poll := time.NewTicker(s.watchInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		events, err := s.store.GetEvents(r.Context(), user.Id, lastId, eventsPageSize)
+		if err != nil {
+			if r.Context().Err() == nil {
+				logging.FromContext(r.Context()).Error(fmt.Sprintf("problem reading events, %v", err))
+			}
+			return
+		}
+
+		for _, event := range events {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			lastId = event.Id
+		}
+		if len(events) > 0 {
+			controller.Flush()
+		}
+		if len(events) == eventsPageSize {
+			continue
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.stopping:
+			return
+		case <-notify:
+		case <-poll.C:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			controller.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event types.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("problem marshal event, %v", err)
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+	return err
+}
+
+// extractLastEventId returns -1 when the request doesn't resume.
+func (s *Server) extractLastEventId(r *http.Request) (int64, error) {
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("lastEventId")
+	}
+	if lastEventId == "" {
+		return -1, nil
+	}
+
+	id, err := strconv.ParseInt(lastEventId, 10, 64)
+	if err != nil || id < 0 {
+		return 0, errors.New(InvalidLastEventIdErrMsg)
+	}
+
+	return id, nil
+}
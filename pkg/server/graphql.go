@@ -0,0 +1,643 @@
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/logging"
+	"github.com/gorgemul/todos/types"
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlotel "github.com/graph-gophers/graphql-go/trace/otel"
+)
+
+const (
+	InvalidCursorErrMsg   = "Invalid cursor!"
+	InvalidPageSizeErrMsg = "Invalid page size!"
+	InternalErrMsg        = "Internal server error!"
+
+	DefaultPageSize = 50
+	MaxPageSize     = 100
+
+	// graphQLMaxDepth stops queries nesting deep enough to be costly, the schema has no cycles
+	// so only hostile queries come near it
+	graphQLMaxDepth = 10
+)
+
+//go:embed schema.graphql
+var graphQLSchema string
+
+func newGraphQLSchema(s *Server) *graphql.Schema {
+	return graphql.MustParseSchema(
+		graphQLSchema,
+		&graphQLResolver{s: s},
+		graphql.MaxDepth(graphQLMaxDepth),
+		graphql.Tracer(&gqlotel.Tracer{Tracer: s.tracer}),
+	)
+}
+
+// graphqlHandler runs the query of the request, the todos of lists are batched by a todoLoader
+// living as long as the request. Failed fields are reported in the errors of a 200 response.
+func (s *Server) graphqlHandler(schema *graphql.Schema) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request types.GraphQLRequest
+		if err := decodeBody(r, &request); err != nil {
+			s.responseDecodeErr(w, r, err)
+			return
+		}
+
+		user := userFromContext(r.Context())
+		ctx := context.WithValue(r.Context(), todoLoaderContextKey, newTodoLoader(s.store, user.Id))
+
+		result := schema.Exec(ctx, request.Query, request.OperationName, request.Variables)
+
+		response := types.GraphQLResponse{Data: result.Data}
+		for _, err := range result.Errors {
+			logging.FromContext(ctx).Warn(err.Message, "path", err.Path)
+
+			graphQLErr := types.GraphQLError{Message: err.Message, Path: err.Path}
+			for _, location := range err.Locations {
+				graphQLErr.Locations = append(graphQLErr.Locations, types.GraphQLLocation{Line: location.Line, Column: location.Column})
+			}
+			response.Errors = append(response.Errors, graphQLErr)
+		}
+
+		if err := s.responseInJSON(w, response); err != nil {
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// todoLoader batches the todos of every list a query touches into one GetTodosOfLists call.
+// Resolvers prime the lists they are about to hand out, the first load fetches all of them.
+type todoLoader struct {
+	store  TodoStore
+	userId int
+
+	mu      sync.Mutex
+	pending []int
+	// loaded lists the user can't read are loaded with ok false
+	loaded map[int]loadedTodos
+	// fetching are the batches being fetched by the lists in them, loads of those lists wait for
+	// the batch rather than fetching the lists again
+	fetching map[int]*todoBatch
+}
+
+type loadedTodos struct {
+	todos types.Todos
+	ok    bool
+}
+
+type todoBatch struct {
+	done chan struct{}
+	err  error
+}
+
+func newTodoLoader(store TodoStore, userId int) *todoLoader {
+	return &todoLoader{store: store, userId: userId, loaded: make(map[int]loadedTodos), fetching: make(map[int]*todoBatch)}
+}
+
+func todoLoaderFromContext(ctx context.Context) *todoLoader {
+	return ctx.Value(todoLoaderContextKey).(*todoLoader)
+}
+
+func (l *todoLoader) prime(listIds ...int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, listId := range listIds {
+		if _, ok := l.loaded[listId]; !ok && l.fetching[listId] == nil && !slices.Contains(l.pending, listId) {
+			l.pending = append(l.pending, listId)
+		}
+	}
+}
+
+// load returns the todos of a list, db.PermissionDeniedErr when the user can't read it. The
+// lock isn't held while fetching, so resolvers of lists already loaded don't wait for the db.
+func (l *todoLoader) load(ctx context.Context, listId int) (types.Todos, error) {
+	l.mu.Lock()
+
+	if loaded, ok := l.loaded[listId]; ok {
+		l.mu.Unlock()
+		return loaded.get()
+	}
+
+	if batch, ok := l.fetching[listId]; ok {
+		l.mu.Unlock()
+		return l.wait(ctx, batch, listId)
+	}
+
+	listIds := l.pending
+	if !slices.Contains(listIds, listId) {
+		listIds = append(listIds, listId)
+	}
+	l.pending = nil
+
+	batch := &todoBatch{done: make(chan struct{})}
+	for _, id := range listIds {
+		l.fetching[id] = batch
+	}
+	l.mu.Unlock()
+
+	todosOfLists, err := l.store.GetTodosOfLists(ctx, l.userId, listIds)
+
+	l.mu.Lock()
+	for _, id := range listIds {
+		delete(l.fetching, id)
+		if err == nil {
+			todos, ok := todosOfLists[id]
+			l.loaded[id] = loadedTodos{todos: todos, ok: ok}
+		}
+	}
+	batch.err = err
+	l.mu.Unlock()
+	close(batch.done)
+
+	return l.wait(ctx, batch, listId)
+}
+
+// wait returns the todos of a list once the batch fetching it is done.
+func (l *todoLoader) wait(ctx context.Context, batch *todoBatch, listId int) (types.Todos, error) {
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if batch.err != nil {
+		return nil, batch.err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.loaded[listId].get()
+}
+
+func (l loadedTodos) get() (types.Todos, error) {
+	if !l.ok {
+		return nil, db.PermissionDeniedErr
+	}
+
+	return l.todos, nil
+}
+
+// graphQLResolver resolves both the queries and the mutations of schema.graphql.
+type graphQLResolver struct {
+	s *Server
+}
+
+func (r *graphQLResolver) Me(ctx context.Context) *userResolver {
+	return &userResolver{userFromContext(ctx)}
+}
+
+func (r *graphQLResolver) Workspace(ctx context.Context) (*workspaceResolver, error) {
+	workspace, err := r.s.store.GetWorkspace(ctx)
+	if err != nil {
+		return nil, internalErr(ctx, err)
+	}
+
+	return &workspaceResolver{workspace}, nil
+}
+
+func (r *graphQLResolver) Lists(ctx context.Context) ([]*listResolver, error) {
+	user := userFromContext(ctx)
+
+	lists, err := r.s.store.GetLists(ctx, user.Id)
+	if err != nil {
+		return nil, internalErr(ctx, err)
+	}
+
+	loader := todoLoaderFromContext(ctx)
+	resolvers := make([]*listResolver, 0, len(lists))
+	for _, list := range lists {
+		loader.prime(list.Id)
+		resolvers = append(resolvers, &listResolver{list})
+	}
+
+	return resolvers, nil
+}
+
+func (r *graphQLResolver) List(ctx context.Context, args struct{ Id *int32 }) (*listResolver, error) {
+	listId, err := graphQLListId(ctx, args.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	user := userFromContext(ctx)
+
+	lists, err := r.s.store.GetLists(ctx, user.Id)
+	if err != nil {
+		return nil, internalErr(ctx, err)
+	}
+
+	i := slices.IndexFunc(lists, func(list types.List) bool { return list.Id == listId })
+	if i < 0 {
+		return nil, errors.New(permissionDeniedDetail(types.RoleViewer, listId))
+	}
+
+	return &listResolver{lists[i]}, nil
+}
+
+type todosArgs struct {
+	List   *int32
+	Filter *todoFilter
+	First  *int32
+	After  *string
+}
+
+func (r *graphQLResolver) Todos(ctx context.Context, args todosArgs) (*todoConnectionResolver, error) {
+	listId, err := graphQLListId(ctx, args.List)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadTodoConnection(ctx, listId, connectionArgs{args.Filter, args.First, args.After})
+}
+
+func (r *graphQLResolver) Todo(ctx context.Context, args struct {
+	List *int32
+	Id   int32
+}) (*todoResolver, error) {
+	listId, err := graphQLListId(ctx, args.List)
+	if err != nil {
+		return nil, err
+	}
+
+	todos, err := loadTodos(ctx, listId)
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.IndexFunc(todos, func(todo types.Todo) bool { return todo.Id == int(args.Id) })
+	if i < 0 {
+		return nil, nil
+	}
+
+	return &todoResolver{todos[i]}, nil
+}
+
+func (r *graphQLResolver) CreateTodo(ctx context.Context, args struct {
+	List    *int32
+	Content string
+}) (*todoResolver, error) {
+	if err := requireWriteScope(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateContent(args.Content); err != nil {
+		return nil, err
+	}
+
+	listId, err := graphQLListId(ctx, args.List)
+	if err != nil {
+		return nil, err
+	}
+
+	user := userFromContext(ctx)
+
+	todo, err := r.s.store.PostTodo(ctx, user.Id, listId, args.Content)
+	if err != nil {
+		return nil, mutationErr(ctx, err, listId)
+	}
+
+	return &todoResolver{todo}, nil
+}
+
+func (r *graphQLResolver) UpdateTodo(ctx context.Context, args struct {
+	List    *int32
+	Id      int32
+	Content string
+}) (*todoResolver, error) {
+	if err := requireWriteScope(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateUpdateTodo(types.UpdateTodo{Id: int(args.Id), Content: args.Content}); err != nil {
+		return nil, err
+	}
+
+	listId, err := graphQLListId(ctx, args.List)
+	if err != nil {
+		return nil, err
+	}
+
+	user := userFromContext(ctx)
+
+	todo, err := r.s.store.UpdateTodo(ctx, user.Id, listId, int(args.Id), args.Content)
+	if err != nil {
+		return nil, mutationErr(ctx, err, listId)
+	}
+
+	return &todoResolver{todo}, nil
+}
+
+func (r *graphQLResolver) DeleteTodo(ctx context.Context, args struct {
+	List *int32
+	Id   int32
+}) (int32, error) {
+	if err := requireWriteScope(ctx); err != nil {
+		return 0, err
+	}
+
+	if args.Id <= 0 {
+		return 0, errors.New(InvalidIdErrMsg)
+	}
+
+	listId, err := graphQLListId(ctx, args.List)
+	if err != nil {
+		return 0, err
+	}
+
+	user := userFromContext(ctx)
+
+	if err := r.s.store.DeleteTodo(ctx, user.Id, listId, int(args.Id)); err != nil {
+		return 0, mutationErr(ctx, err, listId)
+	}
+
+	return args.Id, nil
+}
+
+// mutationErr reports the errors of the store the way the http api does, errors it doesn't
+// expect are logged and reported without their details.
+func mutationErr(ctx context.Context, err error, listId int) error {
+	switch err {
+	case db.PermissionDeniedErr:
+		return errors.New(permissionDeniedDetail(types.RoleEditor, listId))
+	case db.TodoQuotaExceededErr, db.UpdatedIdNotExistErr, db.DeleteIdNotExistErr:
+		return err
+	}
+
+	return internalErr(ctx, err)
+}
+
+// internalErr logs an error of the store and reports it without its details.
+func internalErr(ctx context.Context, err error) error {
+	logging.FromContext(ctx).Error(err.Error())
+	return errors.New(InternalErrMsg)
+}
+
+// graphQLListId defaults to the list of the caller like extractListIdFromRequestQuery.
+func graphQLListId(ctx context.Context, list *int32) (int, error) {
+	switch {
+	case list == nil:
+		return userFromContext(ctx).Id, nil
+	case *list <= 0:
+		return 0, errors.New(InvalidListIdErrMsg)
+	}
+
+	return int(*list), nil
+}
+
+func loadTodos(ctx context.Context, listId int) (types.Todos, error) {
+	todos, err := todoLoaderFromContext(ctx).load(ctx, listId)
+	switch {
+	case err == db.PermissionDeniedErr:
+		return nil, errors.New(permissionDeniedDetail(types.RoleViewer, listId))
+	case err != nil:
+		return nil, internalErr(ctx, err)
+	}
+
+	return todos, nil
+}
+
+type userResolver struct {
+	user types.User
+}
+
+func (r *userResolver) Id() int32 {
+	return int32(r.user.Id)
+}
+
+func (r *userResolver) Username() string {
+	return r.user.Username
+}
+
+type workspaceResolver struct {
+	workspace types.Workspace
+}
+
+func (r *workspaceResolver) Id() int32 {
+	return int32(r.workspace.Id)
+}
+
+func (r *workspaceResolver) Slug() string {
+	return r.workspace.Slug
+}
+
+func (r *workspaceResolver) TodoQuota() *int32 {
+	if r.workspace.TodoQuota == nil {
+		return nil
+	}
+
+	quota := int32(*r.workspace.TodoQuota)
+	return &quota
+}
+
+func (r *workspaceResolver) TodoCount() int32 {
+	return int32(r.workspace.TodoCount)
+}
+
+func (r *workspaceResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.workspace.CreatedAt}
+}
+
+type listResolver struct {
+	list types.List
+}
+
+func (r *listResolver) Id() int32 {
+	return int32(r.list.Id)
+}
+
+func (r *listResolver) Owner() string {
+	return r.list.Owner
+}
+
+func (r *listResolver) Role() string {
+	return string(r.list.Role)
+}
+
+func (r *listResolver) Todos(ctx context.Context, args connectionArgs) (*todoConnectionResolver, error) {
+	return loadTodoConnection(ctx, r.list.Id, args)
+}
+
+type todoResolver struct {
+	todo types.Todo
+}
+
+func (r *todoResolver) Id() int32 {
+	return int32(r.todo.Id)
+}
+
+func (r *todoResolver) Content() string {
+	return r.todo.Content
+}
+
+func (r *todoResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.todo.CreatedAt}
+}
+
+type todoFilter struct {
+	Contains      *string
+	CreatedAfter  *graphql.Time
+	CreatedBefore *graphql.Time
+}
+
+func (f *todoFilter) match(todo types.Todo) bool {
+	switch {
+	case f == nil:
+		return true
+	case f.Contains != nil && !strings.Contains(strings.ToLower(todo.Content), strings.ToLower(*f.Contains)):
+		return false
+	case f.CreatedAfter != nil && !todo.CreatedAt.After(f.CreatedAfter.Time):
+		return false
+	case f.CreatedBefore != nil && !todo.CreatedAt.Before(f.CreatedBefore.Time):
+		return false
+	}
+
+	return true
+}
+
+type connectionArgs struct {
+	Filter *todoFilter
+	First  *int32
+	After  *string
+}
+
+// loadTodoConnection pages through the todos of a list matching the filter, in id order. The
+// whole list is loaded first so every list of a query comes in one batch, pages and filters are
+// cut out of it in memory.
+func loadTodoConnection(ctx context.Context, listId int, args connectionArgs) (*todoConnectionResolver, error) {
+	first := DefaultPageSize
+	if args.First != nil {
+		first = int(*args.First)
+	}
+	if first < 0 || first > MaxPageSize {
+		return nil, errors.New(InvalidPageSizeErrMsg + " first must be between 0 and " + strconv.Itoa(MaxPageSize) + ".")
+	}
+
+	afterId := 0
+	if args.After != nil {
+		id, err := decodeCursor(*args.After)
+		if err != nil {
+			return nil, err
+		}
+		afterId = id
+	}
+
+	todos, err := loadTodos(ctx, listId)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched types.Todos
+	for _, todo := range todos {
+		if args.Filter.match(todo) {
+			matched = append(matched, todo)
+		}
+	}
+
+	start := slices.IndexFunc(matched, func(todo types.Todo) bool { return todo.Id > afterId })
+	if start < 0 {
+		start = len(matched)
+	}
+	end := min(start+first, len(matched))
+
+	return &todoConnectionResolver{todos: matched[start:end], hasNextPage: end < len(matched), totalCount: len(matched)}, nil
+}
+
+// cursors are opaque to clients, they encode the id of the last todo of a page.
+func encodeCursor(id int) string {
+	return base64.URLEncoding.EncodeToString([]byte("todo:" + strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	decoded, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New(InvalidCursorErrMsg)
+	}
+
+	id, ok := strings.CutPrefix(string(decoded), "todo:")
+	if !ok {
+		return 0, errors.New(InvalidCursorErrMsg)
+	}
+
+	afterId, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, errors.New(InvalidCursorErrMsg)
+	}
+
+	return afterId, nil
+}
+
+type todoConnectionResolver struct {
+	todos       types.Todos
+	hasNextPage bool
+	totalCount  int
+}
+
+func (r *todoConnectionResolver) Nodes() []*todoResolver {
+	nodes := make([]*todoResolver, 0, len(r.todos))
+	for _, todo := range r.todos {
+		nodes = append(nodes, &todoResolver{todo})
+	}
+
+	return nodes
+}
+
+func (r *todoConnectionResolver) Edges() []*todoEdgeResolver {
+	edges := make([]*todoEdgeResolver, 0, len(r.todos))
+	for _, todo := range r.todos {
+		edges = append(edges, &todoEdgeResolver{todo})
+	}
+
+	return edges
+}
+
+func (r *todoConnectionResolver) PageInfo() *pageInfoResolver {
+	info := &pageInfoResolver{hasNextPage: r.hasNextPage}
+	if len(r.todos) > 0 {
+		endCursor := encodeCursor(r.todos[len(r.todos)-1].Id)
+		info.endCursor = &endCursor
+	}
+
+	return info
+}
+
+func (r *todoConnectionResolver) TotalCount() int32 {
+	return int32(r.totalCount)
+}
+
+type todoEdgeResolver struct {
+	todo types.Todo
+}
+
+func (r *todoEdgeResolver) Cursor() string {
+	return encodeCursor(r.todo.Id)
+}
+
+func (r *todoEdgeResolver) Node() *todoResolver {
+	return &todoResolver{r.todo}
+}
+
+type pageInfoResolver struct {
+	hasNextPage bool
+	endCursor   *string
+}
+
+func (r *pageInfoResolver) HasNextPage() bool {
+	return r.hasNextPage
+}
+
+func (r *pageInfoResolver) EndCursor() *string {
+	return r.endCursor
+}
@@ -0,0 +1,442 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/logging"
+	"github.com/gorgemul/todos/pkg/todospb"
+	"github.com/gorgemul/todos/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	TodoNotExistErrMsg = "Todo is not exist!"
+	ShuttingDownErrMsg = "Server is shutting down!"
+
+	DefaultWatchInterval = time.Second
+)
+
+// grpcScopes are the scopes the methods of the TodoService require.
+var grpcScopes = map[string]string{
+	todospb.TodoService_ListTodos_FullMethodName:  auth.ScopeTodosRead,
+	todospb.TodoService_GetTodo_FullMethodName:    auth.ScopeTodosRead,
+	todospb.TodoService_WatchTodos_FullMethodName: auth.ScopeTodosRead,
+	todospb.TodoService_CreateTodo_FullMethodName: auth.ScopeTodosWrite,
+	todospb.TodoService_UpdateTodo_FullMethodName: auth.ScopeTodosWrite,
+	todospb.TodoService_DeleteTodo_FullMethodName: auth.ScopeTodosWrite,
+}
+
+// WithWatchInterval sets how often /events reads the log in case a notification is missed, and
+// WatchTodos the todos when the live hub can't listen.
+func WithWatchInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.watchInterval = interval
+	}
+}
+
+// todoService implements todospb.TodoServiceServer on the store of the server, the interceptors
+// of newGRPCServer authenticate the calls first.
+type todoService struct {
+	todospb.UnimplementedTodoServiceServer
+	s *Server
+}
+
+func newGRPCServer(s *Server) *grpc.Server {
+	grpcServer := grpc.NewServer(
+		// a reload may lower the limit, checkMsgSize holds messages to the one in effect
+		grpc.MaxRecvMsgSize(int(s.Settings().MaxBodyBytes)),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, err := s.authenticateCall(ctx, info.FullMethod)
+			if err != nil {
+				return nil, s.logCallErr(ctx, err)
+			}
+			if err := s.checkMsgSize(req); err != nil {
+				return nil, s.logCallErr(ctx, err)
+			}
+			resp, err := handler(ctx, req)
+			return resp, s.logCallErr(ctx, err)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := s.authenticateCall(stream.Context(), info.FullMethod)
+			if err != nil {
+				return s.logCallErr(ctx, err)
+			}
+			return s.logCallErr(ctx, handler(srv, &contextStream{ServerStream: stream, ctx: ctx, s: s}))
+		}),
+	)
+	todospb.RegisterTodoServiceServer(grpcServer, &todoService{s: s})
+
+	return grpcServer
+}
+
+// grpcHandler serves the gRPC calls multiplexed with the http api, they only arrive over HTTP/2.
+func (s *Server) grpcHandler(grpcServer *grpc.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// streams outlive the timeouts of the http server, their deadline is the grpc-timeout of the call
+		controller := http.NewResponseController(w)
+		controller.SetReadDeadline(time.Time{})
+		controller.SetWriteDeadline(time.Time{})
+
+		grpcServer.ServeHTTP(w, r)
+	})
+}
+
+// grpcRoutes are the patterns of the methods of the TodoService, "POST /todos.v1.TodoService/ListTodos".
+func grpcRoutes() []string {
+	desc := todospb.TodoService_ServiceDesc
+
+	var routes []string
+	for _, method := range desc.Methods {
+		routes = append(routes, "POST /"+desc.ServiceName+"/"+method.MethodName)
+	}
+	for _, stream := range desc.Streams {
+		routes = append(routes, "POST /"+desc.ServiceName+"/"+stream.StreamName)
+	}
+
+	return routes
+}
+
+// authenticateCall is authenticate, requireScope, rateLimit and resolveWorkspace for gRPC calls.
+func (s *Server) authenticateCall(ctx context.Context, fullMethod string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	token, ok := strings.CutPrefix(firstMetadata(md, "authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		return ctx, status.Error(codes.Unauthenticated, UnauthorizedErrMsg)
+	}
+
+	ip := s.callIp(ctx, md)
+	if result, throttled := s.authThrottled(ip); throttled {
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(ceilSeconds(result.RetryAfter))))
+		return ctx, status.Error(codes.ResourceExhausted, TooManyRequestsErrMsg)
+	}
+
+	p, err := s.resolvePrincipal(ctx, strings.TrimSpace(token))
+	if err != nil {
+		switch err {
+		case db.SessionNotExistErr, db.TokenNotExistErr, auth.InvalidJWTErr:
+			s.authFailed(ip)
+			return ctx, status.Error(codes.Unauthenticated, UnauthorizedErrMsg)
+		default:
+			return ctx, internalStatus(ctx, err)
+		}
+	}
+	ctx = context.WithValue(ctx, principalContextKey, p)
+
+	if scope := grpcScopes[fullMethod]; !p.hasScope(scope) {
+		return ctx, status.Error(codes.PermissionDenied, InsufficientScopeErrMsg+" "+scope+" is required.")
+	}
+
+	if s.Settings().RateLimit {
+		if result := s.limiter.Allow("user:" + strconv.Itoa(p.user.Id)); !result.Allowed {
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(ceilSeconds(result.RetryAfter))))
+			return ctx, status.Error(codes.ResourceExhausted, TooManyRequestsErrMsg)
+		}
+	}
+
+	workspace, err := s.workspaceFor(ctx, firstMetadata(md, strings.ToLower(workspaceHeader)))
+	if err != nil {
+		var boundErr workspaceBoundErr
+		switch {
+		case errors.As(err, &boundErr), err == db.NotWorkspaceMemberErr:
+			return ctx, status.Error(codes.PermissionDenied, err.Error())
+		case err == db.WorkspaceNotExistErr:
+			return ctx, status.Error(codes.InvalidArgument, err.Error())
+		default:
+			return ctx, internalStatus(ctx, err)
+		}
+	}
+
+	return db.WithWorkspace(ctx, workspace.Id), nil
+}
+
+// logCallErr logs failed calls like logAndResponse, internal errors as errors and the rest as warnings.
+func (s *Server) logCallErr(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	level := slog.LevelWarn
+	if status.Code(err) == codes.Internal || status.Code(err) == codes.Unknown {
+		level = slog.LevelError
+	}
+	logging.FromContext(ctx).Log(ctx, level, status.Convert(err).Message(), "code", status.Code(err).String())
+
+	return err
+}
+
+func (t *todoService) ListTodos(ctx context.Context, req *todospb.ListTodosRequest) (*todospb.ListTodosResponse, error) {
+	todos, err := t.todos(ctx, req.ListId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &todospb.ListTodosResponse{Todos: todosToProto(todos)}, nil
+}
+
+func (t *todoService) GetTodo(ctx context.Context, req *todospb.GetTodoRequest) (*todospb.Todo, error) {
+	todos, err := t.todos(ctx, req.ListId)
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.IndexFunc(todos, func(todo types.Todo) bool { return int64(todo.Id) == req.Id })
+	if i < 0 {
+		return nil, status.Error(codes.NotFound, TodoNotExistErrMsg)
+	}
+
+	return todoToProto(todos[i]), nil
+}
+
+func (t *todoService) CreateTodo(ctx context.Context, req *todospb.CreateTodoRequest) (*todospb.CreateTodoResponse, error) {
+	if err := ValidateContent(req.Content); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	listId, err := t.listId(ctx, req.ListId)
+	if err != nil {
+		return nil, err
+	}
+
+	user := userFromContext(ctx)
+
+	todo, err := t.s.store.PostTodo(ctx, user.Id, listId, req.Content)
+	if err != nil {
+		switch err {
+		case db.PermissionDeniedErr:
+			return nil, permissionDeniedStatus(types.RoleEditor, listId)
+		case db.TodoQuotaExceededErr:
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		default:
+			return nil, internalStatus(ctx, err)
+		}
+	}
+
+	return &todospb.CreateTodoResponse{Todo: todoToProto(todo)}, nil
+}
+
+func (t *todoService) UpdateTodo(ctx context.Context, req *todospb.UpdateTodoRequest) (*todospb.UpdateTodoResponse, error) {
+	if err := ValidateUpdateTodo(types.UpdateTodo{Id: int(req.Id), Content: req.Content}); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	listId, err := t.listId(ctx, req.ListId)
+	if err != nil {
+		return nil, err
+	}
+
+	user := userFromContext(ctx)
+
+	if _, err := t.s.store.UpdateTodo(ctx, user.Id, listId, int(req.Id), req.Content); err != nil {
+		switch err {
+		case db.PermissionDeniedErr:
+			return nil, permissionDeniedStatus(types.RoleEditor, listId)
+		case db.UpdatedIdNotExistErr:
+			return nil, status.Error(codes.NotFound, err.Error())
+		default:
+			return nil, internalStatus(ctx, err)
+		}
+	}
+
+	return &todospb.UpdateTodoResponse{}, nil
+}
+
+func (t *todoService) DeleteTodo(ctx context.Context, req *todospb.DeleteTodoRequest) (*todospb.DeleteTodoResponse, error) {
+	if req.Id <= 0 {
+		return nil, status.Error(codes.InvalidArgument, InvalidIdErrMsg)
+	}
+
+	listId, err := t.listId(ctx, req.ListId)
+	if err != nil {
+		return nil, err
+	}
+
+	user := userFromContext(ctx)
+
+	if err := t.s.store.DeleteTodo(ctx, user.Id, listId, int(req.Id)); err != nil {
+		switch err {
+		case db.PermissionDeniedErr:
+			return nil, permissionDeniedStatus(types.RoleEditor, listId)
+		case db.DeleteIdNotExistErr:
+			return nil, status.Error(codes.NotFound, err.Error())
+		default:
+			return nil, internalStatus(ctx, err)
+		}
+	}
+
+	return &todospb.DeleteTodoResponse{}, nil
+}
+
+// WatchTodos sends the todos of the list again whenever the live hub is notified of an event
+// committed by any server, and ends when the server shuts down so clients reconnect elsewhere.
+func (t *todoService) WatchTodos(req *todospb.WatchTodosRequest, stream todospb.TodoService_WatchTodosServer) error {
+	ctx := stream.Context()
+
+	// subscribed before the first read so no change slips in between
+	notify, unsubscribe := t.s.events.subscribe()
+	defer unsubscribe()
+	// without the live hub listening the watch polls
+	var poll <-chan time.Time
+	if err := t.s.live.hold(); err != nil {
+		logging.FromContext(ctx).Warn(err.Error())
+		ticker := time.NewTicker(t.s.watchInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	} else {
+		defer t.s.live.release()
+	}
+
+	var sent types.Todos
+	for first := true; ; first = false {
+		todos, err := t.todos(ctx, req.ListId)
+		if err != nil {
+			return err
+		}
+
+		if first || !slices.Equal(todos, sent) {
+			if err := stream.Send(&todospb.WatchTodosResponse{Todos: todosToProto(todos)}); err != nil {
+				return err
+			}
+			sent = todos
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.s.stopping:
+			return status.Error(codes.Unavailable, ShuttingDownErrMsg)
+		case <-notify:
+		case <-poll:
+		}
+	}
+}
+
+func (t *todoService) todos(ctx context.Context, list int64) (types.Todos, error) {
+	listId, err := t.listId(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+
+	user := userFromContext(ctx)
+
+	todos, err := t.s.store.GetTodos(ctx, user.Id, listId)
+	if err != nil {
+		switch err {
+		case db.PermissionDeniedErr:
+			return nil, permissionDeniedStatus(types.RoleViewer, listId)
+		default:
+			return nil, internalStatus(ctx, err)
+		}
+	}
+
+	return todos, nil
+}
+
+// listId defaults to the list of the caller like extractListIdFromRequestQuery.
+func (t *todoService) listId(ctx context.Context, list int64) (int, error) {
+	switch {
+	case list == 0:
+		return userFromContext(ctx).Id, nil
+	case list < 0:
+		return 0, status.Error(codes.InvalidArgument, InvalidListIdErrMsg)
+	}
+
+	return int(list), nil
+}
+
+// internalStatus logs an error of the store and reports it without its details.
+func internalStatus(ctx context.Context, err error) error {
+	logging.FromContext(ctx).Error(err.Error())
+	return status.Error(codes.Internal, InternalErrMsg)
+}
+
+func permissionDeniedStatus(role types.Role, listId int) error {
+	return status.Error(codes.PermissionDenied, permissionDeniedDetail(role, listId))
+}
+
+func todosToProto(todos types.Todos) []*todospb.Todo {
+	protoTodos := make([]*todospb.Todo, 0, len(todos))
+	for _, todo := range todos {
+		protoTodos = append(protoTodos, todoToProto(todo))
+	}
+
+	return protoTodos
+}
+
+func todoToProto(todo types.Todo) *todospb.Todo {
+	return &todospb.Todo{Id: int64(todo.Id), Content: todo.Content, CreatedAt: timestamppb.New(todo.CreatedAt)}
+}
+
+// callIp is clientIp for gRPC calls.
+func (s *Server) callIp(ctx context.Context, md metadata.MD) string {
+	if s.Settings().TrustProxy {
+		if forwardedFor := firstMetadata(md, "x-forwarded-for"); forwardedFor != "" {
+			ips := strings.Split(forwardedFor, ",")
+			return strings.TrimSpace(ips[len(ips)-1])
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// checkMsgSize refuses messages over the body size limit in effect.
+func (s *Server) checkMsgSize(msg any) error {
+	if m, ok := msg.(proto.Message); ok && int64(proto.Size(m)) > s.Settings().MaxBodyBytes {
+		return status.Error(codes.ResourceExhausted, RequestTooLargeErrMsg)
+	}
+
+	return nil
+}
+
+// contextStream hands the context of the interceptor down to stream handlers.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	s   *Server
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *contextStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return s.s.checkMsgSize(m)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorgemul/todos/types"
+)
+
+// readinessTimeout bounds all checks of one /readyz together, probes give up soon anyway.
+const readinessTimeout = 2 * time.Second
+
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// WithReadinessCheck adds a check to /readyz, for example one making sure a background worker still runs.
+func WithReadinessCheck(name string, check func(ctx context.Context) error) Option {
+	return func(s *Server) {
+		s.checks = append(s.checks, readinessCheck{name: name, check: check})
+	}
+}
+
+// healthzHandler answers as long as the process serves requests, it never touches the db.
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	s.responseHealth(w, r, types.Health{Status: types.HealthOK})
+}
+
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	health := types.Health{Status: types.HealthOK, Checks: make(map[string]types.HealthCheck)}
+
+	checks := []readinessCheck{
+		{name: "database", check: s.store.Ping},
+		{name: "migrations", check: s.checkSchema},
+	}
+	for _, c := range append(checks, s.checks...) {
+		check := types.HealthCheck{Status: types.HealthOK}
+		if err := c.check(ctx); err != nil {
+			check = types.HealthCheck{Status: types.HealthFail, Detail: err.Error()}
+			health.Status = types.HealthFail
+		}
+		health.Checks[c.name] = check
+	}
+
+	s.responseHealth(w, r, health)
+}
+
+func (s *Server) checkSchema(ctx context.Context) error {
+	_, err := s.store.CheckSchema(ctx)
+	return err
+}
+
+func (s *Server) responseHealth(w http.ResponseWriter, r *http.Request, health types.Health) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if health.Status != types.HealthOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := s.responseInJSON(w, health); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+	}
+}
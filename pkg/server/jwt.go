@@ -0,0 +1,165 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/types"
+)
+
+const jwksMaxAge = 5 * time.Minute
+
+func (s *Server) postAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	credentials, err := s.extractCredentialsFromRequestBody(r)
+	if err != nil {
+		s.responseDecodeErr(w, r, err)
+		return
+	}
+
+	user, err := s.userByCredentials(r.Context(), credentials)
+	if err != nil {
+		switch err {
+		case invalidCredentialsErr:
+			s.logAndResponse(w, r, err, http.StatusUnauthorized)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	familyId, err := auth.NewToken()
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := auth.NewToken()
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(auth.RefreshTokenTTL)
+	if err := s.store.CreateRefreshToken(r.Context(), user.Id, familyId, auth.HashToken(refreshToken), expiresAt); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.responseTokenPair(w, r, user, refreshToken)
+}
+
+func (s *Server) postAuthRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := s.extractRefreshTokenFromRequestBody(r)
+	if err != nil {
+		s.responseDecodeErr(w, r, err)
+		return
+	}
+
+	if refreshToken == "" {
+		s.logAndResponse(w, r, errors.New(InvalidRefreshTokenErrMsg), http.StatusBadRequest)
+		return
+	}
+
+	newRefreshToken, err := auth.NewToken()
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(auth.RefreshTokenTTL)
+	user, err := s.store.RotateRefreshToken(r.Context(), auth.HashToken(refreshToken), auth.HashToken(newRefreshToken), expiresAt)
+	if err != nil {
+		switch err {
+		case db.RefreshTokenNotExistErr, db.RefreshTokenReusedErr:
+			s.logAndResponse(w, r, err, http.StatusUnauthorized)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.responseTokenPair(w, r, user, newRefreshToken)
+}
+
+func (s *Server) postAuthRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := s.extractRefreshTokenFromRequestBody(r)
+	if err != nil {
+		s.responseDecodeErr(w, r, err)
+		return
+	}
+
+	if err := s.store.RevokeRefreshToken(r.Context(), auth.HashToken(refreshToken)); err != nil {
+		switch err {
+		case db.RefreshTokenNotExistErr:
+			s.logAndResponse(w, r, err, http.StatusBadRequest)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.dbExecuteSuccess(w, "revoke refresh token")
+}
+
+func (s *Server) getJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	jwks, err := s.keys.JWKS()
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(jwksMaxAge.Seconds())))
+
+	if err := s.responseInJSON(w, jwks); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) responseTokenPair(w http.ResponseWriter, r *http.Request, user types.User, refreshToken string) {
+	now := time.Now()
+	jti, err := auth.NewToken()
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := s.keys.Sign(auth.Claims{
+		Issuer:    auth.Issuer,
+		Subject:   strconv.Itoa(user.Id),
+		Username:  user.Username,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(auth.AccessTokenTTL).Unix(),
+		Id:        jti,
+	})
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	tokenPair := types.TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}
+
+	if err := s.responseInJSON(w, tokenPair); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) extractRefreshTokenFromRequestBody(r *http.Request) (string, error) {
+	var refreshToken types.RefreshToken
+	err := decodeBody(r, &refreshToken)
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken.RefreshToken, nil
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/ratelimit"
+)
+
+const DefaultMaxBodyBytes = 1 << 20
+
+func WithMaxBodyBytes(maxBodyBytes int64) Option {
+	return func(s *Server) {
+		s.initialSettings().MaxBodyBytes = maxBodyBytes
+	}
+}
+
+// WithRateLimit allows every user, or client ip for anonymous requests, bursts of burst
+// requests refilled at rate requests per second. Client ips get as many wrong tokens on top.
+// Without it requests are not throttled.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(s *Server) {
+		settings := s.initialSettings()
+		settings.RateLimit = true
+		settings.RateLimitRate = rate
+		settings.RateLimitBurst = burst
+	}
+}
+
+// WithTrustProxy takes the client ip from the last X-Forwarded-For entry, only use it behind a proxy which sets it.
+func WithTrustProxy() Option {
+	return func(s *Server) {
+		s.initialSettings().TrustProxy = true
+	}
+}
+
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxBodyBytes := s.Settings().MaxBodyBytes
+		if r.ContentLength > maxBodyBytes {
+			s.logAndResponse(w, r, errors.New(RequestTooLargeErrMsg), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// bodies without a declared length fail decoding once they read past the limit
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit sets the RateLimit headers of draft-ietf-httpapi-ratelimit-headers on every response.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := s.Settings()
+		if !settings.RateLimit {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result := s.limiter.Allow(s.rateLimitKey(r))
+		if !result.Allowed {
+			s.tooManyRequests(w, r, result)
+			return
+		}
+
+		setRateLimitHeaders(w, settings, result)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, settings Settings, result ratelimit.Result) {
+	header := w.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", settings.RateLimitBurst, ceilSeconds(time.Duration(float64(settings.RateLimitBurst)/settings.RateLimitRate*float64(time.Second)))))
+}
+
+func (s *Server) tooManyRequests(w http.ResponseWriter, r *http.Request, result ratelimit.Result) {
+	if settings := s.Settings(); settings.RateLimit {
+		setRateLimitHeaders(w, settings, result)
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+	s.logAndResponse(w, r, errors.New(TooManyRequestsErrMsg), http.StatusTooManyRequests)
+}
+
+// authThrottled tells whether a client ip sent too many wrong tokens, its requests with a token
+// are then refused before the token is looked up, so tokens can't be guessed at the speed of the
+// db. Users have buckets of their own, which only throttle them once they are authenticated.
+func (s *Server) authThrottled(ip string) (ratelimit.Result, bool) {
+	if !s.Settings().RateLimit {
+		return ratelimit.Result{}, false
+	}
+
+	result := s.authLimiter.Peek(ip)
+	return result, !result.Allowed
+}
+
+// authFailed counts a wrong token against the client ip it came from.
+func (s *Server) authFailed(ip string) {
+	if s.Settings().RateLimit {
+		s.authLimiter.Allow(ip)
+	}
+}
+
+func (s *Server) rateLimitKey(r *http.Request) string {
+	if p, ok := principalFromContext(r.Context()); ok {
+		return "user:" + strconv.Itoa(p.user.Id)
+	}
+
+	return "ip:" + s.clientIp(r)
+}
+
+func (s *Server) clientIp(r *http.Request) string {
+	if s.Settings().TrustProxy {
+		if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+			ips := strings.Split(forwardedFor, ",")
+			return strings.TrimSpace(ips[len(ips)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,589 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/logging"
+	"github.com/gorgemul/todos/types"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	InvalidLiveMessageErrMsg = "Invalid message type!"
+
+	// liveChannel carries the presence of live connections between the servers sharing the db
+	liveChannel = "todos_live"
+	// liveKeepalive is how often live connections are pinged and announce their presence again
+	liveKeepalive = 30 * time.Second
+	// livePresenceTTL forgets the connections of servers which went away without saying so
+	livePresenceTTL = 5 * liveKeepalive / 2
+	liveWriteWait   = 10 * time.Second
+	// liveSendBuffer is how many messages a connection may fall behind before it is closed
+	liveSendBuffer    = 64
+	liveRelistenDelay = time.Second
+)
+
+var liveUpgrader = websocket.Upgrader{}
+
+type liveKey struct {
+	workspaceId int
+	listId      int
+}
+
+// liveNotification is the payload of liveChannel, the presence of the connection of ConnId.
+type liveNotification struct {
+	WorkspaceId int             `json:"workspaceId"`
+	ListId      int             `json:"listId"`
+	ConnId      string          `json:"connId,omitempty"`
+	Presence    *types.Presence `json:"presence,omitempty"`
+	// Left is true once the connection of ConnId closed
+	Left bool `json:"left,omitempty"`
+	// RevokedUserId lost access to the list, the connections of the user to it are closed
+	RevokedUserId int `json:"revokedUserId,omitempty"`
+}
+
+type livePresence struct {
+	types.Presence
+	seenAt time.Time
+}
+
+// liveHub delivers the presence notified on liveChannel and the events committed on
+// db.EventsChannel to the live connections of this server, and calls published on every event so
+// /events streams wake up. It listens while any connection or stream holds it. Presence is
+// tracked for every connection notified, local or not.
+type liveHub struct {
+	store     NotifyStore
+	logger    *slog.Logger
+	published func()
+	mu        sync.Mutex
+	conns     map[liveKey]map[*liveConn]struct{}
+	presence  map[liveKey]map[string]livePresence
+	holders   int
+	// stopListening is nil while nothing holds the hub
+	stopListening context.CancelFunc
+}
+
+func newLiveHub(store NotifyStore, logger *slog.Logger, published func()) *liveHub {
+	return &liveHub{
+		store:     store,
+		logger:    logger,
+		published: published,
+		conns:     make(map[liveKey]map[*liveConn]struct{}),
+		presence:  make(map[liveKey]map[string]livePresence),
+	}
+}
+
+// liveConn is a websocket of /lists/{list}/live, the hub queues messages on send and closes done
+// when the connection can't keep up. Messages delivered before the snapshot wait in backlog.
+type liveConn struct {
+	id        string
+	key       liveKey
+	send      chan types.LiveMessage
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	presence  types.Presence
+	started   bool
+	backlog   []types.LiveMessage
+}
+
+func newLiveConn(key liveKey, user types.User) *liveConn {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return &liveConn{
+		id:       hex.EncodeToString(b),
+		key:      key,
+		send:     make(chan types.LiveMessage, liveSendBuffer),
+		done:     make(chan struct{}),
+		presence: types.Presence{UserId: user.Id, Username: user.Username},
+	}
+}
+
+// deliver never blocks the hub, a connection which fell behind is closed and reconnects for a
+// new snapshot.
+func (c *liveConn) deliver(message types.LiveMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.started {
+		if len(c.backlog) == liveSendBuffer {
+			c.close()
+			return
+		}
+		c.backlog = append(c.backlog, message)
+		return
+	}
+	c.queue(message)
+}
+
+// start queues the snapshot, then the messages delivered while it was read but the events up to
+// lastEventId, the snapshot shows them already.
+func (c *liveConn) start(snapshot types.LiveMessage, lastEventId int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.started = true
+	c.queue(snapshot)
+	for _, message := range c.backlog {
+		if message.Type == types.LiveEvent && message.Event.Id <= lastEventId {
+			continue
+		}
+		c.queue(message)
+	}
+	c.backlog = nil
+}
+
+// queue is called with mu held.
+func (c *liveConn) queue(message types.LiveMessage) {
+	select {
+	case c.send <- message:
+	default:
+		c.close()
+	}
+}
+
+func (c *liveConn) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+func (c *liveConn) setPresence(todoId *int, editing bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.presence.TodoId, c.presence.Editing = todoId, editing
+}
+
+func (c *liveConn) getPresence() types.Presence {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.presence
+}
+
+// hold starts listening for the first holder, until it releases the hub.
+func (h *liveHub) hold() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.stopListening == nil {
+		ctx, stop := context.WithCancel(context.Background())
+		notifications, err := h.store.Listen(ctx, liveChannel, db.EventsChannel)
+		if err != nil {
+			stop()
+			return fmt.Errorf("problem listening on %s, %v", liveChannel, err)
+		}
+		h.stopListening = stop
+		go h.run(ctx, notifications)
+	}
+	h.holders++
+
+	return nil
+}
+
+// release stops listening with the last holder, the presence seen meanwhile would go stale.
+func (h *liveHub) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.holders--
+	if h.holders == 0 && h.stopListening != nil {
+		h.stopListening()
+		h.stopListening = nil
+		clear(h.presence)
+	}
+}
+
+// join holds the hub for conn, failing before the connection is upgraded.
+func (h *liveHub) join(conn *liveConn) error {
+	if err := h.hold(); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conns[conn.key] == nil {
+		h.conns[conn.key] = make(map[*liveConn]struct{})
+	}
+	h.conns[conn.key][conn] = struct{}{}
+
+	return nil
+}
+
+func (h *liveHub) leave(conn *liveConn) {
+	h.mu.Lock()
+	conn.close()
+	delete(h.conns[conn.key], conn)
+	if len(h.conns[conn.key]) == 0 {
+		delete(h.conns, conn.key)
+	}
+	h.mu.Unlock()
+
+	h.release()
+}
+
+// run delivers the notifications until the last holder releases the hub, listening again
+// whenever the listening connection fails.
+func (h *liveHub) run(ctx context.Context, notifications <-chan types.Notification) {
+	prune := time.NewTicker(liveKeepalive)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-prune.C:
+			h.prune(now)
+		case notification, ok := <-notifications:
+			if !ok {
+				if notifications = h.relisten(ctx); notifications == nil {
+					return
+				}
+				continue
+			}
+			switch notification.Channel {
+			case db.EventsChannel:
+				h.receiveEvent(ctx, notification.Payload)
+			case liveChannel:
+				h.receive(ctx, notification.Payload)
+			}
+		}
+	}
+}
+
+func (h *liveHub) relisten(ctx context.Context) <-chan types.Notification {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(liveRelistenDelay):
+		}
+
+		notifications, err := h.store.Listen(ctx, liveChannel, db.EventsChannel)
+		if err == nil {
+			// events committed while nobody listened went unnotified, streams read again
+			h.published()
+			return notifications
+		}
+		if ctx.Err() == nil {
+			h.logger.Error(fmt.Sprintf("problem listening on %s, %v", liveChannel, err))
+		}
+	}
+}
+
+func (h *liveHub) receiveEvent(ctx context.Context, payload string) {
+	var notification types.EventNotification
+	if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+		h.logger.Error(fmt.Sprintf("problem unmarshal %s notification, %v", db.EventsChannel, err))
+		return
+	}
+	h.published()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	h.broadcast(liveKey{notification.WorkspaceId, notification.Event.ListId}, types.LiveMessage{Type: types.LiveEvent, Event: &notification.Event})
+}
+
+func (h *liveHub) receive(ctx context.Context, payload string) {
+	var notification liveNotification
+	if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+		h.logger.Error(fmt.Sprintf("problem unmarshal %s notification, %v", liveChannel, err))
+		return
+	}
+	key := liveKey{notification.WorkspaceId, notification.ListId}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if notification.RevokedUserId != 0 {
+		h.disconnect(key, notification.RevokedUserId)
+		return
+	}
+
+	// a listener being replaced may still hand over a notification the new one delivers too
+	if ctx.Err() != nil || notification.ConnId == "" {
+		return
+	}
+
+	presence, seen := h.presence[key][notification.ConnId]
+	switch {
+	case notification.Left:
+		if !seen {
+			return
+		}
+		delete(h.presence[key], notification.ConnId)
+		if len(h.presence[key]) == 0 {
+			delete(h.presence, key)
+		}
+	case notification.Presence != nil:
+		changed := !seen || !samePresence(presence.Presence, *notification.Presence)
+		if h.presence[key] == nil {
+			h.presence[key] = make(map[string]livePresence)
+		}
+		h.presence[key][notification.ConnId] = livePresence{Presence: *notification.Presence, seenAt: time.Now()}
+		// connections announce themselves every keepalive, only changes are worth a message
+		if !changed {
+			return
+		}
+	default:
+		return
+	}
+	h.broadcast(key, h.presenceMessage(key))
+}
+
+func (h *liveHub) prune(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for key, presence := range h.presence {
+		pruned := false
+		for connId, p := range presence {
+			if now.Sub(p.seenAt) > livePresenceTTL {
+				delete(presence, connId)
+				pruned = true
+			}
+		}
+		if len(presence) == 0 {
+			delete(h.presence, key)
+		}
+		if pruned {
+			h.broadcast(key, h.presenceMessage(key))
+		}
+	}
+}
+
+// broadcast is called with mu held.
+func (h *liveHub) broadcast(key liveKey, message types.LiveMessage) {
+	for conn := range h.conns[key] {
+		conn.deliver(message)
+	}
+}
+
+// disconnect is called with mu held, it closes the connections of userId to the list of key.
+func (h *liveHub) disconnect(key liveKey, userId int) {
+	for conn := range h.conns[key] {
+		if conn.getPresence().UserId == userId {
+			conn.close()
+		}
+	}
+}
+
+// presenceMessage is called with mu held, it lists the connections by user then connection so
+// clients see a stable order.
+func (h *liveHub) presenceMessage(key liveKey) types.LiveMessage {
+	connIds := make([]string, 0, len(h.presence[key]))
+	for connId := range h.presence[key] {
+		connIds = append(connIds, connId)
+	}
+	slices.SortFunc(connIds, func(a, b string) int {
+		if order := cmp.Compare(h.presence[key][a].UserId, h.presence[key][b].UserId); order != 0 {
+			return order
+		}
+		return cmp.Compare(a, b)
+	})
+
+	presence := make([]types.Presence, 0, len(connIds))
+	for _, connId := range connIds {
+		presence = append(presence, h.presence[key][connId].Presence)
+	}
+
+	return types.LiveMessage{Type: types.LivePresence, Presence: presence}
+}
+
+func samePresence(a, b types.Presence) bool {
+	return a.UserId == b.UserId && a.Username == b.Username && a.Editing == b.Editing &&
+		(a.TodoId == nil) == (b.TodoId == nil) && (a.TodoId == nil || *a.TodoId == *b.TodoId)
+}
+
+// notify sends notification to the live connections of every server, this one included.
+func (h *liveHub) notify(ctx context.Context, notification liveNotification) {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		logging.FromContext(ctx).Error(fmt.Sprintf("problem marshal %s notification, %v", liveChannel, err))
+		return
+	}
+
+	if err := h.store.Notify(ctx, liveChannel, string(payload)); err != nil && ctx.Err() == nil {
+		logging.FromContext(ctx).Error(fmt.Sprintf("problem notifying %s, %v", liveChannel, err))
+	}
+}
+
+func (h *liveHub) announce(ctx context.Context, conn *liveConn) {
+	presence := conn.getPresence()
+	h.notify(ctx, liveNotification{WorkspaceId: conn.key.workspaceId, ListId: conn.key.listId, ConnId: conn.id, Presence: &presence})
+}
+
+func (h *liveHub) announceLeft(ctx context.Context, conn *liveConn) {
+	h.notify(ctx, liveNotification{WorkspaceId: conn.key.workspaceId, ListId: conn.key.listId, ConnId: conn.id, Left: true})
+}
+
+// revoke closes the connections of userId to a list on every server once its share is deleted,
+// the snapshot refuses them when they reconnect.
+func (h *liveHub) revoke(ctx context.Context, workspaceId, listId, userId int) {
+	h.notify(ctx, liveNotification{WorkspaceId: workspaceId, ListId: listId, RevokedUserId: userId})
+}
+
+// liveHandler upgrades to a websocket sending a snapshot of the list, then the events and the
+// presence of everyone connected to it. Clients send their own presence and updates of todos,
+// which require the todos:write scope.
+func (s *Server) liveHandler(w http.ResponseWriter, r *http.Request) {
+	listId, err := s.extractListIdFromRequestPath(r)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	workspaceId, _ := db.WorkspaceFromContext(r.Context())
+	conn := newLiveConn(liveKey{workspaceId, listId}, user)
+
+	// joined before the snapshot is read so no event committed meanwhile is missed
+	if err := s.live.join(conn); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	defer s.live.leave(conn)
+
+	lastEventId, err := s.store.GetLastEventId(r.Context())
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	todos, err := s.store.GetTodos(r.Context(), user.Id, listId)
+	if err != nil {
+		switch err {
+		case db.PermissionDeniedErr:
+			s.permissionDenied(w, r, types.RoleViewer, listId)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+	conn.start(types.LiveMessage{Type: types.LiveSnapshot, Todos: todos}, lastEventId)
+
+	// the upgrader answers the requests it refuses itself
+	ws, err := liveUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn(err.Error())
+		return
+	}
+	defer ws.Close()
+
+	s.live.announce(r.Context(), conn)
+	defer s.live.announceLeft(r.Context(), conn)
+
+	go s.writeLive(r.Context(), ws, conn)
+	s.readLive(r.Context(), ws, conn)
+}
+
+// writeLive is the only writer of ws, it closes ws when it stops so readLive stops too.
+func (s *Server) writeLive(ctx context.Context, ws *websocket.Conn, conn *liveConn) {
+	defer ws.Close()
+
+	keepalive := time.NewTicker(liveKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-s.stopping:
+			goingAway(ws)
+			return
+		case <-conn.done:
+			goingAway(ws)
+			return
+		case message := <-conn.send:
+			ws.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if err := ws.WriteJSON(message); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+				return
+			}
+			s.live.announce(ctx, conn)
+		}
+	}
+}
+
+// goingAway tells the client to reconnect, to another server when this one shuts down.
+func goingAway(ws *websocket.Conn) {
+	ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(liveWriteWait))
+}
+
+func (s *Server) readLive(ctx context.Context, ws *websocket.Conn, conn *liveConn) {
+	// clients answer the pings of writeLive, the ones which don't are gone
+	ws.SetReadLimit(s.Settings().MaxBodyBytes)
+	ws.SetReadDeadline(time.Now().Add(2 * liveKeepalive))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(2 * liveKeepalive))
+	})
+
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var request types.LiveRequest
+		if err := decodeJSON(bytes.NewReader(message), &request); err != nil {
+			s.liveErr(ctx, conn, err)
+			continue
+		}
+
+		switch request.Type {
+		case types.LivePresence:
+			conn.setPresence(request.TodoId, request.Editing)
+			s.live.announce(ctx, conn)
+		case types.LiveUpdate:
+			if err := s.liveUpdate(ctx, conn.key.listId, request); err != nil {
+				s.liveErr(ctx, conn, err)
+			}
+		default:
+			s.liveErr(ctx, conn, errors.New(InvalidLiveMessageErrMsg))
+		}
+	}
+}
+
+// liveUpdate is putHandler for the updates sent on the websocket.
+func (s *Server) liveUpdate(ctx context.Context, listId int, request types.LiveRequest) error {
+	if err := requireWriteScope(ctx); err != nil {
+		return err
+	}
+
+	if err := ValidateUpdateTodo(types.UpdateTodo{Id: request.Id, Content: request.Content}); err != nil {
+		return err
+	}
+
+	user := userFromContext(ctx)
+
+	if _, err := s.store.UpdateTodo(ctx, user.Id, listId, request.Id, request.Content); err != nil {
+		return mutationErr(ctx, err, listId)
+	}
+
+	return nil
+}
+
+// liveErr answers the message of the client which failed, as logAndResponse does for requests.
+func (s *Server) liveErr(ctx context.Context, conn *liveConn, err error) {
+	logging.FromContext(ctx).Warn(err.Error())
+	conn.deliver(types.LiveMessage{Type: types.LiveError, Error: err.Error()})
+}
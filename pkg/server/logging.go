@@ -0,0 +1,77 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	requestIdHeader = "X-Request-ID"
+	// maxRequestIdLen keeps clients from stuffing the logs through X-Request-ID
+	maxRequestIdLen = 128
+)
+
+// WithLogger sets the logger every request logs to, slog.Default() otherwise.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// logRequests tags the request with the X-Request-ID of the client, or a new one, echoes it in
+// the response and logs the request once it is served.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(requestIdHeader)
+		if !validRequestId(requestId) {
+			requestId = newRequestId()
+		}
+		w.Header().Set(requestIdHeader, requestId)
+
+		logger := s.logger
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+			logger = logger.With("trace_id", spanContext.TraceID().String())
+		}
+
+		ctx := logging.WithRequest(r.Context(), requestId, logger)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		logging.FromContext(ctx).Info(
+			"request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+func validRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLen {
+		return false
+	}
+
+	for _, c := range requestId {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	// crypto/rand only fails when the os has no entropy source, an all zero id beats failing the request
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "todos"
+	// countTodosTimeout bounds the db queries of one scrape
+	countTodosTimeout = 2 * time.Second
+	// todoCountsTTL is how long scrapes reuse the todo counts, counting takes a transaction per
+	// workspace
+	todoCountsTTL  = time.Minute
+	unmatchedRoute = "unmatched"
+)
+
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+}
+
+func newMetrics(store MetricsStore, logger *slog.Logger) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		&storeCollector{store: store, logger: logger},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+func (s *Server) metricsHandler() http.Handler {
+	return promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{})
+}
+
+// instrument counts and times every request by the pattern of the route it matches, so ids in
+// paths don't blow up the number of series.
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := s.route(r)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		code := strconv.Itoa(recorder.status)
+		s.metrics.requests.WithLabelValues(route, r.Method, code).Inc()
+		s.metrics.requestDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// route is the pattern r matches, the probes and scrapes of the root mux or the routes behind it.
+func (s *Server) route(r *http.Request) string {
+	if _, pattern := s.root.Handler(r); pattern != "/" {
+		return pattern
+	}
+	if _, pattern := s.routes.Handler(r); pattern != "" {
+		return pattern
+	}
+	return unmatchedRoute
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streaming responses, gRPC ones among them, through as they are written.
+func (r *statusRecorder) Flush() {
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Hijack lets websockets take over the connection, they are counted as switching protocols.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil && !r.wroteHeader {
+		r.status = http.StatusSwitchingProtocols
+		r.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying connection.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+var (
+	poolConnsDesc = prometheus.NewDesc(
+		metricsNamespace+"_db_pool_conns",
+		"Connections of the db pool by state.",
+		[]string{"state"}, nil,
+	)
+	poolMaxConnsDesc = prometheus.NewDesc(
+		metricsNamespace+"_db_pool_max_conns",
+		"Maximum size of the db pool.",
+		nil, nil,
+	)
+	poolAcquiresDesc = prometheus.NewDesc(
+		metricsNamespace+"_db_pool_acquires_total",
+		"Connections acquired from the db pool.",
+		nil, nil,
+	)
+	poolEmptyAcquiresDesc = prometheus.NewDesc(
+		metricsNamespace+"_db_pool_empty_acquires_total",
+		"Acquires which had to wait for a connection because the pool was empty.",
+		nil, nil,
+	)
+	poolAcquireWaitDesc = prometheus.NewDesc(
+		metricsNamespace+"_db_pool_acquire_wait_seconds_total",
+		"Total time spent acquiring connections from the db pool.",
+		nil, nil,
+	)
+	todosDesc = prometheus.NewDesc(
+		metricsNamespace+"_todos",
+		"Todos by workspace.",
+		[]string{"workspace"}, nil,
+	)
+)
+
+// storeCollector reads the pool stats from the store on every scrape, the todo counts once
+// every todoCountsTTL.
+type storeCollector struct {
+	store  MetricsStore
+	logger *slog.Logger
+
+	// mu makes concurrent scrapes wait for one count instead of counting together
+	mu        sync.Mutex
+	counts    map[string]int
+	countedAt time.Time
+}
+
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolConnsDesc
+	ch <- poolMaxConnsDesc
+	ch <- poolAcquiresDesc
+	ch <- poolEmptyAcquiresDesc
+	ch <- poolAcquireWaitDesc
+	ch <- todosDesc
+}
+
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.store.PoolStats()
+
+	ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(stats.AcquiredConns), "acquired")
+	ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(stats.IdleConns), "idle")
+	ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(stats.TotalConns), "total")
+	ch <- prometheus.MustNewConstMetric(poolMaxConnsDesc, prometheus.GaugeValue, float64(stats.MaxConns))
+	ch <- prometheus.MustNewConstMetric(poolAcquiresDesc, prometheus.CounterValue, float64(stats.AcquireCount))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquiresDesc, prometheus.CounterValue, float64(stats.EmptyAcquireCount))
+	ch <- prometheus.MustNewConstMetric(poolAcquireWaitDesc, prometheus.CounterValue, stats.AcquireDuration.Seconds())
+
+	counts, err := c.todoCounts()
+	if err != nil {
+		// the pool stats are still worth scraping when the db is slow
+		c.logger.Error(fmt.Sprintf("problem counting todos, %v", err))
+		return
+	}
+
+	for workspace, count := range counts {
+		ch <- prometheus.MustNewConstMetric(todosDesc, prometheus.GaugeValue, float64(count), workspace)
+	}
+}
+
+func (c *storeCollector) todoCounts() (map[string]int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts != nil && time.Since(c.countedAt) < todoCountsTTL {
+		return c.counts, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), countTodosTimeout)
+	defer cancel()
+
+	counts, err := c.store.CountTodos(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.counts, c.countedAt = counts, time.Now()
+
+	return counts, nil
+}
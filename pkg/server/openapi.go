@@ -0,0 +1,556 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/types"
+)
+
+const (
+	openAPIVersion = "3.0.3"
+	APIVersion     = "1.0.0"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// access is what a route asks of the caller.
+type access int
+
+const (
+	// public routes of the root mux skip authentication, rate limits and workspaces
+	public access = iota
+	// anonymous routes go through the middleware without requiring credentials
+	anonymous
+	scoped
+	session
+)
+
+// operation documents a route, request and response are zero values of the json bodies, a nil
+// response is the plain text success message.
+type operation struct {
+	summary     string
+	access      access
+	scope       string
+	request     any
+	response    any
+	contentType string
+	// list is true for the todo routes acting on ?list=<id>
+	list bool
+	// websocket routes answer 101 and exchange response messages for request messages, which
+	// aren't a request body
+	websocket bool
+	// errors are the statuses of the handler, the ones of the middleware are added by access
+	errors []int
+}
+
+// operations documents every route of New, test/openapi_unit_test.go fails when they drift apart.
+var operations = map[string]operation{
+	"POST /register": {
+		summary: "Register a user",
+		access:  anonymous,
+		request: types.Credentials{},
+		errors:  []int{http.StatusBadRequest, http.StatusConflict},
+	},
+	"POST /login": {
+		summary:  "Log in, the session token is also set as the session cookie",
+		access:   anonymous,
+		request:  types.Credentials{},
+		response: types.Session{},
+		errors:   []int{http.StatusUnauthorized},
+	},
+	"POST /logout": {
+		summary: "Log out of the session of the request",
+		access:  session,
+		errors:  []int{http.StatusBadRequest},
+	},
+	"POST /auth/token": {
+		summary:  "Trade credentials for a jwt access token and a refresh token",
+		access:   anonymous,
+		request:  types.Credentials{},
+		response: types.TokenPair{},
+		errors:   []int{http.StatusUnauthorized},
+	},
+	"POST /auth/refresh": {
+		summary:  "Trade a refresh token for a new pair, using it up",
+		access:   anonymous,
+		request:  types.RefreshToken{},
+		response: types.TokenPair{},
+		errors:   []int{http.StatusBadRequest, http.StatusUnauthorized},
+	},
+	"POST /auth/revoke": {
+		summary: "Revoke a refresh token",
+		access:  anonymous,
+		request: types.RefreshToken{},
+		errors:  []int{http.StatusBadRequest},
+	},
+	"GET /.well-known/jwks.json": {
+		summary:  "Public keys verifying jwt access tokens",
+		access:   anonymous,
+		response: auth.JWKS{},
+	},
+	"POST /tokens": {
+		summary:  "Create a personal access token, shown only once",
+		access:   session,
+		request:  types.NewToken{},
+		response: types.CreatedToken{},
+		errors:   []int{http.StatusBadRequest},
+	},
+	"GET /tokens": {
+		summary:  "List personal access tokens",
+		access:   session,
+		response: types.Tokens{},
+	},
+	"DELETE /tokens/{id}": {
+		summary: "Revoke a personal access token",
+		access:  session,
+		errors:  []int{http.StatusBadRequest},
+	},
+	"POST /webhooks": {
+		summary:  "Register a webhook receiving the events of the lists the user can read, all events unless some are given; the secret signing the payloads is only shown once",
+		access:   session,
+		request:  types.NewWebhook{},
+		response: types.CreatedWebhook{},
+		errors:   []int{http.StatusBadRequest},
+	},
+	"GET /webhooks": {
+		summary:  "List the webhooks of the user",
+		access:   session,
+		response: types.Webhooks{},
+	},
+	"DELETE /webhooks/{id}": {
+		summary: "Delete a webhook and its delivery log",
+		access:  session,
+		errors:  []int{http.StatusBadRequest},
+	},
+	"GET /webhooks/{id}/deliveries": {
+		summary:  "The latest deliveries of a webhook, latest first",
+		access:   session,
+		response: types.WebhookDeliveries{},
+		errors:   []int{http.StatusBadRequest},
+	},
+	"POST /webhooks/{id}/deliveries/{delivery}/redeliver": {
+		summary:  "Queue the payload of a delivery again as a new delivery",
+		access:   session,
+		response: types.WebhookDelivery{},
+		errors:   []int{http.StatusBadRequest},
+	},
+	"GET /workspace": {
+		summary:  "The workspace of the request",
+		access:   scoped,
+		scope:    auth.ScopeTodosRead,
+		response: types.Workspace{},
+	},
+	"GET /lists": {
+		summary:  "Lists the caller owns or was shared",
+		access:   scoped,
+		scope:    auth.ScopeTodosRead,
+		response: types.Lists{},
+	},
+	"GET /lists/{list}/shares": {
+		summary:  "Shares of a list",
+		access:   session,
+		response: types.Shares{},
+		errors:   []int{http.StatusBadRequest},
+	},
+	"PUT /lists/{list}/shares": {
+		summary:  "Share a list with a user, or change their role",
+		access:   session,
+		request:  types.NewShare{},
+		response: types.Share{},
+		errors:   []int{http.StatusBadRequest},
+	},
+	"DELETE /lists/{list}/shares/{id}": {
+		summary: "Stop sharing a list with a user",
+		access:  session,
+		errors:  []int{http.StatusBadRequest},
+	},
+	"POST /graphql": {
+		summary:  "Run a GraphQL query or mutation against the schema of /graphql, mutations require the todos:write scope",
+		access:   scoped,
+		scope:    auth.ScopeTodosRead,
+		request:  types.GraphQLRequest{},
+		response: types.GraphQLResponse{},
+		errors:   []int{http.StatusBadRequest},
+	},
+	"GET /events": {
+		summary:     "Stream the changes to the todos of every list the caller can read as server-sent events, a Last-Event-ID header or lastEventId query resumes after that event",
+		access:      scoped,
+		scope:       auth.ScopeTodosRead,
+		contentType: "text/event-stream",
+		errors:      []int{http.StatusBadRequest},
+	},
+	"GET /lists/{list}/live": {
+		summary:   "Open a websocket on a list, receiving a snapshot of its todos then its events and who is viewing or editing which todo; presence and todo updates are sent back, updates require the todos:write scope",
+		access:    scoped,
+		scope:     auth.ScopeTodosRead,
+		request:   types.LiveRequest{},
+		response:  types.LiveMessage{},
+		websocket: true,
+		errors:    []int{http.StatusBadRequest},
+	},
+	"GET /": {
+		summary:  "List todos",
+		access:   scoped,
+		scope:    auth.ScopeTodosRead,
+		response: types.Todos{},
+		list:     true,
+		errors:   []int{http.StatusBadRequest},
+	},
+	"POST /": {
+		summary: "Add a todo",
+		access:  scoped,
+		scope:   auth.ScopeTodosWrite,
+		request: types.NewTodo{},
+		list:    true,
+		errors:  []int{http.StatusBadRequest},
+	},
+	"PUT /update": {
+		summary: "Update a todo",
+		access:  scoped,
+		scope:   auth.ScopeTodosWrite,
+		request: types.UpdateTodo{},
+		list:    true,
+		errors:  []int{http.StatusBadRequest},
+	},
+	"DELETE /delete/{id}": {
+		summary: "Delete a todo",
+		access:  scoped,
+		scope:   auth.ScopeTodosWrite,
+		list:    true,
+		errors:  []int{http.StatusBadRequest},
+	},
+	"GET /healthz": {
+		summary:  "Liveness probe",
+		response: types.Health{},
+	},
+	"GET /livez": {
+		summary:  "Liveness probe, same as /healthz",
+		response: types.Health{},
+	},
+	"GET /readyz": {
+		summary:  "Readiness probe, 503 with the failed checks unless the db is reachable and migrated",
+		response: types.Health{},
+		errors:   []int{http.StatusServiceUnavailable},
+	},
+	"GET /metrics": {
+		summary:     "Prometheus metrics",
+		contentType: "text/plain",
+	},
+	"GET /openapi.json": {
+		summary:  "This document",
+		response: map[string]any{},
+	},
+	"GET /docs": {
+		summary:     "Browsable docs of this document",
+		contentType: "text/html",
+	},
+}
+
+var pathParamRegexp = regexp.MustCompile(`\{(\w+)\}`)
+
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.responseInJSON(w, OpenAPI()); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
+
+// OpenAPI is the OpenAPI 3 document of every route of the server, the schemas of the bodies are
+// derived from their types.
+func OpenAPI() map[string]any {
+	schemas := make(map[string]any)
+	paths := make(map[string]any)
+
+	for pattern, op := range operations {
+		method, path, _ := strings.Cut(pattern, " ")
+
+		pathItem, ok := paths[path].(map[string]any)
+		if !ok {
+			pathItem = make(map[string]any)
+			paths[path] = pathItem
+		}
+		pathItem[strings.ToLower(method)] = op.document(pattern, path, schemas)
+	}
+
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "todos",
+			"version": APIVersion,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A session token from /login, a jwt access token from /auth/token or a personal access token (" + auth.TokenPrefix + "...)",
+				},
+				"cookie": map[string]any{
+					"type": "apiKey",
+					"in":   "cookie",
+					"name": sessionCookieName,
+				},
+			},
+		},
+	}
+}
+
+func (op operation) document(pattern, path string, schemas map[string]any) map[string]any {
+	document := map[string]any{
+		"operationId": operationId(pattern),
+		"summary":     op.summary,
+	}
+
+	var parameters []any
+	for _, match := range pathParamRegexp.FindAllStringSubmatch(path, -1) {
+		parameters = append(parameters, parameter(match[1], "path", true, "integer"))
+	}
+	if op.list {
+		parameters = append(parameters, parameter("list", "query", false, "integer"))
+	}
+	if op.access != public {
+		parameters = append(parameters, parameter(workspaceHeader, "header", false, "string"))
+	}
+	if parameters != nil {
+		document["parameters"] = parameters
+	}
+
+	if op.request != nil && !op.websocket {
+		document["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": schemaOf(reflect.TypeOf(op.request), schemas)}},
+		}
+	}
+
+	statuses := slices.Clone(op.errors)
+	switch op.access {
+	case scoped:
+		document["description"] = "Requires the " + op.scope + " scope."
+		document["security"] = []any{map[string]any{"bearer": []any{}}, map[string]any{"cookie": []any{}}}
+		statuses = append(statuses, http.StatusUnauthorized, http.StatusForbidden)
+	case session:
+		document["description"] = "Requires a login session, personal access tokens are refused."
+		document["security"] = []any{map[string]any{"bearer": []any{}}, map[string]any{"cookie": []any{}}}
+		statuses = append(statuses, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	if op.access != public {
+		// unknown workspaces, workspaces other than the one of the token and throttled clients
+		statuses = append(statuses, http.StatusBadRequest, http.StatusForbidden, http.StatusTooManyRequests)
+		if op.request != nil && !op.websocket {
+			statuses = append(statuses, http.StatusRequestEntityTooLarge)
+		}
+		statuses = append(statuses, http.StatusInternalServerError)
+	}
+	slices.Sort(statuses)
+
+	responses := map[string]any{"200": op.success(schemas)}
+	if op.websocket {
+		responses = map[string]any{"101": op.switchingProtocols(schemas)}
+	}
+	for _, status := range slices.Compact(statuses) {
+		responses[strconv.Itoa(status)] = errorResponse(status, schemas)
+	}
+	document["responses"] = responses
+
+	return document
+}
+
+func (op operation) success(schemas map[string]any) map[string]any {
+	switch {
+	case op.contentType != "":
+		return map[string]any{
+			"description": "OK",
+			"content":     map[string]any{op.contentType: map[string]any{"schema": map[string]any{"type": "string"}}},
+		}
+	case op.response == nil:
+		return map[string]any{
+			"description": "OK",
+			"content":     map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}},
+		}
+	}
+
+	return map[string]any{
+		"description": "OK",
+		"content":     map[string]any{"application/json": map[string]any{"schema": schemaOf(reflect.TypeOf(op.response), schemas)}},
+	}
+}
+
+// switchingProtocols describes the messages of a websocket, OpenAPI has no words for them.
+func (op operation) switchingProtocols(schemas map[string]any) map[string]any {
+	return map[string]any{
+		"description": "Switching Protocols to a websocket of JSON messages",
+		"x-messages": map[string]any{
+			"receive": schemaOf(reflect.TypeOf(op.response), schemas),
+			"send":    schemaOf(reflect.TypeOf(op.request), schemas),
+		},
+	}
+}
+
+// errorResponse is the problem body of 403s and the plain text message of the other statuses,
+// /readyz is the exception which still reports its checks.
+func errorResponse(status int, schemas map[string]any) map[string]any {
+	var content map[string]any
+	switch status {
+	case http.StatusForbidden:
+		content = map[string]any{problemContentType: map[string]any{"schema": schemaOf(reflect.TypeOf(types.Problem{}), schemas)}}
+	case http.StatusServiceUnavailable:
+		content = map[string]any{"application/json": map[string]any{"schema": schemaOf(reflect.TypeOf(types.Health{}), schemas)}}
+	default:
+		content = map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}}
+	}
+
+	return map[string]any{"description": http.StatusText(status), "content": content}
+}
+
+func parameter(name, in string, required bool, schemaType string) map[string]any {
+	return map[string]any{
+		"name":     name,
+		"in":       in,
+		"required": required,
+		"schema":   map[string]any{"type": schemaType},
+	}
+}
+
+// operationId turns "DELETE /lists/{list}/shares/{id}" into "deleteListsListSharesId".
+func operationId(pattern string) string {
+	method, path, _ := strings.Cut(pattern, " ")
+
+	id := strings.ToLower(method)
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+	if path == "/" {
+		id += "Todos"
+	}
+
+	return id
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// enums are the values of the string types which only take a few.
+var enums = map[reflect.Type][]any{
+	reflect.TypeOf(types.Role("")):           {types.RoleViewer, types.RoleEditor, types.RoleAdmin, types.RoleOwner},
+	reflect.TypeOf(types.EventType("")):      {types.EventTodoCreated, types.EventTodoUpdated, types.EventTodoDeleted},
+	reflect.TypeOf(types.DeliveryStatus("")): {types.DeliveryPending, types.DeliveryDelivered, types.DeliveryFailed},
+}
+
+// fieldConstraints narrow the schemas of struct fields to what the handlers validate, by struct
+// then json name.
+var fieldConstraints = map[reflect.Type]map[string]map[string]any{
+	reflect.TypeOf(types.Todo{}):       {"content": contentConstraints},
+	reflect.TypeOf(types.NewTodo{}):    {"content": contentConstraints},
+	reflect.TypeOf(types.UpdateTodo{}): {"content": contentConstraints},
+}
+
+// contentConstraints are the ones of ValidateContent.
+var contentConstraints = map[string]any{"minLength": 1, "maxLength": MaxContentLength}
+
+// schemaOf describes t as encoding/json encodes it, named structs end up in schemas and are
+// referred to by name.
+func schemaOf(t reflect.Type, schemas map[string]any) map[string]any {
+	if values, ok := enums[t]; ok {
+		return map[string]any{"type": "string", "enum": values}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := schemaOf(t.Elem(), schemas)
+		if _, ok := schema["$ref"]; ok {
+			return map[string]any{"allOf": []any{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		if _, ok := schemas[t.Name()]; !ok {
+			// claimed before the fields so recursive types refer to themselves
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	// interfaces, like the any of /openapi.json, can be anything
+	return map[string]any{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for _, field := range reflect.VisibleFields(t) {
+			if !field.IsExported() || len(field.Index) > 1 {
+				continue
+			}
+
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				addFields(field.Type)
+				continue
+			}
+
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaOf(field.Type, schemas)
+			for key, value := range fieldConstraints[t][name] {
+				properties[name].(map[string]any)[key] = value
+			}
+			if field.Type.Kind() != reflect.Pointer && !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if required != nil {
+		schema["required"] = required
+	}
+
+	return schema
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/logging"
+	"github.com/gorgemul/todos/types"
+)
+
+const problemContentType = "application/problem+json"
+
+// forbidden responds with a problem body so clients can tell why access was denied.
+func (s *Server) forbidden(w http.ResponseWriter, r *http.Request, detail string) {
+	problem := types.Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(http.StatusForbidden),
+		Status:   http.StatusForbidden,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	}
+	problem.RequestId, _ = logging.RequestIdFromContext(r.Context())
+
+	logger := logging.FromContext(r.Context())
+	logger.Warn(detail, "status", problem.Status)
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		logger.Error(fmt.Sprintf("problem writing problem response, %v", err))
+	}
+}
+
+func (s *Server) permissionDenied(w http.ResponseWriter, r *http.Request, role types.Role, listId int) {
+	s.forbidden(w, r, permissionDeniedDetail(role, listId))
+}
+
+func permissionDeniedDetail(role types.Role, listId int) string {
+	return fmt.Sprintf("%s %s access to list %d is required.", db.PermissionDeniedErr, role, listId)
+}
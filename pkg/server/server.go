@@ -1,58 +1,307 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
+	"github.com/gorgemul/todos/pkg/auth"
 	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/logging"
+	"github.com/gorgemul/todos/pkg/ratelimit"
 	"github.com/gorgemul/todos/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	InvalidContentErrMsg = "Invalid content!"
-	InvalidIdErrMsg      = "Invalid id!"
+	InvalidContentErrMsg      = "Invalid content!"
+	InvalidIdErrMsg           = "Invalid id!"
+	InvalidUsernameErrMsg     = "Invalid username!"
+	InvalidPasswordErrMsg     = "Invalid password!"
+	InvalidCredentialsErrMsg  = "Invalid username or password!"
+	UnauthorizedErrMsg        = "Unauthorized!"
+	InsufficientScopeErrMsg   = "Insufficient scope!"
+	SessionRequiredErrMsg     = "Login session required!"
+	InvalidTokenNameErrMsg    = "Invalid token name!"
+	InvalidScopesErrMsg       = "Invalid scopes!"
+	InvalidExpiresAtErrMsg    = "Invalid expiresAt!"
+	InvalidRefreshTokenErrMsg = "Invalid refresh token!"
+	InvalidListIdErrMsg       = "Invalid list id!"
+	InvalidRoleErrMsg         = "Invalid role!"
+	RequestTooLargeErrMsg     = "Request body too large!"
+	TooManyRequestsErrMsg     = "Too many requests!"
 )
 
+// MaxContentLength is how many characters the content column of todos holds.
+const MaxContentLength = 50
+
+// TodoStore methods act on the list of listId on behalf of userId, and return db.PermissionDeniedErr
+// unless the user owns the list or was shared it with a role allowing the action.
+// Only todos of the workspace attached to ctx by db.WithWorkspace are visible.
 type TodoStore interface {
-	GetTodos() (types.Todos, error)
-	PostTodo(content string) error
-	UpdateTodo(id int, content string) error
-	DeleteTodo(id int) error
+	GetTodos(ctx context.Context, userId, listId int) (types.Todos, error)
+	GetTodosOfLists(ctx context.Context, userId int, listIds []int) (map[int]types.Todos, error)
+	PostTodo(ctx context.Context, userId, listId int, content string) (types.Todo, error)
+	UpdateTodo(ctx context.Context, userId, listId, id int, content string) (types.Todo, error)
+	DeleteTodo(ctx context.Context, userId, listId, id int) error
+}
+
+// EventStore reads the log of todo changes /events streams from, the todo mutations of the store
+// append to it themselves and notify db.EventsChannel once they commit.
+type EventStore interface {
+	GetEvents(ctx context.Context, userId int, afterId int64, limit int) (types.Events, error)
+	GetLastEventId(ctx context.Context) (int64, error)
+}
+
+// NotifyStore fans the messages of live connections out to every server sharing the db.
+type NotifyStore interface {
+	Notify(ctx context.Context, channel, payload string) error
+	Listen(ctx context.Context, channels ...string) (<-chan types.Notification, error)
+}
+
+// WebhookStore keeps the webhooks of users and the log of their deliveries, the todo mutations
+// of the store queue the deliveries themselves.
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, userId int, newWebhook types.NewWebhook, secret string) (types.Webhook, error)
+	GetWebhooks(ctx context.Context, userId int) (types.Webhooks, error)
+	DeleteWebhook(ctx context.Context, userId, id int) error
+	GetDeliveries(ctx context.Context, userId, webhookId int) (types.WebhookDeliveries, error)
+	Redeliver(ctx context.Context, userId, webhookId int, deliveryId int64) (types.WebhookDelivery, error)
+}
+
+type UserStore interface {
+	CreateUser(ctx context.Context, username, passwordHash string) (types.User, error)
+	GetUserByUsername(ctx context.Context, username string) (types.User, error)
+	CreateSession(ctx context.Context, userId int, tokenHash string, expiresAt time.Time) error
+	GetUserBySession(ctx context.Context, tokenHash string) (types.User, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+}
+
+type TokenStore interface {
+	CreateToken(ctx context.Context, userId int, tokenHash string, newToken types.NewToken) (types.Token, error)
+	GetTokens(ctx context.Context, userId int) (types.Tokens, error)
+	RevokeToken(ctx context.Context, userId, id int) error
+	GetUserByToken(ctx context.Context, tokenHash string) (types.User, types.Token, error)
+}
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(ctx context.Context, userId int, familyId, tokenHash string, expiresAt time.Time) error
+	RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt time.Time) (types.User, error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+}
+
+type ShareStore interface {
+	GetLists(ctx context.Context, userId int) (types.Lists, error)
+	GetShares(ctx context.Context, userId, listId int) (types.Shares, error)
+	PutShare(ctx context.Context, userId, listId int, newShare types.NewShare) (types.Share, error)
+	DeleteShare(ctx context.Context, userId, listId, shareUserId int) error
+}
+
+type WorkspaceStore interface {
+	GetWorkspaceBySlug(ctx context.Context, slug string) (types.Workspace, error)
+	GetMemberWorkspace(ctx context.Context, userId int, slug string) (types.Workspace, error)
+	GetWorkspace(ctx context.Context) (types.Workspace, error)
+}
+
+// HealthStore is checked by /readyz.
+type HealthStore interface {
+	Ping(ctx context.Context) error
+	CheckSchema(ctx context.Context) (int, error)
+}
+
+// MetricsStore feeds the db gauges of /metrics.
+type MetricsStore interface {
+	PoolStats() types.PoolStats
+	CountTodos(ctx context.Context) (map[string]int, error)
+}
+
+type Store interface {
+	HealthStore
+	MetricsStore
+	TodoStore
+	EventStore
+	NotifyStore
+	WebhookStore
+	WorkspaceStore
+	ShareStore
+	UserStore
+	TokenStore
+	RefreshTokenStore
 }
 
 type Server struct {
-	store TodoStore
+	store       Store
+	keys        *auth.KeySet
+	settings    atomic.Pointer[Settings]
+	limiter     *ratelimit.Limiter
+	authLimiter *ratelimit.Limiter
+	checks      []readinessCheck
+	metrics     *metrics
+	logger      *slog.Logger
+	tracer      trace.Tracer
+	root        *http.ServeMux
+	routes      *http.ServeMux
+	patterns    []string
+	events      *eventHub
+	live        *liveHub
+	// watchInterval is how often /events polls, and WatchTodos of the gRPC api without the live hub
+	watchInterval time.Duration
+	// stopping is closed by Shutdown, streams return once it is
+	stopping chan struct{}
+	stopOnce sync.Once
 	http.Handler
 }
 
-func New(store TodoStore) *Server {
+type Option func(*Server)
+
+// WithKeySet shares the jwt signing keys with whoever rotates them, by default the server generates its own.
+func WithKeySet(keys *auth.KeySet) Option {
+	return func(s *Server) {
+		s.keys = keys
+	}
+}
+
+// WithBaseDomain resolves workspaces from subdomains of baseDomain, team.todos.example.com is
+// the workspace team for the base domain todos.example.com.
+func WithBaseDomain(baseDomain string) Option {
+	return func(s *Server) {
+		s.initialSettings().BaseDomain = normalizeBaseDomain(baseDomain)
+	}
+}
+
+// Shutdown ends the /events streams, live sockets and gRPC watches, which otherwise only end with
+// their client. Register it with http.Server.RegisterOnShutdown so a graceful shutdown doesn't
+// wait on them.
+func (s *Server) Shutdown() {
+	s.stopOnce.Do(func() { close(s.stopping) })
+}
+
+func New(store Store, options ...Option) *Server {
 	srv := new(Server)
 
 	srv.store = store
+	srv.settings.Store(&Settings{MaxBodyBytes: DefaultMaxBodyBytes})
+	srv.logger = slog.Default()
+	srv.tracer = otel.Tracer(tracerName)
+	srv.watchInterval = DefaultWatchInterval
+	srv.events = newEventHub()
+	srv.stopping = make(chan struct{})
+	for _, option := range options {
+		option(srv)
+	}
+	if srv.keys == nil {
+		srv.keys = auth.MustNewKeySet()
+	}
+	// created even without a rate limit, so a reload may turn it on
+	settings := srv.Settings()
+	srv.limiter = ratelimit.New(settings.RateLimitRate, settings.RateLimitBurst)
+	srv.authLimiter = ratelimit.New(settings.RateLimitRate, settings.RateLimitBurst)
+	srv.metrics = newMetrics(store, srv.logger)
+	srv.live = newLiveHub(store, srv.logger, srv.events.publish)
+
 	mux := http.NewServeMux()
 
-	mux.Handle("GET /", http.HandlerFunc(srv.getHandler))
-	mux.Handle("POST /", http.HandlerFunc(srv.postHandler))
-	mux.Handle("PUT /update", http.HandlerFunc(srv.putHandler))
-	mux.Handle("DELETE /delete/{id}", http.HandlerFunc(srv.deleteHandler))
+	srv.handle(mux, "POST /register", http.HandlerFunc(srv.registerHandler))
+	srv.handle(mux, "POST /login", http.HandlerFunc(srv.loginHandler))
+	srv.handle(mux, "POST /logout", srv.requireSession(http.HandlerFunc(srv.logoutHandler)))
+
+	srv.handle(mux, "POST /auth/token", http.HandlerFunc(srv.postAuthTokenHandler))
+	srv.handle(mux, "POST /auth/refresh", http.HandlerFunc(srv.postAuthRefreshHandler))
+	srv.handle(mux, "POST /auth/revoke", http.HandlerFunc(srv.postAuthRevokeHandler))
+	srv.handle(mux, "GET /.well-known/jwks.json", http.HandlerFunc(srv.getJWKSHandler))
+
+	srv.handle(mux, "POST /tokens", srv.requireSession(http.HandlerFunc(srv.postTokenHandler)))
+	srv.handle(mux, "GET /tokens", srv.requireSession(http.HandlerFunc(srv.getTokensHandler)))
+	srv.handle(mux, "DELETE /tokens/{id}", srv.requireSession(http.HandlerFunc(srv.deleteTokenHandler)))
+
+	srv.handle(mux, "POST /webhooks", srv.requireSession(http.HandlerFunc(srv.postWebhookHandler)))
+	srv.handle(mux, "GET /webhooks", srv.requireSession(http.HandlerFunc(srv.getWebhooksHandler)))
+	srv.handle(mux, "DELETE /webhooks/{id}", srv.requireSession(http.HandlerFunc(srv.deleteWebhookHandler)))
+	srv.handle(mux, "GET /webhooks/{id}/deliveries", srv.requireSession(http.HandlerFunc(srv.getDeliveriesHandler)))
+	srv.handle(mux, "POST /webhooks/{id}/deliveries/{delivery}/redeliver", srv.requireSession(http.HandlerFunc(srv.redeliverHandler)))
+
+	srv.handle(mux, "GET /workspace", srv.requireScope(auth.ScopeTodosRead, http.HandlerFunc(srv.getWorkspaceHandler)))
+
+	srv.handle(mux, "GET /lists", srv.requireScope(auth.ScopeTodosRead, http.HandlerFunc(srv.getListsHandler)))
+	srv.handle(mux, "GET /lists/{list}/shares", srv.requireSession(http.HandlerFunc(srv.getSharesHandler)))
+	srv.handle(mux, "PUT /lists/{list}/shares", srv.requireSession(http.HandlerFunc(srv.putShareHandler)))
+	srv.handle(mux, "DELETE /lists/{list}/shares/{id}", srv.requireSession(http.HandlerFunc(srv.deleteShareHandler)))
+
+	// mutations of /graphql check for todos:write themselves
+	srv.handle(mux, "POST /graphql", srv.requireScope(auth.ScopeTodosRead, srv.graphqlHandler(newGraphQLSchema(srv))))
+
+	srv.handle(mux, "GET /events", srv.requireScope(auth.ScopeTodosRead, http.HandlerFunc(srv.eventsHandler)))
+	// updates sent on the websocket check for todos:write themselves
+	srv.handle(mux, "GET /lists/{list}/live", srv.requireScope(auth.ScopeTodosRead, http.HandlerFunc(srv.liveHandler)))
+
+	srv.handle(mux, "GET /", srv.requireScope(auth.ScopeTodosRead, http.HandlerFunc(srv.getHandler)))
+	srv.handle(mux, "POST /", srv.requireScope(auth.ScopeTodosWrite, http.HandlerFunc(srv.postHandler)))
+	srv.handle(mux, "PUT /update", srv.requireScope(auth.ScopeTodosWrite, http.HandlerFunc(srv.putHandler)))
+	srv.handle(mux, "DELETE /delete/{id}", srv.requireScope(auth.ScopeTodosWrite, http.HandlerFunc(srv.deleteHandler)))
+
+	// probes, scrapes and the api docs skip authentication, rate limits and workspaces, none of them should fail them
+	root := http.NewServeMux()
+	srv.handle(root, "GET /healthz", http.HandlerFunc(srv.healthzHandler))
+	srv.handle(root, "GET /livez", http.HandlerFunc(srv.healthzHandler))
+	srv.handle(root, "GET /readyz", http.HandlerFunc(srv.readyzHandler))
+	srv.handle(root, "GET /metrics", srv.metricsHandler())
+	srv.handle(root, "GET /openapi.json", http.HandlerFunc(srv.openAPIHandler))
+	srv.handle(root, "GET /docs", http.HandlerFunc(srv.docsHandler))
+	// grpc calls authenticate in the interceptors of newGRPCServer, they aren't part of the openapi document
+	grpcHandler := srv.grpcHandler(newGRPCServer(srv))
+	for _, route := range grpcRoutes() {
+		root.Handle(route, grpcHandler)
+	}
+	root.Handle("/", srv.limitBody(srv.authenticate(srv.rateLimit(srv.resolveWorkspace(mux)))))
 
-	srv.Handler = mux
+	srv.root, srv.routes = root, mux
+	srv.Handler = srv.trace(srv.logRequests(srv.instrument(root)))
 	return srv
 }
 
+// Routes lists the pattern of every route served, "GET /tokens" and the like.
+func (s *Server) Routes() []string {
+	return slices.Clone(s.patterns)
+}
+
+// handle registers handler on mux and remembers pattern for Routes.
+func (s *Server) handle(mux *http.ServeMux, pattern string, handler http.Handler) {
+	mux.Handle(pattern, handler)
+	s.patterns = append(s.patterns, pattern)
+}
+
 func (s *Server) getHandler(w http.ResponseWriter, r *http.Request) {
-	todos, err := s.store.GetTodos()
+	listId, err := s.extractListIdFromRequestQuery(r)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	todos, err := s.store.GetTodos(r.Context(), user.Id, listId)
 	if err != nil {
-		s.logAndResponse(w, err, http.StatusInternalServerError)
+		switch err {
+		case db.PermissionDeniedErr:
+			s.permissionDenied(w, r, types.RoleViewer, listId)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
 		return
 	}
 
 	if err := s.responseInJSON(w, todos); err != nil {
-		s.logAndResponse(w, err, http.StatusInternalServerError)
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
 		return
 	}
 }
@@ -60,17 +309,32 @@ func (s *Server) getHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) postHandler(w http.ResponseWriter, r *http.Request) {
 	content, err := s.extractContentFromRequestBody(r)
 	if err != nil {
-		s.logAndResponse(w, err, http.StatusInternalServerError)
+		s.responseDecodeErr(w, r, err)
 		return
 	}
 
-	if !s.validContent(content) {
-		s.logAndResponse(w, errors.New(InvalidContentErrMsg), http.StatusBadRequest)
+	if err := ValidateContent(content); err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	if err := s.store.PostTodo(content); err != nil {
-		s.logAndResponse(w, err, http.StatusInternalServerError)
+	listId, err := s.extractListIdFromRequestQuery(r)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	if _, err := s.store.PostTodo(r.Context(), user.Id, listId, content); err != nil {
+		switch err {
+		case db.PermissionDeniedErr:
+			s.permissionDenied(w, r, types.RoleEditor, listId)
+		case db.TodoQuotaExceededErr:
+			s.forbidden(w, r, err.Error())
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -80,30 +344,31 @@ func (s *Server) postHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) putHandler(w http.ResponseWriter, r *http.Request) {
 	id, content, err := s.extractIdAndContentFromRequestBody(r)
 	if err != nil {
-		s.logAndResponse(w, err, http.StatusInternalServerError)
+		s.responseDecodeErr(w, r, err)
 		return
 	}
 
-	var validParamsErr error
-
-	switch {
-	case !s.validId(id):
-		validParamsErr = errors.New(InvalidIdErrMsg)
-	case !s.validContent(content):
-		validParamsErr = errors.New(InvalidContentErrMsg)
+	if err := ValidateUpdateTodo(types.UpdateTodo{Id: id, Content: content}); err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
 	}
 
-	if validParamsErr != nil {
-		s.logAndResponse(w, validParamsErr, http.StatusBadRequest)
+	listId, err := s.extractListIdFromRequestQuery(r)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	if err := s.store.UpdateTodo(id, content); err != nil {
+	user := userFromContext(r.Context())
+
+	if _, err := s.store.UpdateTodo(r.Context(), user.Id, listId, id, content); err != nil {
 		switch err {
+		case db.PermissionDeniedErr:
+			s.permissionDenied(w, r, types.RoleEditor, listId)
 		case db.UpdatedIdNotExistErr:
-			s.logAndResponse(w, err, http.StatusBadRequest)
+			s.logAndResponse(w, r, err, http.StatusBadRequest)
 		default:
-			s.logAndResponse(w, err, http.StatusInternalServerError)
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
 		}
 		return
 	}
@@ -114,21 +379,31 @@ func (s *Server) putHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) deleteHandler(w http.ResponseWriter, r *http.Request) {
 	deleteId, err := s.extractIdFromRequestPath(r)
 	if err != nil {
-		s.logAndResponse(w, err, http.StatusInternalServerError)
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
 	if !s.validId(deleteId) {
-		s.logAndResponse(w, errors.New(InvalidIdErrMsg), http.StatusBadRequest)
+		s.logAndResponse(w, r, errors.New(InvalidIdErrMsg), http.StatusBadRequest)
+		return
+	}
+
+	listId, err := s.extractListIdFromRequestQuery(r)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	if err := s.store.DeleteTodo(deleteId); err != nil {
+	user := userFromContext(r.Context())
+
+	if err := s.store.DeleteTodo(r.Context(), user.Id, listId, deleteId); err != nil {
 		switch err {
+		case db.PermissionDeniedErr:
+			s.permissionDenied(w, r, types.RoleEditor, listId)
 		case db.DeleteIdNotExistErr:
-			s.logAndResponse(w, err, http.StatusBadRequest)
+			s.logAndResponse(w, r, err, http.StatusBadRequest)
 		default:
-			s.logAndResponse(w, err, http.StatusInternalServerError)
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
 		}
 		return
 	}
@@ -136,15 +411,42 @@ func (s *Server) deleteHandler(w http.ResponseWriter, r *http.Request) {
 	s.dbExecuteSuccess(w, "delete todo")
 }
 
-func (s *Server) logAndResponse(w http.ResponseWriter, err error, code int) {
+// logAndResponse writes err as a plain text body, followed by the request id on its own line.
+func (s *Server) logAndResponse(w http.ResponseWriter, r *http.Request, err error, code int) {
 	errMsg := err.Error()
-	log.Println(errMsg)
+
+	level := slog.LevelWarn
+	if code >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	logging.FromContext(r.Context()).Log(r.Context(), level, errMsg, "status", code)
+
+	if requestId, ok := logging.RequestIdFromContext(r.Context()); ok {
+		errMsg = fmt.Sprintf("%s\nRequest id: %s", errMsg, requestId)
+	}
 	http.Error(w, errMsg, code)
 }
 
+// responseDecodeErr tells bodies cut off by the size limit apart from bodies not matching their endpoint.
+func (s *Server) responseDecodeErr(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		s.logAndResponse(w, r, errors.New(RequestTooLargeErrMsg), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var invalidBodyErr bodyErr
+	if errors.As(err, &invalidBodyErr) {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	s.logAndResponse(w, r, err, http.StatusInternalServerError)
+}
+
 func (s *Server) extractIdAndContentFromRequestBody(r *http.Request) (int, string, error) {
 	var updateTodo types.UpdateTodo
-	err := json.NewDecoder(r.Body).Decode(&updateTodo)
+	err := decodeBody(r, &updateTodo)
 	if err != nil {
 		return 0, "", err
 	}
@@ -154,7 +456,7 @@ func (s *Server) extractIdAndContentFromRequestBody(r *http.Request) (int, strin
 
 func (s *Server) extractContentFromRequestBody(r *http.Request) (string, error) {
 	var newTodo types.NewTodo
-	err := json.NewDecoder(r.Body).Decode(&newTodo)
+	err := decodeBody(r, &newTodo)
 	if err != nil {
 		return "", err
 	}
@@ -171,12 +473,29 @@ func (s *Server) extractIdFromRequestPath(r *http.Request) (int, error) {
 	return deleteId, nil
 }
 
+// extractListIdFromRequestQuery defaults to the list of the authenticated user.
+func (s *Server) extractListIdFromRequestQuery(r *http.Request) (int, error) {
+	list := r.URL.Query().Get("list")
+	if list == "" {
+		return userFromContext(r.Context()).Id, nil
+	}
+
+	listId, err := strconv.Atoi(list)
+	if err != nil || !s.validId(listId) {
+		return 0, errors.New(InvalidListIdErrMsg)
+	}
+
+	return listId, nil
+}
+
 func (s *Server) responseInJSON(w http.ResponseWriter, v any) error {
 	byte, err := json.MarshalIndent(v, "", "    ")
 	if err != nil {
 		return fmt.Errorf("problem marshal indent format JSON, %v", err)
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+
 	_, err = w.Write(byte)
 	if err != nil {
 		return fmt.Errorf("problem writing json response, %v", err)
@@ -193,6 +512,27 @@ func (s *Server) validId(id int) bool {
 	return id > 0
 }
 
-func (s *Server) validContent(content string) bool {
+// ValidateContent checks the content of a todo is neither empty nor over MaxContentLength.
+func ValidateContent(content string) error {
+	switch {
+	case !validContent(content):
+		return errors.New(InvalidContentErrMsg)
+	case utf8.RuneCountInString(content) > MaxContentLength:
+		return fmt.Errorf("%s Content can't be longer than %d characters.", InvalidContentErrMsg, MaxContentLength)
+	}
+
+	return nil
+}
+
+// ValidateUpdateTodo checks the id and content of a todo about to be updated.
+func ValidateUpdateTodo(updateTodo types.UpdateTodo) error {
+	if updateTodo.Id <= 0 {
+		return errors.New(InvalidIdErrMsg)
+	}
+
+	return ValidateContent(updateTodo.Content)
+}
+
+func validContent(content string) bool {
 	return len(content) > 0
 }
@@ -0,0 +1,51 @@
+package server
+
+import "strings"
+
+// Settings are the settings of a server which Reload may change while it serves, the options
+// of the same name set them at start.
+type Settings struct {
+	// BaseDomain resolves workspaces from its subdomains, see WithBaseDomain
+	BaseDomain   string
+	MaxBodyBytes int64
+	// RateLimit throttles requests to RateLimitBurst refilled at RateLimitRate per second, see WithRateLimit
+	RateLimit      bool
+	RateLimitRate  float64
+	RateLimitBurst int
+	TrustProxy     bool
+}
+
+// WithSettings sets every reloadable setting at once.
+func WithSettings(settings Settings) Option {
+	return func(s *Server) {
+		settings.BaseDomain = normalizeBaseDomain(settings.BaseDomain)
+		*s.initialSettings() = settings
+	}
+}
+
+// Reload applies settings to the requests which follow, in-flight requests finish with the
+// settings they started with. Rate limit buckets, metrics and subscribers are kept.
+//
+// gRPC messages can't grow past the body size limit the server was created with.
+func (s *Server) Reload(settings Settings) {
+	settings.BaseDomain = normalizeBaseDomain(settings.BaseDomain)
+	if settings.RateLimit {
+		s.limiter.SetLimit(settings.RateLimitRate, settings.RateLimitBurst)
+		s.authLimiter.SetLimit(settings.RateLimitRate, settings.RateLimitBurst)
+	}
+	s.settings.Store(&settings)
+}
+
+// Settings returns the settings in effect.
+func (s *Server) Settings() Settings {
+	return *s.settings.Load()
+}
+
+// initialSettings are changed in place by the options, nobody else sees them before New returns.
+func (s *Server) initialSettings() *Settings {
+	return s.settings.Load()
+}
+
+func normalizeBaseDomain(baseDomain string) string {
+	return strings.ToLower(strings.TrimPrefix(baseDomain, "."))
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/types"
+)
+
+func (s *Server) getListsHandler(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	lists, err := s.store.GetLists(r.Context(), user.Id)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.responseInJSON(w, lists); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) getSharesHandler(w http.ResponseWriter, r *http.Request) {
+	listId, err := s.extractListIdFromRequestPath(r)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	shares, err := s.store.GetShares(r.Context(), user.Id, listId)
+	if err != nil {
+		switch err {
+		case db.PermissionDeniedErr:
+			s.permissionDenied(w, r, types.RoleAdmin, listId)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := s.responseInJSON(w, shares); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) putShareHandler(w http.ResponseWriter, r *http.Request) {
+	listId, err := s.extractListIdFromRequestPath(r)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	newShare, err := s.extractNewShareFromRequestBody(r)
+	if err != nil {
+		s.responseDecodeErr(w, r, err)
+		return
+	}
+
+	if !s.validRole(newShare.Role) {
+		s.logAndResponse(w, r, errors.New(InvalidRoleErrMsg), http.StatusBadRequest)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	share, err := s.store.PutShare(r.Context(), user.Id, listId, newShare)
+	if err != nil {
+		switch err {
+		case db.PermissionDeniedErr:
+			s.permissionDenied(w, r, types.RoleAdmin, listId)
+		case db.UserNotExistErr, db.ShareWithOwnerErr:
+			s.logAndResponse(w, r, err, http.StatusBadRequest)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := s.responseInJSON(w, share); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) deleteShareHandler(w http.ResponseWriter, r *http.Request) {
+	listId, err := s.extractListIdFromRequestPath(r)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	shareUserId, err := s.extractIdFromRequestPath(r)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !s.validId(shareUserId) {
+		s.logAndResponse(w, r, errors.New(InvalidIdErrMsg), http.StatusBadRequest)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	if err := s.store.DeleteShare(r.Context(), user.Id, listId, shareUserId); err != nil {
+		switch err {
+		case db.PermissionDeniedErr:
+			s.permissionDenied(w, r, types.RoleAdmin, listId)
+		case db.DeletedShareNotExistErr:
+			s.logAndResponse(w, r, err, http.StatusBadRequest)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	workspaceId, _ := db.WorkspaceFromContext(r.Context())
+	s.live.revoke(r.Context(), workspaceId, listId, shareUserId)
+
+	s.dbExecuteSuccess(w, "delete share")
+}
+
+func (s *Server) extractListIdFromRequestPath(r *http.Request) (int, error) {
+	listId, err := strconv.Atoi(r.PathValue("list"))
+	if err != nil || !s.validId(listId) {
+		return 0, errors.New(InvalidListIdErrMsg)
+	}
+
+	return listId, nil
+}
+
+func (s *Server) extractNewShareFromRequestBody(r *http.Request) (types.NewShare, error) {
+	var newShare types.NewShare
+	err := decodeBody(r, &newShare)
+	if err != nil {
+		return types.NewShare{}, err
+	}
+
+	return newShare, nil
+}
+
+func (s *Server) validRole(role types.Role) bool {
+	switch role {
+	case types.RoleViewer, types.RoleEditor, types.RoleAdmin:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/types"
+)
+
+const maxTokenNameLen = 50
+
+func (s *Server) postTokenHandler(w http.ResponseWriter, r *http.Request) {
+	newToken, err := s.extractNewTokenFromRequestBody(r)
+	if err != nil {
+		s.responseDecodeErr(w, r, err)
+		return
+	}
+
+	if err := ValidateNewToken(newToken); err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	if newToken.Workspace != nil {
+		if _, err := s.store.GetMemberWorkspace(r.Context(), user.Id, *newToken.Workspace); err != nil {
+			switch err {
+			case db.WorkspaceNotExistErr:
+				s.logAndResponse(w, r, err, http.StatusBadRequest)
+			case db.NotWorkspaceMemberErr:
+				s.forbidden(w, r, err.Error())
+			default:
+				s.logAndResponse(w, r, err, http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	secret, err := auth.NewAccessToken()
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	token, err := s.store.CreateToken(r.Context(), user.Id, auth.HashToken(secret), newToken)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.responseInJSON(w, types.CreatedToken{Token: token, Secret: secret}); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) getTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	tokens, err := s.store.GetTokens(r.Context(), user.Id)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.responseInJSON(w, tokens); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) deleteTokenHandler(w http.ResponseWriter, r *http.Request) {
+	revokeId, err := s.extractIdFromRequestPath(r)
+	if err != nil || !s.validId(revokeId) {
+		s.logAndResponse(w, r, errors.New(InvalidIdErrMsg), http.StatusBadRequest)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	if err := s.store.RevokeToken(r.Context(), user.Id, revokeId); err != nil {
+		switch err {
+		case db.RevokedIdNotExistErr:
+			s.logAndResponse(w, r, err, http.StatusBadRequest)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.dbExecuteSuccess(w, "revoke token")
+}
+
+func (s *Server) extractNewTokenFromRequestBody(r *http.Request) (types.NewToken, error) {
+	var newToken types.NewToken
+	err := decodeBody(r, &newToken)
+	if err != nil {
+		return types.NewToken{}, err
+	}
+
+	return newToken, nil
+}
+
+// ValidateNewToken checks the name, scopes and expiry of a token about to be created, not its workspace.
+func ValidateNewToken(newToken types.NewToken) error {
+	switch {
+	case !validTokenName(newToken.Name):
+		return errors.New(InvalidTokenNameErrMsg)
+	case !validScopes(newToken.Scopes):
+		return errors.New(InvalidScopesErrMsg)
+	case !validExpiresAt(newToken.ExpiresAt):
+		return errors.New(InvalidExpiresAtErrMsg)
+	}
+
+	return nil
+}
+
+func validTokenName(name string) bool {
+	return len(name) > 0 && len(name) <= maxTokenNameLen
+}
+
+func validScopes(scopes []string) bool {
+	if len(scopes) == 0 {
+		return false
+	}
+
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validExpiresAt allows tokens without expiry, but not ones which are already expired.
+func validExpiresAt(expiresAt *time.Time) bool {
+	return expiresAt == nil || expiresAt.After(time.Now())
+}
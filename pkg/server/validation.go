@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const InvalidBodyErrMsg = "Invalid request body!"
+
+// bodyErr is a request body which doesn't match the type of its endpoint, detail names the
+// offending field when there is one.
+type bodyErr struct {
+	detail string
+}
+
+func (e bodyErr) Error() string {
+	return InvalidBodyErrMsg + " " + e.detail
+}
+
+// decodeBody decodes the json body of r into v, refusing fields v doesn't have, values of the
+// wrong type and anything after the json value. Errors other than *http.MaxBytesError are bodyErr.
+func decodeBody(r *http.Request, v any) error {
+	return decodeJSON(r.Body, v)
+}
+
+// decodeJSON is decodeBody for the messages of websockets.
+func decodeJSON(reader io.Reader, v any) error {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return decodeErr(err, v)
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return err
+		}
+		return bodyErr{"Unexpected data after the JSON value."}
+	}
+
+	return nil
+}
+
+func decodeErr(err error, v any) error {
+	var (
+		maxBytesErr *http.MaxBytesError
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+		timeErr     *time.ParseError
+	)
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return err
+	case errors.Is(err, io.EOF):
+		return bodyErr{fmt.Sprintf("Expected a JSON %s.", jsonType(reflect.TypeOf(v)))}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return bodyErr{"Malformed JSON, unexpected end of body."}
+	case errors.As(err, &syntaxErr):
+		return bodyErr{fmt.Sprintf("Malformed JSON at offset %d.", syntaxErr.Offset)}
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		return bodyErr{fmt.Sprintf("Expected a JSON %s, got %s.", jsonType(typeErr.Type), typeErr.Value)}
+	case errors.As(err, &typeErr):
+		return bodyErr{fmt.Sprintf("Field %q must be %s, got %s.", typeErr.Field, withArticle(jsonType(typeErr.Type)), typeErr.Value)}
+	case errors.As(err, &timeErr):
+		return bodyErr{fmt.Sprintf("Malformed date-time %q, expected RFC 3339.", strings.Trim(timeErr.Value, `"`))}
+	}
+
+	// encoding/json has no error type for unknown fields, only its message tells them apart
+	if _, field, ok := strings.Cut(err.Error(), "json: unknown field "); ok {
+		return bodyErr{fmt.Sprintf("Unknown field %s.", field)}
+	}
+
+	return bodyErr{strings.TrimPrefix(err.Error(), "json: ") + "."}
+}
+
+// jsonType names t the way the openapi document does.
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return "date-time string"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+
+	return "object"
+}
+
+func withArticle(noun string) string {
+	if strings.ContainsRune("aeiou", rune(noun[0])) {
+		return "an " + noun
+	}
+
+	return "a " + noun
+}
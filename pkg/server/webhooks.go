@@ -0,0 +1,189 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/types"
+)
+
+const (
+	InvalidWebhookUrlErrMsg    = "Invalid webhook url!"
+	InvalidWebhookEventsErrMsg = "Invalid webhook events!"
+
+	maxWebhookUrlLen = 2048
+)
+
+// webhookEvents are the events webhooks subscribe to, all of them when they don't say.
+var webhookEvents = []types.EventType{types.EventTodoCreated, types.EventTodoUpdated, types.EventTodoDeleted}
+
+func (s *Server) postWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var newWebhook types.NewWebhook
+	if err := decodeBody(r, &newWebhook); err != nil {
+		s.responseDecodeErr(w, r, err)
+		return
+	}
+
+	if err := ValidateNewWebhook(newWebhook); err != nil {
+		s.logAndResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if len(newWebhook.Events) == 0 {
+		newWebhook.Events = webhookEvents
+	}
+	newWebhook.Events = slices.Clone(newWebhook.Events)
+	slices.Sort(newWebhook.Events)
+	newWebhook.Events = slices.Compact(newWebhook.Events)
+
+	secret, err := auth.NewToken()
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	webhook, err := s.store.CreateWebhook(r.Context(), user.Id, newWebhook, secret)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.responseInJSON(w, types.CreatedWebhook{Webhook: webhook, Secret: secret}); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	user := userFromContext(r.Context())
+
+	webhooks, err := s.store.GetWebhooks(r.Context(), user.Id)
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.responseInJSON(w, webhooks); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || !s.validId(id) {
+		s.logAndResponse(w, r, errors.New(InvalidIdErrMsg), http.StatusBadRequest)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	if err := s.store.DeleteWebhook(r.Context(), user.Id, id); err != nil {
+		switch err {
+		case db.WebhookNotExistErr:
+			s.logAndResponse(w, r, err, http.StatusBadRequest)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s.dbExecuteSuccess(w, "delete webhook")
+}
+
+func (s *Server) getDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhookId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || !s.validId(webhookId) {
+		s.logAndResponse(w, r, errors.New(InvalidIdErrMsg), http.StatusBadRequest)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	deliveries, err := s.store.GetDeliveries(r.Context(), user.Id, webhookId)
+	if err != nil {
+		switch err {
+		case db.WebhookNotExistErr:
+			s.logAndResponse(w, r, err, http.StatusBadRequest)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := s.responseInJSON(w, deliveries); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// redeliverHandler queues the payload of a delivery again, the new delivery is returned pending.
+func (s *Server) redeliverHandler(w http.ResponseWriter, r *http.Request) {
+	webhookId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || !s.validId(webhookId) {
+		s.logAndResponse(w, r, errors.New(InvalidIdErrMsg), http.StatusBadRequest)
+		return
+	}
+
+	deliveryId, err := strconv.ParseInt(r.PathValue("delivery"), 10, 64)
+	if err != nil || deliveryId <= 0 {
+		s.logAndResponse(w, r, errors.New(InvalidIdErrMsg), http.StatusBadRequest)
+		return
+	}
+
+	user := userFromContext(r.Context())
+
+	delivery, err := s.store.Redeliver(r.Context(), user.Id, webhookId, deliveryId)
+	if err != nil {
+		switch err {
+		case db.DeliveryNotExistErr:
+			s.logAndResponse(w, r, err, http.StatusBadRequest)
+		default:
+			s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := s.responseInJSON(w, delivery); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// ValidateNewWebhook checks the url and events of a webhook about to be created.
+func ValidateNewWebhook(newWebhook types.NewWebhook) error {
+	switch {
+	case !validWebhookUrl(newWebhook.Url):
+		return errors.New(InvalidWebhookUrlErrMsg)
+	case !validWebhookEvents(newWebhook.Events):
+		return errors.New(InvalidWebhookEventsErrMsg)
+	}
+
+	return nil
+}
+
+func validWebhookUrl(rawUrl string) bool {
+	if len(rawUrl) > maxWebhookUrlLen {
+		return false
+	}
+
+	u, err := url.Parse(rawUrl)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil
+}
+
+func validWebhookEvents(events []types.EventType) bool {
+	for _, event := range events {
+		if !slices.Contains(webhookEvents, event) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/types"
+)
+
+const workspaceHeader = "X-Workspace"
+
+// resolveWorkspace attaches the workspace of the request to its context. A workspace bound to the
+// personal access token wins, then the X-Workspace header, then the subdomain of the base domain,
+// then the default workspace. Users only reach the workspaces they are members of.
+func (s *Server) resolveWorkspace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		workspace, err := s.workspaceFor(r.Context(), s.extractWorkspaceFromRequest(r))
+		if err != nil {
+			var boundErr workspaceBoundErr
+			switch {
+			case errors.As(err, &boundErr), err == db.NotWorkspaceMemberErr:
+				s.forbidden(w, r, err.Error())
+			case err == db.WorkspaceNotExistErr:
+				s.logAndResponse(w, r, err, http.StatusBadRequest)
+			default:
+				s.logAndResponse(w, r, err, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ctx := db.WithWorkspace(r.Context(), workspace.Id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// workspaceBoundErr is a request for another workspace than the one its token is bound to.
+type workspaceBoundErr string
+
+func (e workspaceBoundErr) Error() string {
+	return fmt.Sprintf("Token is bound to workspace %s!", string(e))
+}
+
+// workspaceFor is the workspace of a request asking for slug, empty for the default workspace,
+// made by the principal in ctx.
+func (s *Server) workspaceFor(ctx context.Context, slug string) (types.Workspace, error) {
+	p, ok := principalFromContext(ctx)
+	if ok && p.workspace != nil {
+		if slug != "" && slug != *p.workspace {
+			return types.Workspace{}, workspaceBoundErr(*p.workspace)
+		}
+		slug = *p.workspace
+	}
+
+	if slug == "" {
+		slug = db.DefaultWorkspace
+	}
+
+	if ok {
+		return s.store.GetMemberWorkspace(ctx, p.user.Id, slug)
+	}
+
+	return s.store.GetWorkspaceBySlug(ctx, slug)
+}
+
+func (s *Server) getWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, err := s.store.GetWorkspace(r.Context())
+	if err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.responseInJSON(w, workspace); err != nil {
+		s.logAndResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) extractWorkspaceFromRequest(r *http.Request) string {
+	if slug := r.Header.Get(workspaceHeader); slug != "" {
+		return slug
+	}
+
+	baseDomain := s.Settings().BaseDomain
+	if baseDomain == "" {
+		return ""
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	subdomain, ok := strings.CutSuffix(strings.ToLower(host), "."+baseDomain)
+	if !ok || strings.Contains(subdomain, ".") {
+		return ""
+	}
+
+	return subdomain
+}
@@ -0,0 +1,237 @@
+// Package webhook sends the deliveries queued in the outbox of the store by todo mutations to
+// the webhooks of users, signed with the secret of the webhook.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorgemul/todos/types"
+)
+
+const (
+	// SignatureHeader is the hex HMAC-SHA256 of the body keyed by the secret of the webhook, as sha256=<hex>
+	SignatureHeader = "X-Todos-Signature-256"
+	EventHeader     = "X-Todos-Event"
+	// DeliveryHeader is the id of the delivery, the same for every attempt of it
+	DeliveryHeader = "X-Todos-Delivery"
+
+	// PollInterval is how often the outbox is checked for deliveries which are due
+	PollInterval = time.Second
+	// MaxAttempts is how many times a delivery is attempted before it fails for good
+	MaxAttempts = 8
+	// RetryBase is the delay before the second attempt, every retry waits twice as long as the one before
+	RetryBase = 10 * time.Second
+	// Timeout bounds an attempt, receivers should answer quickly and do their work afterwards
+	Timeout = 10 * time.Second
+
+	// lease keeps other dispatchers off a claimed delivery for longer than its attempt takes
+	lease     = 3 * Timeout
+	batchSize = 20
+	// maxResponseBytes of the answer of a receiver are read so the connection can be reused
+	maxResponseBytes = 64 << 10
+)
+
+type Store interface {
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]types.PendingDelivery, error)
+	RecordAttempt(ctx context.Context, attempt types.DeliveryAttempt) error
+}
+
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	logger *slog.Logger
+	// allowed are the networks of local receivers which may be dialed anyway
+	allowed []netip.Prefix
+}
+
+type Option func(*Dispatcher)
+
+// WithAllowedNetworks lets deliveries reach receivers in the networks, which are refused by
+// default for being loopback, private, link-local or unspecified addresses.
+func WithAllowedNetworks(prefixes ...netip.Prefix) Option {
+	return func(d *Dispatcher) {
+		d.allowed = append(d.allowed, prefixes...)
+	}
+}
+
+func NewDispatcher(store Store, logger *slog.Logger, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		store:  store,
+		logger: logger,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	// the address is checked as it is dialed rather than when the webhook is registered, so a
+	// name resolving to a public address then to a local one can't reach the local one. Proxies
+	// would dial on our behalf, unchecked, so they aren't used.
+	dialer := &net.Dialer{Timeout: Timeout, Control: d.control}
+	d.client = &http.Client{
+		Timeout: Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: Timeout,
+			IdleConnTimeout:     90 * time.Second,
+			MaxIdleConns:        100,
+		},
+	}
+
+	return d
+}
+
+// control refuses to connect to local addresses unless their network is allowed.
+func (d *Dispatcher) control(network, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr := addrPort.Addr().Unmap()
+	if slices.ContainsFunc(d.allowed, func(prefix netip.Prefix) bool { return prefix.Contains(addr) }) {
+		return nil
+	}
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsUnspecified() {
+		return fmt.Errorf("Receiver address %s is not allowed!", addr)
+	}
+
+	return nil
+}
+
+// Run dispatches every interval until ctx is done. A pass which fails is logged, its deliveries
+// are claimed again once their lease runs out.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := d.Dispatch(ctx); err != nil && ctx.Err() == nil {
+				d.logger.Error(fmt.Sprintf("problem dispatching webhooks, %v", err))
+			}
+		}
+	}
+}
+
+// Dispatch attempts the deliveries which are due concurrently and returns how many it attempted.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	deliveries, err := d.store.ClaimDeliveries(ctx, batchSize, lease)
+	if err != nil {
+		return 0, fmt.Errorf("problem claiming deliveries, %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(deliveries))
+
+	for i, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			attempt := d.attempt(ctx, delivery)
+			// attempts cut short by a shutdown are left to the lease
+			if ctx.Err() != nil {
+				return
+			}
+			if err := d.store.RecordAttempt(ctx, attempt); err != nil {
+				errs[i] = fmt.Errorf("problem recording delivery %d, %v", delivery.Id, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return len(deliveries), errors.Join(errs...)
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery types.PendingDelivery) types.DeliveryAttempt {
+	attempt := types.DeliveryAttempt{DeliveryId: delivery.Id, WorkspaceId: delivery.WorkspaceId, Status: types.DeliveryDelivered}
+
+	statusCode, err := d.send(ctx, delivery)
+	if statusCode != 0 {
+		attempt.ResponseStatus = &statusCode
+	}
+	if err == nil {
+		return attempt
+	}
+
+	attempt.Error = err.Error()
+	d.logger.Warn(fmt.Sprintf("problem delivering %d, %v", delivery.Id, err), "attempt", delivery.Attempts)
+
+	if delivery.Attempts >= MaxAttempts {
+		attempt.Status = types.DeliveryFailed
+		return attempt
+	}
+
+	attempt.Status = types.DeliveryPending
+	attempt.RetryIn = Backoff(delivery.Attempts)
+	return attempt
+}
+
+// send returns the status the receiver answered, 0 when it didn't.
+func (d *Dispatcher) send(ctx context.Context, delivery types.PendingDelivery) (int, error) {
+	body, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		return 0, fmt.Errorf("problem marshal payload, %v", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "todos-webhook")
+	request.Header.Set(EventHeader, string(delivery.Payload.Type))
+	request.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.Id, 10))
+	request.Header.Set(SignatureHeader, Sign(delivery.Secret, body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseBytes))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("Receiver answered %s!", response.Status)
+	}
+
+	return response.StatusCode, nil
+}
+
+// Backoff is how long a delivery waits after its attempt-th attempt failed.
+func Backoff(attempt int) time.Duration {
+	return RetryBase << (attempt - 1)
+}
+
+// Sign is the SignatureHeader of body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify tells whether signature is the SignatureHeader of body, for receivers written in go.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
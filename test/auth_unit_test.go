@@ -0,0 +1,176 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestRegister(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		store := new(stubStore)
+		srv := server.New(store)
+
+		response := register(t, srv, types.Credentials{Username: "alice", Password: "correct horse"})
+
+		assertStatus(t, response.Code, http.StatusOK)
+		_, err := store.GetUserByUsername(context.Background(), "alice")
+		assertNoErr(t, err)
+	})
+	t.Run("password is stored hashed", func(t *testing.T) {
+		store := new(stubStore)
+		srv := server.New(store)
+
+		register(t, srv, types.Credentials{Username: "alice", Password: "correct horse"})
+
+		user, err := store.GetUserByUsername(context.Background(), "alice")
+		assertNoErr(t, err)
+		if user.PasswordHash == "correct horse" {
+			t.Fatalf("password stored in plain text")
+		}
+	})
+	t.Run("username already taken", func(t *testing.T) {
+		store := new(stubStore)
+		srv := server.New(store)
+
+		register(t, srv, types.Credentials{Username: "alice", Password: "correct horse"})
+		response := register(t, srv, types.Credentials{Username: "alice", Password: "another horse"})
+
+		assertStatus(t, response.Code, http.StatusConflict)
+		assertErrMsg(t, response.Body.String(), db.UsernameTakenErr.Error())
+	})
+	t.Run("too short username", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+
+		response := register(t, srv, types.Credentials{Username: "al", Password: "correct horse"})
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+		assertErrMsg(t, response.Body.String(), server.InvalidUsernameErrMsg)
+	})
+	t.Run("too short password", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+
+		response := register(t, srv, types.Credentials{Username: "alice", Password: "short"})
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+		assertErrMsg(t, response.Body.String(), server.InvalidPasswordErrMsg)
+	})
+}
+
+func TestLogin(t *testing.T) {
+	credentials := types.Credentials{Username: "alice", Password: "correct horse"}
+
+	t.Run("login and use session token", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		srv := server.New(store)
+		register(t, srv, credentials)
+
+		response := login(t, srv, credentials)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var session types.Session
+		err := json.NewDecoder(response.Body).Decode(&session)
+		assertNoErr(t, err)
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		authorize(request, session.Token)
+		response = httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		user, err := store.GetUserByUsername(context.Background(), "alice")
+		assertNoErr(t, err)
+		assertTodo(t, store.userId, user.Id)
+	})
+	t.Run("wrong password", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+		register(t, srv, credentials)
+
+		response := login(t, srv, types.Credentials{Username: "alice", Password: "wrong horse"})
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrMsg(t, response.Body.String(), server.InvalidCredentialsErrMsg)
+	})
+	t.Run("unknown user", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+
+		response := login(t, srv, credentials)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrMsg(t, response.Body.String(), server.InvalidCredentialsErrMsg)
+	})
+}
+
+func TestUnauthorized(t *testing.T) {
+	t.Run("missing token", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		request.Header.Del("Authorization")
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrMsg(t, response.Body.String(), server.UnauthorizedErrMsg)
+	})
+	t.Run("unknown token", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		request, err := newDeleteTodoRequest(1)
+		assertNoErr(t, err)
+		authorize(request, "not-a-session")
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrMsg(t, response.Body.String(), server.UnauthorizedErrMsg)
+	})
+	t.Run("todos are scoped to the authenticated user", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		srv := server.New(store)
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, store.userId, dummyUser.Id)
+	})
+}
+
+func register(t *testing.T, srv *server.Server, credentials types.Credentials) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request, err := newRegisterRequest(newRequestBody(t, credentials))
+	assertNoErr(t, err)
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+
+	return response
+}
+
+func login(t *testing.T, srv *server.Server, credentials types.Credentials) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request, err := newLoginRequest(newRequestBody(t, credentials))
+	assertNoErr(t, err)
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+
+	return response
+}
@@ -0,0 +1,210 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/client"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestClient(t *testing.T) {
+	t.Run("lists, gets, creates, updates and deletes todos", func(t *testing.T) {
+		store := &stubStore{Todos: types.Todos{{Id: 1, Content: "foo", CreatedAt: dummyTime}}}
+		c := newTestClient(t, server.New(store))
+
+		todos, err := c.List(context.Background())
+		assertNoErr(t, err)
+		assertTodo(t, todos, store.Todos)
+
+		todo, err := c.Get(context.Background(), 1)
+		assertNoErr(t, err)
+		assertTodo(t, todo, store.Todos[0])
+
+		_, err = c.Get(context.Background(), 2)
+		assertTodo(t, err, client.TodoNotExistErr)
+
+		assertNoErr(t, c.Create(context.Background(), "buy milk"))
+		assertTodo(t, store.newTodo, types.NewTodo{Content: "buy milk"})
+
+		assertNoErr(t, c.Update(context.Background(), 1, "bar"))
+		assertTodo(t, store.Todos[0].Content, "bar")
+
+		assertNoErr(t, c.Delete(context.Background(), 1))
+		assertTodo(t, len(store.Todos), 0)
+	})
+
+	t.Run("acts on a shared list", func(t *testing.T) {
+		store := &stubStore{}
+		c := newTestClient(t, server.New(store), client.WithList(dummyUser.Id))
+
+		_, err := c.List(context.Background())
+		assertNoErr(t, err)
+		assertTodo(t, store.listId, dummyUser.Id)
+	})
+
+	t.Run("server errors match the errors of the store", func(t *testing.T) {
+		c := newTestClient(t, server.New(&stubStore{}))
+
+		err := c.Update(context.Background(), 3, "foo")
+		assertErrIs(t, err, db.UpdatedIdNotExistErr)
+
+		err = c.Delete(context.Background(), 3)
+		assertErrIs(t, err, db.DeleteIdNotExistErr)
+		if errors.Is(err, db.UpdatedIdNotExistErr) {
+			t.Error("a missing delete shouldn't match a missing update")
+		}
+
+		var clientErr *client.Error
+		if !errors.As(err, &clientErr) {
+			t.Fatalf("want a *client.Error, got %v", err)
+		}
+		assertTodo(t, clientErr.StatusCode, http.StatusBadRequest)
+		if clientErr.RequestId == "" {
+			t.Error("want the request id of the failed request")
+		}
+	})
+
+	t.Run("problem responses match by their detail", func(t *testing.T) {
+		c := newTestClient(t, server.New(&stubStore{}), client.WithList(42))
+
+		_, err := c.List(context.Background())
+		assertErrIs(t, err, db.PermissionDeniedErr)
+	})
+
+	t.Run("rejects invalid tokens", func(t *testing.T) {
+		c := newTestClient(t, server.New(&stubStore{}), client.WithToken("not a token"))
+
+		_, err := c.List(context.Background())
+
+		var clientErr *client.Error
+		if !errors.As(err, &clientErr) {
+			t.Fatalf("want a *client.Error, got %v", err)
+		}
+		assertTodo(t, clientErr.StatusCode, http.StatusUnauthorized)
+		assertTodo(t, clientErr.Message, server.UnauthorizedErrMsg)
+	})
+
+	t.Run("registers, logs in and mints tokens", func(t *testing.T) {
+		store := &stubStore{}
+		anonymous := newTestClient(t, server.New(store), client.WithToken(""))
+		credentials := types.Credentials{Username: "alice", Password: "correct horse"}
+
+		assertNoErr(t, anonymous.Register(context.Background(), credentials))
+		err := anonymous.Register(context.Background(), credentials)
+		assertErrIs(t, err, db.UsernameTakenErr)
+
+		session, err := anonymous.Login(context.Background(), credentials)
+		assertNoErr(t, err)
+
+		alice := newTestClient(t, server.New(store), client.WithToken(session.Token))
+		created, err := alice.CreateToken(context.Background(), types.NewToken{Name: "ci", Scopes: []string{"todos:read"}})
+		assertNoErr(t, err)
+
+		tokens, err := alice.Tokens(context.Background())
+		assertNoErr(t, err)
+		assertTodo(t, len(tokens), 1)
+
+		assertNoErr(t, alice.RevokeToken(context.Background(), created.Id))
+		err = alice.RevokeToken(context.Background(), created.Id)
+		assertErrIs(t, err, db.RevokedIdNotExistErr)
+	})
+
+	t.Run("reports failed readiness checks in the health", func(t *testing.T) {
+		c := newTestClient(t, server.New(&stubStore{pingErr: errors.New("connection refused")}))
+
+		health, err := c.Ready(context.Background())
+		assertNoErr(t, err)
+		assertTodo(t, health.Status, types.HealthFail)
+	})
+}
+
+func TestClientRetries(t *testing.T) {
+	// failing answers status for the first failures requests, then serves the api
+	failing := func(failures int, status int) (http.Handler, *atomic.Int32) {
+		attempts := new(atomic.Int32)
+		srv := server.New(&stubStore{})
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if int(attempts.Add(1)) <= failures {
+				w.Header().Set("Retry-After", "0")
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			srv.ServeHTTP(w, r)
+		}), attempts
+	}
+
+	t.Run("retries throttled requests", func(t *testing.T) {
+		handler, attempts := failing(2, http.StatusTooManyRequests)
+		c := newTestClient(t, handler)
+
+		assertNoErr(t, c.Create(context.Background(), "foo"))
+		assertTodo(t, attempts.Load(), int32(3))
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		handler, attempts := failing(5, http.StatusTooManyRequests)
+		c := newTestClient(t, handler, client.WithRetries(1))
+
+		_, err := c.List(context.Background())
+
+		var clientErr *client.Error
+		if !errors.As(err, &clientErr) {
+			t.Fatalf("want a *client.Error, got %v", err)
+		}
+		assertTodo(t, clientErr.StatusCode, http.StatusTooManyRequests)
+		assertTodo(t, attempts.Load(), int32(2))
+	})
+
+	t.Run("only retries gateway failures of requests safe to repeat", func(t *testing.T) {
+		handler, attempts := failing(1, http.StatusBadGateway)
+		c := newTestClient(t, handler)
+
+		err := c.Create(context.Background(), "foo")
+		assertTodo(t, err.(*client.Error).StatusCode, http.StatusBadGateway)
+		assertTodo(t, attempts.Load(), int32(1))
+
+		_, err = c.List(context.Background())
+		assertNoErr(t, err)
+		assertTodo(t, attempts.Load(), int32(2))
+	})
+
+	t.Run("times out every attempt", func(t *testing.T) {
+		slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		})
+		c := newTestClient(t, slow, client.WithTimeout(10*time.Millisecond), client.WithRetries(0))
+
+		_, err := c.List(context.Background())
+		assertErrIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func newTestClient(t *testing.T, handler http.Handler, options ...client.Option) *client.Client {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	c, err := client.New(ts.URL, append([]client.Option{client.WithToken(dummyToken)}, options...)...)
+	assertNoErr(t, err)
+	return c
+}
+
+func assertErrIs(t testing.TB, err, target error) {
+	t.Helper()
+
+	if !errors.Is(err, target) {
+		t.Fatalf("want an error matching %q, got %v", target, err)
+	}
+}
@@ -0,0 +1,193 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestEvents(t *testing.T) {
+	t.Run("streams the writes", func(t *testing.T) {
+		store := &stubStore{Todos: types.Todos{{Id: 1, Content: "foo", CreatedAt: dummyTime}}}
+		srv := server.New(store)
+		events := subscribeEvents(t, srv, "")
+
+		postTodo(t, srv, "buy milk")
+		event := events.next(t)
+		assertTodo(t, event.Type, types.EventTodoCreated)
+		assertTodo(t, event.TodoId, 2)
+		assertTodo(t, event.Content, "buy milk")
+		assertTodo(t, *event.UserId, dummyUser.Id)
+
+		request, err := newPutTodoRequest(newRequestBody(t, types.UpdateTodo{Id: 1, Content: "buy eggs"}))
+		assertNoErr(t, err)
+		srv.ServeHTTP(httptest.NewRecorder(), request)
+		event = events.next(t)
+		assertTodo(t, event.Type, types.EventTodoUpdated)
+		assertTodo(t, event.Content, "buy eggs")
+
+		request, err = newDeleteTodoRequest(1)
+		assertNoErr(t, err)
+		srv.ServeHTTP(httptest.NewRecorder(), request)
+		event = events.next(t)
+		assertTodo(t, event.Type, types.EventTodoDeleted)
+		assertTodo(t, event.TodoId, 1)
+	})
+	t.Run("resumes after Last-Event-ID", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+		postTodo(t, srv, "first")
+		postTodo(t, srv, "second")
+
+		events := subscribeEvents(t, srv, "1")
+
+		event := events.next(t)
+		assertTodo(t, event.Id, int64(2))
+		assertTodo(t, event.Content, "second")
+	})
+	t.Run("events committed by other servers wake the stream", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		// polling would only see the event after the stream timed out
+		srv := server.New(store, server.WithWatchInterval(time.Hour))
+		events := subscribeEvents(t, srv, "")
+
+		store.appendEvent(context.Background(), types.NewEvent{Type: types.EventTodoCreated, ListId: dummyUser.Id, UserId: 2, TodoId: 3, Content: "from elsewhere"})
+
+		event := events.next(t)
+		assertTodo(t, event.Content, "from elsewhere")
+	})
+	t.Run("failed writes aren't streamed", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		srv := server.New(store)
+
+		request, err := newPostTodoRequest(newRequestBody(t, types.NewTodo{Content: "not mine"}))
+		assertNoErr(t, err)
+		withList(request, 2)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusForbidden)
+		assertTodo(t, len(store.events), 0)
+	})
+	t.Run("only events of readable lists", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		srv := server.New(store)
+		store.appendEvent(context.Background(), types.NewEvent{Type: types.EventTodoCreated, ListId: 2, UserId: 2, TodoId: 1, Content: "of another list"})
+		store.appendEvent(context.Background(), types.NewEvent{Type: types.EventTodoCreated, ListId: dummyUser.Id, UserId: dummyUser.Id, TodoId: 2, Content: "mine"})
+
+		events := subscribeEvents(t, srv, "0")
+
+		event := events.next(t)
+		assertTodo(t, event.Content, "mine")
+	})
+	t.Run("shutdown ends the stream", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos}, server.WithWatchInterval(time.Hour))
+		httpServer := httptest.NewUnstartedServer(srv)
+		httpServer.Config.RegisterOnShutdown(srv.Shutdown)
+		httpServer.Start()
+		t.Cleanup(httpServer.Close)
+
+		request, err := http.NewRequest(http.MethodGet, httpServer.URL+"/events", nil)
+		assertNoErr(t, err)
+		authorize(request, dummyToken)
+		response, err := http.DefaultClient.Do(request)
+		assertNoErr(t, err)
+		defer response.Body.Close()
+		assertStatus(t, response.StatusCode, http.StatusOK)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		started := time.Now()
+
+		assertNoErr(t, httpServer.Config.Shutdown(ctx))
+		if elapsed := time.Since(started); elapsed > time.Second {
+			t.Errorf("shutdown took %s", elapsed)
+		}
+	})
+	t.Run("invalid Last-Event-ID", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		request, err := http.NewRequest(http.MethodGet, "/events", nil)
+		assertNoErr(t, err)
+		authorize(request, dummyToken)
+		request.Header.Set("Last-Event-ID", "-1")
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+		assertErrMsg(t, response.Body.String(), server.InvalidLastEventIdErrMsg)
+	})
+}
+
+type eventStream struct {
+	scanner *bufio.Scanner
+}
+
+// subscribeEvents opens /events on a real connection, the recorder of httptest can't stream.
+func subscribeEvents(t *testing.T, srv *server.Server, lastEventId string) *eventStream {
+	t.Helper()
+
+	httpServer := httptest.NewServer(srv)
+	t.Cleanup(httpServer.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/events", nil)
+	assertNoErr(t, err)
+	authorize(request, dummyToken)
+	if lastEventId != "" {
+		request.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	assertNoErr(t, err)
+	t.Cleanup(func() { response.Body.Close() })
+
+	assertStatus(t, response.StatusCode, http.StatusOK)
+	assertTodo(t, response.Header.Get("Content-Type"), "text/event-stream")
+
+	return &eventStream{scanner: bufio.NewScanner(response.Body)}
+}
+
+// next reads the next event, checking its id and type lines agree with its data.
+func (s *eventStream) next(t *testing.T) types.Event {
+	t.Helper()
+
+	fields := make(map[string]string)
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if line == "" && len(fields) > 0 {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ": "); ok && name != "" {
+			fields[name] = value
+		}
+	}
+	assertNoErr(t, s.scanner.Err())
+
+	var event types.Event
+	assertNoErr(t, json.Unmarshal([]byte(fields["data"]), &event))
+	assertTodo(t, fields["id"], strconv.FormatInt(event.Id, 10))
+	assertTodo(t, fields["event"], string(event.Type))
+
+	return event
+}
+
+func postTodo(t *testing.T, srv *server.Server, content string) {
+	t.Helper()
+
+	request, err := newPostTodoRequest(newRequestBody(t, types.NewTodo{Content: content}))
+	assertNoErr(t, err)
+	response := httptest.NewRecorder()
+	srv.ServeHTTP(response, request)
+	assertStatus(t, response.Code, http.StatusOK)
+}
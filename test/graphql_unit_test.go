@@ -0,0 +1,236 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestGraphQL(t *testing.T) {
+	t.Run("field selection", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		data, errs := execGraphQL(t, srv, dummyToken, `{ todos { nodes { id content } totalCount } }`, nil)
+		assertTodo(t, len(errs), 0)
+		assertTodo(t, data, `{"todos":{"nodes":[{"id":1,"content":"foo"},{"id":2,"content":"bar"}],"totalCount":2}}`)
+	})
+	t.Run("me and workspace", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		data, errs := execGraphQL(t, srv, dummyToken, `{ me { id username } workspace { slug todoQuota todoCount } }`, nil)
+		assertTodo(t, len(errs), 0)
+		assertTodo(t, data, `{"me":{"id":1,"username":"dummy"},"workspace":{"slug":"default","todoQuota":null,"todoCount":2}}`)
+	})
+	t.Run("filter", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		data, errs := execGraphQL(t, srv, dummyToken, `query($filter: TodoFilter) { todos(filter: $filter) { nodes { content } totalCount } }`, map[string]any{
+			"filter": map[string]any{"contains": "BA"},
+		})
+		assertTodo(t, len(errs), 0)
+		assertTodo(t, data, `{"todos":{"nodes":[{"content":"bar"}],"totalCount":1}}`)
+
+		data, errs = execGraphQL(t, srv, dummyToken, `{ todos(filter: {createdAfter: "2009-11-10T23:00:00Z"}) { totalCount } }`, nil)
+		assertTodo(t, len(errs), 0)
+		assertTodo(t, data, `{"todos":{"totalCount":0}}`)
+	})
+	t.Run("pagination", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+		query := `query($after: String) { todos(first: 1, after: $after) { edges { node { content } } pageInfo { hasNextPage endCursor } totalCount } }`
+
+		var page struct {
+			Todos struct {
+				Edges []struct {
+					Node types.Todo `json:"node"`
+				} `json:"edges"`
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+				TotalCount int `json:"totalCount"`
+			} `json:"todos"`
+		}
+
+		data, errs := execGraphQL(t, srv, dummyToken, query, nil)
+		assertTodo(t, len(errs), 0)
+		assertNoErr(t, json.Unmarshal([]byte(data), &page))
+		assertTodo(t, len(page.Todos.Edges), 1)
+		assertTodo(t, page.Todos.Edges[0].Node.Content, "foo")
+		assertTodo(t, page.Todos.PageInfo.HasNextPage, true)
+		assertTodo(t, page.Todos.TotalCount, 2)
+
+		data, errs = execGraphQL(t, srv, dummyToken, query, map[string]any{"after": page.Todos.PageInfo.EndCursor})
+		assertTodo(t, len(errs), 0)
+		assertNoErr(t, json.Unmarshal([]byte(data), &page))
+		assertTodo(t, len(page.Todos.Edges), 1)
+		assertTodo(t, page.Todos.Edges[0].Node.Content, "bar")
+		assertTodo(t, page.Todos.PageInfo.HasNextPage, false)
+	})
+	t.Run("invalid pagination", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		_, errs := execGraphQL(t, srv, dummyToken, `{ todos(after: "nope") { totalCount } }`, nil)
+		assertGraphQLErr(t, errs, server.InvalidCursorErrMsg)
+
+		_, errs = execGraphQL(t, srv, dummyToken, `{ todos(first: 101) { totalCount } }`, nil)
+		assertGraphQLErr(t, errs, server.InvalidPageSizeErrMsg+" first must be between 0 and 100.")
+	})
+	t.Run("todo by id", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		data, errs := execGraphQL(t, srv, dummyToken, `{ found: todo(id: 2) { content } missing: todo(id: 3) { content } }`, nil)
+		assertTodo(t, len(errs), 0)
+		assertTodo(t, data, `{"found":{"content":"bar"},"missing":null}`)
+	})
+	t.Run("todos of every list in one batch", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		store.shares = []stubShare{
+			{Share: types.Share{UserId: dummyUser.Id, Role: types.RoleViewer}, listId: 2},
+			{Share: types.Share{UserId: dummyUser.Id, Role: types.RoleEditor}, listId: 3},
+		}
+		srv := server.New(store)
+
+		data, errs := execGraphQL(t, srv, dummyToken, `{ lists { id role todos { totalCount } } }`, nil)
+		assertTodo(t, len(errs), 0)
+		assertTodo(t, data, `{"lists":[{"id":1,"role":"owner","todos":{"totalCount":2}},{"id":2,"role":"viewer","todos":{"totalCount":2}},{"id":3,"role":"editor","todos":{"totalCount":2}}]}`)
+		assertTodo(t, store.todoBatches, [][]int{{1, 2, 3}})
+		assertTodo(t, store.getTodosCalls, 0)
+	})
+	t.Run("list without access", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		data, errs := execGraphQL(t, srv, dummyToken, `{ todos(list: 2) { totalCount } }`, nil)
+		assertGraphQLErr(t, errs, "Permission denied! viewer access to list 2 is required.")
+		assertTodo(t, data, "null")
+
+		_, errs = execGraphQL(t, srv, dummyToken, `{ list(id: 2) { id } }`, nil)
+		assertGraphQLErr(t, errs, "Permission denied! viewer access to list 2 is required.")
+	})
+	t.Run("mutations", func(t *testing.T) {
+		store := &stubStore{Todos: types.Todos{{Id: 1, Content: "foo", CreatedAt: dummyTime}}}
+		srv := server.New(store)
+
+		data, errs := execGraphQL(t, srv, dummyToken, `mutation($content: String!) { createTodo(content: $content) { id content } }`, map[string]any{"content": "buy milk"})
+		assertTodo(t, len(errs), 0)
+		assertTodo(t, data, `{"createTodo":{"id":2,"content":"buy milk"}}`)
+		assertTodo(t, store.newTodo, types.NewTodo{Content: "buy milk"})
+
+		data, errs = execGraphQL(t, srv, dummyToken, `mutation { updateTodo(id: 1, content: "buy eggs") { id content } }`, nil)
+		assertTodo(t, len(errs), 0)
+		assertTodo(t, data, `{"updateTodo":{"id":1,"content":"buy eggs"}}`)
+		assertIdAndContentExist(t, store.Todos, 1, "buy eggs")
+
+		data, errs = execGraphQL(t, srv, dummyToken, `mutation { deleteTodo(id: 1) }`, nil)
+		assertTodo(t, len(errs), 0)
+		assertTodo(t, data, `{"deleteTodo":1}`)
+		assertIdNotExist(t, store.Todos, 1)
+	})
+	t.Run("invalid mutations", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		_, errs := execGraphQL(t, srv, dummyToken, `mutation { createTodo(content: "") { id } }`, nil)
+		assertGraphQLErr(t, errs, server.InvalidContentErrMsg)
+
+		_, errs = execGraphQL(t, srv, dummyToken, `mutation { createTodo(content: "`+strings.Repeat("a", 51)+`") { id } }`, nil)
+		assertGraphQLErr(t, errs, server.InvalidContentErrMsg+" Content can't be longer than 50 characters.")
+
+		_, errs = execGraphQL(t, srv, dummyToken, `mutation { updateTodo(id: 0, content: "buy eggs") { id } }`, nil)
+		assertGraphQLErr(t, errs, server.InvalidIdErrMsg)
+
+		_, errs = execGraphQL(t, srv, dummyToken, `mutation { deleteTodo(id: -1) }`, nil)
+		assertGraphQLErr(t, errs, server.InvalidIdErrMsg)
+
+		_, errs = execGraphQL(t, srv, dummyToken, `mutation { createTodo(list: 2, content: "buy milk") { id } }`, nil)
+		assertGraphQLErr(t, errs, "Permission denied! editor access to list 2 is required.")
+
+		_, errs = execGraphQL(t, srv, dummyToken, `mutation { updateTodo(id: 999, content: "buy eggs") { id } }`, nil)
+		assertGraphQLErr(t, errs, db.UpdatedIdNotExistErr.Error())
+	})
+	t.Run("db errors aren't shown", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos, writeErr: errors.New(`ERROR: relation "todos" does not exist (SQLSTATE 42P01)`)})
+
+		_, errs := execGraphQL(t, srv, dummyToken, `mutation { createTodo(content: "buy milk") { id } }`, nil)
+		assertGraphQLErr(t, errs, server.InternalErrMsg)
+
+		srv = server.New(&stubStore{Todos: dummyTodos, readErr: errors.New(`ERROR: relation "todos" does not exist (SQLSTATE 42P01)`)})
+		for _, query := range []string{`{ lists { id } }`, `{ list(id: 1) { id } }`, `{ todos { totalCount } }`, `{ todo(id: 1) { id } }`} {
+			_, errs = execGraphQL(t, srv, dummyToken, query, nil)
+			assertGraphQLErr(t, errs, server.InternalErrMsg)
+		}
+	})
+	t.Run("mutations require todos:write", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		srv := server.New(store)
+		token := mintToken(t, srv, types.NewToken{Name: "ci", Scopes: []string{auth.ScopeTodosRead}})
+
+		_, errs := execGraphQL(t, srv, token.Secret, `{ todos { totalCount } }`, nil)
+		assertTodo(t, len(errs), 0)
+
+		_, errs = execGraphQL(t, srv, token.Secret, `mutation { createTodo(content: "buy milk") { id } }`, nil)
+		assertGraphQLErr(t, errs, server.InsufficientScopeErrMsg+" "+auth.ScopeTodosWrite+" is required.")
+		assertTodo(t, store.newTodo, types.NewTodo{})
+	})
+	t.Run("invalid query", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		_, errs := execGraphQL(t, srv, dummyToken, `{ todos { nodes { title } } }`, nil)
+		assertGraphQLErr(t, errs, `Cannot query field "title" on type "Todo".`)
+		assertTodo(t, errs[0].Locations, []types.GraphQLLocation{{Line: 1, Column: 19}})
+	})
+	t.Run("unauthenticated", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		response := postGraphQL(t, srv, "", types.GraphQLRequest{Query: `{ me { id } }`})
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+}
+
+func postGraphQL(t *testing.T, srv *server.Server, token string, request types.GraphQLRequest) *httptest.ResponseRecorder {
+	t.Helper()
+
+	httpRequest, err := http.NewRequest(http.MethodPost, "/graphql", newRequestBody(t, request))
+	assertNoErr(t, err)
+	if token != "" {
+		authorize(httpRequest, token)
+	}
+	response := httptest.NewRecorder()
+	srv.ServeHTTP(response, httpRequest)
+
+	return response
+}
+
+// execGraphQL runs query and returns the compacted json of its data along with its errors.
+func execGraphQL(t *testing.T, srv *server.Server, token, query string, variables map[string]any) (string, []types.GraphQLError) {
+	t.Helper()
+
+	response := postGraphQL(t, srv, token, types.GraphQLRequest{Query: query, Variables: variables})
+	assertStatus(t, response.Code, http.StatusOK)
+
+	var body struct {
+		Data   json.RawMessage      `json:"data"`
+		Errors []types.GraphQLError `json:"errors"`
+	}
+	assertNoErr(t, json.NewDecoder(response.Body).Decode(&body))
+
+	var data bytes.Buffer
+	assertNoErr(t, json.Compact(&data, body.Data))
+
+	return data.String(), body.Errors
+}
+
+func assertGraphQLErr(t testing.TB, errs []types.GraphQLError, msg string) {
+	t.Helper()
+
+	if len(errs) != 1 || errs[0].Message != msg {
+		t.Fatalf("Want error %q, but got %+v", msg, errs)
+	}
+}
@@ -0,0 +1,241 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/pkg/todospb"
+	"github.com/gorgemul/todos/types"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPC(t *testing.T) {
+	t.Run("list todos", func(t *testing.T) {
+		client := newGRPCClient(t, server.New(&stubStore{Todos: dummyTodos}))
+
+		response, err := client.ListTodos(withBearer(context.Background(), dummyToken), &todospb.ListTodosRequest{})
+		assertNoErr(t, err)
+
+		assertTodo(t, len(response.Todos), 2)
+		assertTodo(t, response.Todos[0].Content, "foo")
+		assertTodo(t, response.Todos[0].CreatedAt.AsTime(), dummyTime)
+	})
+	t.Run("get todo", func(t *testing.T) {
+		client := newGRPCClient(t, server.New(&stubStore{Todos: dummyTodos}))
+
+		todo, err := client.GetTodo(withBearer(context.Background(), dummyToken), &todospb.GetTodoRequest{Id: 2})
+		assertNoErr(t, err)
+		assertTodo(t, todo.Content, "bar")
+
+		_, err = client.GetTodo(withBearer(context.Background(), dummyToken), &todospb.GetTodoRequest{Id: 3})
+		assertCode(t, err, codes.NotFound, server.TodoNotExistErrMsg)
+	})
+	t.Run("create, update and delete todos", func(t *testing.T) {
+		store := &stubStore{Todos: types.Todos{{Id: 1, Content: "foo", CreatedAt: dummyTime}}}
+		client := newGRPCClient(t, server.New(store))
+		ctx := withBearer(context.Background(), dummyToken)
+
+		created, err := client.CreateTodo(ctx, &todospb.CreateTodoRequest{Content: "buy milk"})
+		assertNoErr(t, err)
+		assertTodo(t, store.newTodo, types.NewTodo{Content: "buy milk"})
+		assertTodo(t, created.Todo.Id, int64(2))
+		assertTodo(t, created.Todo.Content, "buy milk")
+
+		_, err = client.UpdateTodo(ctx, &todospb.UpdateTodoRequest{Id: 1, Content: "buy eggs"})
+		assertNoErr(t, err)
+		assertIdAndContentExist(t, store.Todos, 1, "buy eggs")
+
+		_, err = client.DeleteTodo(ctx, &todospb.DeleteTodoRequest{Id: 1})
+		assertNoErr(t, err)
+		assertIdNotExist(t, store.Todos, 1)
+	})
+	t.Run("invalid arguments", func(t *testing.T) {
+		client := newGRPCClient(t, server.New(&stubStore{Todos: dummyTodos}))
+		ctx := withBearer(context.Background(), dummyToken)
+
+		_, err := client.CreateTodo(ctx, &todospb.CreateTodoRequest{})
+		assertCode(t, err, codes.InvalidArgument, server.InvalidContentErrMsg)
+
+		_, err = client.CreateTodo(ctx, &todospb.CreateTodoRequest{Content: strings.Repeat("a", 51)})
+		assertCode(t, err, codes.InvalidArgument, server.InvalidContentErrMsg+" Content can't be longer than 50 characters.")
+
+		_, err = client.UpdateTodo(ctx, &todospb.UpdateTodoRequest{Content: "buy eggs"})
+		assertCode(t, err, codes.InvalidArgument, server.InvalidIdErrMsg)
+
+		_, err = client.UpdateTodo(ctx, &todospb.UpdateTodoRequest{Id: 1})
+		assertCode(t, err, codes.InvalidArgument, server.InvalidContentErrMsg)
+
+		_, err = client.DeleteTodo(ctx, &todospb.DeleteTodoRequest{Id: -1})
+		assertCode(t, err, codes.InvalidArgument, server.InvalidIdErrMsg)
+
+		_, err = client.ListTodos(ctx, &todospb.ListTodosRequest{ListId: -1})
+		assertCode(t, err, codes.InvalidArgument, server.InvalidListIdErrMsg)
+	})
+	t.Run("unauthenticated", func(t *testing.T) {
+		client := newGRPCClient(t, server.New(&stubStore{Todos: dummyTodos}))
+
+		_, err := client.ListTodos(context.Background(), &todospb.ListTodosRequest{})
+		assertCode(t, err, codes.Unauthenticated, server.UnauthorizedErrMsg)
+
+		_, err = client.ListTodos(withBearer(context.Background(), "wrong-token"), &todospb.ListTodosRequest{})
+		assertCode(t, err, codes.Unauthenticated, server.UnauthorizedErrMsg)
+	})
+	t.Run("scopes of personal access tokens", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+		client := newGRPCClient(t, srv)
+		token := mintToken(t, srv, types.NewToken{Name: "ci", Scopes: []string{auth.ScopeTodosRead}})
+		ctx := withBearer(context.Background(), token.Secret)
+
+		_, err := client.ListTodos(ctx, &todospb.ListTodosRequest{})
+		assertNoErr(t, err)
+
+		_, err = client.CreateTodo(ctx, &todospb.CreateTodoRequest{Content: "buy milk"})
+		assertCode(t, err, codes.PermissionDenied, server.InsufficientScopeErrMsg+" "+auth.ScopeTodosWrite+" is required.")
+	})
+	t.Run("unknown workspace", func(t *testing.T) {
+		client := newGRPCClient(t, server.New(&stubStore{Todos: dummyTodos}))
+		ctx := metadata.AppendToOutgoingContext(withBearer(context.Background(), dummyToken), "x-workspace", "nope")
+
+		_, err := client.ListTodos(ctx, &todospb.ListTodosRequest{})
+		assertCode(t, err, codes.InvalidArgument, "Workspace is not exist!")
+	})
+	t.Run("wrong tokens are throttled", func(t *testing.T) {
+		client := newGRPCClient(t, server.New(&stubStore{Todos: dummyTodos}, server.WithRateLimit(1, 1)))
+		ctx := withBearer(context.Background(), "wrong-token")
+
+		_, err := client.ListTodos(ctx, &todospb.ListTodosRequest{})
+		assertCode(t, err, codes.Unauthenticated, server.UnauthorizedErrMsg)
+
+		_, err = client.ListTodos(ctx, &todospb.ListTodosRequest{})
+		assertCode(t, err, codes.ResourceExhausted, server.TooManyRequestsErrMsg)
+	})
+	t.Run("workspace of others", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos, workspaces: []types.Workspace{{Id: 2, Slug: "other", CreatedAt: dummyTime}}}
+		client := newGRPCClient(t, server.New(store))
+		ctx := metadata.AppendToOutgoingContext(withBearer(context.Background(), dummyToken), "x-workspace", "other")
+
+		_, err := client.ListTodos(ctx, &todospb.ListTodosRequest{})
+		assertCode(t, err, codes.PermissionDenied, db.NotWorkspaceMemberErr.Error())
+	})
+	t.Run("rate limited", func(t *testing.T) {
+		client := newGRPCClient(t, server.New(&stubStore{Todos: dummyTodos}, server.WithRateLimit(1, 1)))
+		ctx := withBearer(context.Background(), dummyToken)
+
+		_, err := client.ListTodos(ctx, &todospb.ListTodosRequest{})
+		assertNoErr(t, err)
+
+		_, err = client.ListTodos(ctx, &todospb.ListTodosRequest{})
+		assertCode(t, err, codes.ResourceExhausted, server.TooManyRequestsErrMsg)
+	})
+	t.Run("watch todos", func(t *testing.T) {
+		store := &lockedStore{stubStore: &stubStore{Todos: types.Todos{{Id: 1, Content: "foo", CreatedAt: dummyTime}}}}
+		// polling would only see the change after the test timed out
+		client := newGRPCClient(t, server.New(store, server.WithWatchInterval(time.Hour)))
+		ctx, cancel := context.WithTimeout(withBearer(context.Background(), dummyToken), 5*time.Second)
+		defer cancel()
+
+		stream, err := client.WatchTodos(ctx, &todospb.WatchTodosRequest{})
+		assertNoErr(t, err)
+
+		response, err := stream.Recv()
+		assertNoErr(t, err)
+		assertTodo(t, len(response.Todos), 1)
+
+		_, err = client.CreateTodo(ctx, &todospb.CreateTodoRequest{Content: "buy milk"})
+		assertNoErr(t, err)
+
+		response, err = stream.Recv()
+		assertNoErr(t, err)
+		assertTodo(t, len(response.Todos), 2)
+		assertTodo(t, response.Todos[1].Content, "buy milk")
+	})
+	t.Run("shutdown ends watches", func(t *testing.T) {
+		srv := server.New(&lockedStore{stubStore: &stubStore{Todos: dummyTodos}}, server.WithWatchInterval(time.Hour))
+		client := newGRPCClient(t, srv)
+		ctx, cancel := context.WithTimeout(withBearer(context.Background(), dummyToken), 5*time.Second)
+		defer cancel()
+
+		stream, err := client.WatchTodos(ctx, &todospb.WatchTodosRequest{})
+		assertNoErr(t, err)
+		_, err = stream.Recv()
+		assertNoErr(t, err)
+
+		srv.Shutdown()
+
+		_, err = stream.Recv()
+		assertCode(t, err, codes.Unavailable, server.ShuttingDownErrMsg)
+	})
+	t.Run("db errors aren't shown", func(t *testing.T) {
+		client := newGRPCClient(t, server.New(&stubStore{Todos: dummyTodos, readErr: errors.New(`ERROR: relation "todos" does not exist (SQLSTATE 42P01)`)}))
+		ctx := withBearer(context.Background(), dummyToken)
+
+		_, err := client.ListTodos(ctx, &todospb.ListTodosRequest{})
+		assertCode(t, err, codes.Internal, server.InternalErrMsg)
+	})
+}
+
+// lockedStore lets the polling of WatchTodos and the calls of the test share the stub store, and
+// keeps the todos it is posted.
+type lockedStore struct {
+	*stubStore
+	mu sync.Mutex
+}
+
+func (s *lockedStore) GetTodos(ctx context.Context, userId, listId int) (types.Todos, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	todos, err := s.stubStore.GetTodos(ctx, userId, listId)
+	return append(types.Todos(nil), todos...), err
+}
+
+func (s *lockedStore) PostTodo(ctx context.Context, userId, listId int, content string) (types.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	todo, err := s.stubStore.PostTodo(ctx, userId, listId, content)
+	if err != nil {
+		return types.Todo{}, err
+	}
+	s.Todos = append(s.Todos, todo)
+	return todo, nil
+}
+
+// newGRPCClient serves srv over HTTP/2 without TLS, the way cmd/todos does.
+func newGRPCClient(t *testing.T, srv *server.Server) todospb.TodoServiceClient {
+	t.Helper()
+
+	httpServer := httptest.NewServer(h2c.NewHandler(srv, &http2.Server{}))
+	t.Cleanup(httpServer.Close)
+
+	conn, err := grpc.NewClient(strings.TrimPrefix(httpServer.URL, "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assertNoErr(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return todospb.NewTodoServiceClient(conn)
+}
+
+func withBearer(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func assertCode(t testing.TB, err error, code codes.Code, msg string) {
+	t.Helper()
+
+	got := status.Convert(err)
+	if got.Code() != code || got.Message() != msg {
+		t.Fatalf("Want %s %q, but got %s %q", code, msg, got.Code(), got.Message())
+	}
+}
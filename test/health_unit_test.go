@@ -0,0 +1,98 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestHealthz(t *testing.T) {
+	for _, path := range []string{"/healthz", "/livez"} {
+		t.Run(path, func(t *testing.T) {
+			// a broken db doesn't make the process unhealthy
+			srv := server.New(&stubStore{pingErr: errors.New("connection refused")})
+
+			response := getPath(t, srv, path)
+
+			assertStatus(t, response.Code, http.StatusOK)
+			assertHealth(t, response, types.Health{Status: types.HealthOK})
+		})
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		srv := server.New(dummyStore, server.WithReadinessCheck("worker", func(ctx context.Context) error { return nil }))
+
+		response := getPath(t, srv, "/readyz")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertHealth(t, response, types.Health{
+			Status: types.HealthOK,
+			Checks: map[string]types.HealthCheck{
+				"database":   {Status: types.HealthOK},
+				"migrations": {Status: types.HealthOK},
+				"worker":     {Status: types.HealthOK},
+			},
+		})
+	})
+	t.Run("failing checks", func(t *testing.T) {
+		srv := server.New(
+			&stubStore{schemaErr: db.SchemaDirtyErr},
+			server.WithReadinessCheck("worker", func(ctx context.Context) error { return errors.New("worker stopped") }),
+		)
+
+		response := getPath(t, srv, "/readyz")
+
+		assertStatus(t, response.Code, http.StatusServiceUnavailable)
+		assertHealth(t, response, types.Health{
+			Status: types.HealthFail,
+			Checks: map[string]types.HealthCheck{
+				"database":   {Status: types.HealthOK},
+				"migrations": {Status: types.HealthFail, Detail: db.SchemaDirtyErr.Error()},
+				"worker":     {Status: types.HealthFail, Detail: "worker stopped"},
+			},
+		})
+	})
+	t.Run("probes are not rate limited", func(t *testing.T) {
+		srv := server.New(dummyStore, server.WithRateLimit(1, 1))
+
+		for i := 0; i < 3; i++ {
+			response := getPath(t, srv, "/readyz")
+			assertStatus(t, response.Code, http.StatusOK)
+		}
+	})
+}
+
+func getPath(t *testing.T, srv *server.Server, path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodGet, path, nil)
+	assertNoErr(t, err)
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+
+	return response
+}
+
+func assertHealth(t testing.TB, response *httptest.ResponseRecorder, want types.Health) {
+	t.Helper()
+
+	var got types.Health
+	if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+		t.Fatalf("problem decoding health body, %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Want %+v, but got %+v", want, got)
+	}
+}
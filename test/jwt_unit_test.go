@@ -0,0 +1,183 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestJWT(t *testing.T) {
+	credentials := types.Credentials{Username: "alice", Password: "correct horse"}
+
+	t.Run("access token authenticates", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		srv := server.New(store)
+		register(t, srv, credentials)
+
+		pair := issueTokenPair(t, srv, credentials)
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		authorize(request, pair.AccessToken)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		user, err := store.GetUserByUsername(context.Background(), "alice")
+		assertNoErr(t, err)
+		assertTodo(t, store.userId, user.Id)
+	})
+	t.Run("tampered access token is rejected", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+		register(t, srv, credentials)
+		pair := issueTokenPair(t, srv, credentials)
+
+		parts := strings.Split(pair.AccessToken, ".")
+		forged := parts[0] + "." + parts[1] + "x." + parts[2]
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		authorize(request, forged)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+	})
+	t.Run("refresh rotates the refresh token", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+		register(t, srv, credentials)
+		pair := issueTokenPair(t, srv, credentials)
+
+		response := refresh(t, srv, pair.RefreshToken)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		var rotated types.TokenPair
+		err := json.NewDecoder(response.Body).Decode(&rotated)
+		assertNoErr(t, err)
+		if rotated.RefreshToken == pair.RefreshToken {
+			t.Fatalf("refresh token was not rotated")
+		}
+	})
+	t.Run("reusing a refresh token revokes the family", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+		register(t, srv, credentials)
+		pair := issueTokenPair(t, srv, credentials)
+
+		response := refresh(t, srv, pair.RefreshToken)
+		var rotated types.TokenPair
+		err := json.NewDecoder(response.Body).Decode(&rotated)
+		assertNoErr(t, err)
+
+		response = refresh(t, srv, pair.RefreshToken)
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrMsg(t, response.Body.String(), db.RefreshTokenReusedErr.Error())
+
+		response = refresh(t, srv, rotated.RefreshToken)
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrMsg(t, response.Body.String(), db.RefreshTokenNotExistErr.Error())
+	})
+	t.Run("wrong password", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+		register(t, srv, credentials)
+
+		request, err := http.NewRequest("POST", "/auth/token", newRequestBody(t, types.Credentials{Username: "alice", Password: "wrong horse"}))
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrMsg(t, response.Body.String(), server.InvalidCredentialsErrMsg)
+	})
+}
+
+func TestKeySet(t *testing.T) {
+	claims := auth.Claims{Issuer: auth.Issuer, Subject: "1", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+
+	t.Run("old tokens verify after rotation", func(t *testing.T) {
+		keys := auth.MustNewKeySet()
+		token, err := keys.Sign(claims)
+		assertNoErr(t, err)
+
+		err = keys.Rotate()
+		assertNoErr(t, err)
+
+		_, err = keys.Verify(token)
+		assertNoErr(t, err)
+	})
+	t.Run("jwks publishes every verifying key", func(t *testing.T) {
+		keys := auth.MustNewKeySet()
+		err := keys.Rotate()
+		assertNoErr(t, err)
+
+		srv := server.New(new(stubStore), server.WithKeySet(keys))
+		request, err := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var jwks auth.JWKS
+		err = json.NewDecoder(response.Body).Decode(&jwks)
+		assertNoErr(t, err)
+		assertTodo(t, len(jwks.Keys), 2)
+	})
+	t.Run("expired token", func(t *testing.T) {
+		keys := auth.MustNewKeySet()
+		expired := claims
+		expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+		token, err := keys.Sign(expired)
+		assertNoErr(t, err)
+
+		_, err = keys.Verify(token)
+		assertTodo(t, err, auth.InvalidJWTErr)
+	})
+	t.Run("token of another key set", func(t *testing.T) {
+		token, err := auth.MustNewKeySet().Sign(claims)
+		assertNoErr(t, err)
+
+		_, err = auth.MustNewKeySet().Verify(token)
+		assertTodo(t, err, auth.InvalidJWTErr)
+	})
+}
+
+func issueTokenPair(t *testing.T, srv *server.Server, credentials types.Credentials) types.TokenPair {
+	t.Helper()
+
+	request, err := http.NewRequest("POST", "/auth/token", newRequestBody(t, credentials))
+	assertNoErr(t, err)
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+	assertStatus(t, response.Code, http.StatusOK)
+
+	var pair types.TokenPair
+	err = json.NewDecoder(response.Body).Decode(&pair)
+	assertNoErr(t, err)
+
+	return pair
+}
+
+func refresh(t *testing.T, srv *server.Server, refreshToken string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request, err := http.NewRequest("POST", "/auth/refresh", newRequestBody(t, types.RefreshToken{RefreshToken: refreshToken}))
+	assertNoErr(t, err)
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+
+	return response
+}
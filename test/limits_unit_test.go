@@ -0,0 +1,192 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/ratelimit"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	t.Run("declared length over the limit", func(t *testing.T) {
+		srv := server.New(dummyStore, server.WithMaxBodyBytes(16))
+
+		request, err := newPostTodoRequest(newRequestBody(t, types.NewTodo{Content: "way more than sixteen bytes"}))
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+		assertErrMsg(t, response.Body.String(), server.RequestTooLargeErrMsg)
+	})
+	t.Run("undeclared length over the limit", func(t *testing.T) {
+		srv := server.New(dummyStore, server.WithMaxBodyBytes(16))
+
+		body := io.MultiReader(strings.NewReader(`{"content": "`), strings.NewReader(strings.Repeat("a", 64)), strings.NewReader(`"}`))
+		request, err := newPostTodoRequest(body)
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+		assertErrMsg(t, response.Body.String(), server.RequestTooLargeErrMsg)
+	})
+	t.Run("body within the limit", func(t *testing.T) {
+		srv := server.New(dummyStore, server.WithMaxBodyBytes(64))
+
+		request, err := newPostTodoRequest(newRequestBody(t, types.NewTodo{Content: "short"}))
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+	t.Run("reloaded limit", func(t *testing.T) {
+		srv := server.New(dummyStore, server.WithMaxBodyBytes(64))
+		srv.Reload(server.Settings{MaxBodyBytes: 16})
+
+		request, err := newPostTodoRequest(newRequestBody(t, types.NewTodo{Content: "way more than sixteen bytes"}))
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Run("burst then throttle", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos}, server.WithRateLimit(1, 2))
+
+		for i := 0; i < 2; i++ {
+			response := getWithToken(t, srv, dummyToken)
+			assertStatus(t, response.Code, http.StatusOK)
+		}
+
+		response := getWithToken(t, srv, dummyToken)
+
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+		assertErrMsg(t, response.Body.String(), server.TooManyRequestsErrMsg)
+		assertTodo(t, response.Header().Get("Retry-After"), "1")
+		assertTodo(t, response.Header().Get("RateLimit-Limit"), "2")
+		assertTodo(t, response.Header().Get("RateLimit-Remaining"), "0")
+		assertTodo(t, response.Header().Get("RateLimit-Policy"), "2;w=2")
+	})
+	t.Run("reload keeps the buckets", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos}, server.WithRateLimit(1, 2))
+
+		for i := 0; i < 2; i++ {
+			response := getWithToken(t, srv, dummyToken)
+			assertStatus(t, response.Code, http.StatusOK)
+		}
+
+		srv.Reload(server.Settings{MaxBodyBytes: server.DefaultMaxBodyBytes, RateLimit: true, RateLimitRate: 1, RateLimitBurst: 3})
+
+		response := getWithToken(t, srv, dummyToken)
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+		assertTodo(t, response.Header().Get("RateLimit-Limit"), "3")
+		assertTodo(t, response.Header().Get("RateLimit-Policy"), "3;w=3")
+
+		srv.Reload(server.Settings{MaxBodyBytes: server.DefaultMaxBodyBytes})
+
+		response = getWithToken(t, srv, dummyToken)
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+	t.Run("users have their own buckets", func(t *testing.T) {
+		// registering and logging in are anonymous, they use up the bucket of the client ip
+		srv := server.New(&stubStore{Todos: dummyTodos}, server.WithRateLimit(1, 2))
+		bob := loginAs(t, srv, types.Credentials{Username: "bob", Password: "correct horse"})
+
+		for i := 0; i < 2; i++ {
+			response := getWithToken(t, srv, dummyToken)
+			assertStatus(t, response.Code, http.StatusOK)
+		}
+
+		response := getWithToken(t, srv, bob)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		response = getWithToken(t, srv, dummyToken)
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+
+		response = getWithToken(t, srv, bob)
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+	t.Run("wrong tokens throttle the client ip", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		srv := server.New(store, server.WithRateLimit(1, 2))
+
+		for i := 0; i < 2; i++ {
+			response := getWithToken(t, srv, "wrong-token")
+			assertStatus(t, response.Code, http.StatusUnauthorized)
+		}
+
+		response := getWithToken(t, srv, "wrong-token")
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+		assertErrMsg(t, response.Body.String(), server.TooManyRequestsErrMsg)
+		assertTodo(t, response.Header().Get("Retry-After"), "1")
+
+		// right tokens are throttled too, guesses can't be told apart from them before the lookup
+		response = getWithToken(t, srv, dummyToken)
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		authorize(request, "wrong-token")
+		request.RemoteAddr = "192.0.2.2:1234"
+		other := httptest.NewRecorder()
+		srv.ServeHTTP(other, request)
+		assertStatus(t, other.Code, http.StatusUnauthorized)
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	limiter := ratelimit.NewWithClock(2, 2, func() time.Time { return now })
+
+	assertTodo(t, limiter.Allow("a").Allowed, true)
+	assertTodo(t, limiter.Allow("a").Allowed, true)
+
+	result := limiter.Allow("a")
+	assertTodo(t, result.Allowed, false)
+	assertTodo(t, result.RetryAfter, 500*time.Millisecond)
+	assertTodo(t, limiter.Allow("b").Allowed, true)
+
+	now = now.Add(500 * time.Millisecond)
+	assertTodo(t, limiter.Allow("a").Allowed, true)
+	assertTodo(t, limiter.Allow("a").Allowed, false)
+
+	now = now.Add(time.Hour)
+	result = limiter.Allow("a")
+	assertTodo(t, result.Allowed, true)
+	assertTodo(t, result.Remaining, 1)
+
+	assertTodo(t, limiter.Peek("a").Allowed, true)
+	assertTodo(t, limiter.Peek("a").Remaining, 1)
+	limiter.Allow("a")
+	result = limiter.Peek("a")
+	assertTodo(t, result.Allowed, false)
+	assertTodo(t, result.RetryAfter, 500*time.Millisecond)
+}
+
+func getWithToken(t *testing.T, srv *server.Server, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request, err := newGetTodoRequest()
+	assertNoErr(t, err)
+	authorize(request, token)
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+
+	return response
+}
@@ -0,0 +1,248 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+	"github.com/gorilla/websocket"
+)
+
+func TestLive(t *testing.T) {
+	t.Run("snapshot then the events of the list", func(t *testing.T) {
+		httpServer := newLiveServer(t, &stubStore{Todos: slices.Clone(dummyTodos)})
+		ws := dialLive(t, httpServer, "/lists/1/live", dummyToken)
+
+		snapshot := nextLive(t, ws, types.LiveSnapshot)
+		assertTodo(t, snapshot.Todos, dummyTodos)
+
+		postLiveTodo(t, httpServer, "buy milk")
+		message := nextLive(t, ws, types.LiveEvent)
+		assertTodo(t, message.Event.Type, types.EventTodoCreated)
+		assertTodo(t, message.Event.TodoId, 3)
+		assertTodo(t, message.Event.Content, "buy milk")
+	})
+	t.Run("updates sent on the socket", func(t *testing.T) {
+		httpServer := newLiveServer(t, &stubStore{Todos: slices.Clone(dummyTodos)})
+		ws := dialLive(t, httpServer, "/lists/1/live", dummyToken)
+		other := dialLive(t, httpServer, "/lists/1/live", dummyToken)
+
+		assertNoErr(t, ws.WriteJSON(types.LiveRequest{Type: types.LiveUpdate, Id: 1, Content: "buy eggs"}))
+
+		for _, conn := range []*websocket.Conn{ws, other} {
+			message := nextLive(t, conn, types.LiveEvent)
+			assertTodo(t, message.Event.Type, types.EventTodoUpdated)
+			assertTodo(t, message.Event.TodoId, 1)
+			assertTodo(t, message.Event.Content, "buy eggs")
+		}
+	})
+	t.Run("invalid messages", func(t *testing.T) {
+		httpServer := newLiveServer(t, &stubStore{Todos: slices.Clone(dummyTodos)})
+		ws := dialLive(t, httpServer, "/lists/1/live", dummyToken)
+
+		cases := []struct {
+			name    string
+			message string
+			errMsg  string
+		}{
+			{"invalid id", `{"type":"update","id":0,"content":"buy eggs"}`, server.InvalidIdErrMsg},
+			{"invalid content", `{"type":"update","id":1,"content":""}`, server.InvalidContentErrMsg},
+			{"not exist id", `{"type":"update","id":5,"content":"buy eggs"}`, db.UpdatedIdNotExistErr.Error()},
+			{"unknown type", `{"type":"delete","id":1}`, server.InvalidLiveMessageErrMsg},
+			{"unknown field", `{"type":"update","ids":1}`, server.InvalidBodyErrMsg},
+			{"malformed", `{"type":`, server.InvalidBodyErrMsg},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				assertNoErr(t, ws.WriteMessage(websocket.TextMessage, []byte(c.message)))
+				message := nextLive(t, ws, types.LiveError)
+				if !strings.HasPrefix(message.Error, c.errMsg) {
+					t.Errorf("got error %q, want %q", message.Error, c.errMsg)
+				}
+			})
+		}
+	})
+	t.Run("events committed while the snapshot is read", func(t *testing.T) {
+		store := &stubStore{Todos: slices.Clone(dummyTodos)}
+		store.afterGetTodos = func(ctx context.Context) {
+			store.afterGetTodos = nil
+			store.appendEvent(ctx, types.NewEvent{Type: types.EventTodoCreated, ListId: 1, UserId: dummyUser.Id, TodoId: 3, Content: "buy milk"})
+		}
+		httpServer := newLiveServer(t, store)
+		ws := dialLive(t, httpServer, "/lists/1/live", dummyToken)
+
+		snapshot := nextLive(t, ws, types.LiveSnapshot)
+		assertTodo(t, snapshot.Todos, dummyTodos)
+		message := nextLive(t, ws, types.LiveEvent)
+		assertTodo(t, message.Event.TodoId, 3)
+		assertTodo(t, message.Event.Content, "buy milk")
+	})
+	t.Run("db errors aren't shown", func(t *testing.T) {
+		httpServer := newLiveServer(t, &stubStore{Todos: slices.Clone(dummyTodos), writeErr: errors.New(`ERROR: relation "todos" does not exist (SQLSTATE 42P01)`)})
+		ws := dialLive(t, httpServer, "/lists/1/live", dummyToken)
+
+		assertNoErr(t, ws.WriteJSON(types.LiveRequest{Type: types.LiveUpdate, Id: 1, Content: "buy eggs"}))
+
+		message := nextLive(t, ws, types.LiveError)
+		assertTodo(t, message.Error, server.InternalErrMsg)
+	})
+	t.Run("updates require todos:write", func(t *testing.T) {
+		store := &stubStore{Todos: slices.Clone(dummyTodos)}
+		httpServer := newLiveServer(t, store)
+		token := mintToken(t, httpServer.Config.Handler.(*server.Server), types.NewToken{Name: "ci", Scopes: []string{auth.ScopeTodosRead}})
+		ws := dialLive(t, httpServer, "/lists/1/live", token.Secret)
+
+		assertNoErr(t, ws.WriteJSON(types.LiveRequest{Type: types.LiveUpdate, Id: 1, Content: "buy eggs"}))
+
+		message := nextLive(t, ws, types.LiveError)
+		assertTodo(t, message.Error, server.InsufficientScopeErrMsg+" "+auth.ScopeTodosWrite+" is required.")
+	})
+	t.Run("viewers can't update", func(t *testing.T) {
+		store := &stubStore{Todos: slices.Clone(dummyTodos), shares: []stubShare{{Share: types.Share{UserId: dummyUser.Id, Role: types.RoleViewer}, listId: 2}}}
+		httpServer := newLiveServer(t, store)
+		ws := dialLive(t, httpServer, "/lists/2/live", dummyToken)
+
+		assertNoErr(t, ws.WriteJSON(types.LiveRequest{Type: types.LiveUpdate, Id: 1, Content: "buy eggs"}))
+
+		message := nextLive(t, ws, types.LiveError)
+		assertTodo(t, message.Error, db.PermissionDeniedErr.Error()+" editor access to list 2 is required.")
+	})
+	t.Run("presence", func(t *testing.T) {
+		httpServer := newLiveServer(t, &stubStore{Todos: slices.Clone(dummyTodos)})
+		ws := dialLive(t, httpServer, "/lists/1/live", dummyToken)
+		other := dialLive(t, httpServer, "/lists/1/live", dummyToken)
+
+		todoId := 2
+		assertNoErr(t, other.WriteJSON(types.LiveRequest{Type: types.LivePresence, TodoId: &todoId, Editing: true}))
+
+		presence := nextPresence(t, ws, func(presence []types.Presence) bool {
+			return len(presence) == 2 && (presence[0].Editing || presence[1].Editing)
+		})
+		for _, p := range presence {
+			assertTodo(t, p.UserId, dummyUser.Id)
+			assertTodo(t, p.Username, dummyUser.Username)
+			if p.Editing {
+				assertTodo(t, *p.TodoId, todoId)
+			}
+		}
+
+		other.Close()
+		nextPresence(t, ws, func(presence []types.Presence) bool {
+			return len(presence) == 1 && !presence[0].Editing
+		})
+	})
+	t.Run("revoked shares close the connection", func(t *testing.T) {
+		store := &stubStore{Todos: slices.Clone(dummyTodos), shares: []stubShare{{Share: types.Share{UserId: dummyUser.Id, Role: types.RoleViewer}, listId: 2}}}
+		httpServer := newLiveServer(t, store)
+		shared := dialLive(t, httpServer, "/lists/2/live", dummyToken)
+		own := dialLive(t, httpServer, "/lists/1/live", dummyToken)
+		nextLive(t, shared, types.LiveSnapshot)
+		nextLive(t, own, types.LiveSnapshot)
+
+		request, err := http.NewRequest(http.MethodDelete, httpServer.URL+"/lists/2/shares/1", nil)
+		assertNoErr(t, err)
+		authorize(request, dummyToken)
+		response, err := http.DefaultClient.Do(request)
+		assertNoErr(t, err)
+		response.Body.Close()
+		assertStatus(t, response.StatusCode, http.StatusOK)
+
+		for {
+			shared.SetReadDeadline(time.Now().Add(5 * time.Second))
+			var message types.LiveMessage
+			if err := shared.ReadJSON(&message); err != nil {
+				assertTodo(t, websocket.IsCloseError(err, websocket.CloseGoingAway), true)
+				break
+			}
+		}
+
+		postLiveTodo(t, httpServer, "buy milk")
+		assertTodo(t, nextLive(t, own, types.LiveEvent).Event.Content, "buy milk")
+	})
+	t.Run("permission denied before upgrading", func(t *testing.T) {
+		httpServer := newLiveServer(t, &stubStore{Todos: slices.Clone(dummyTodos)})
+
+		_, response, err := dialLiveErr(httpServer, "/lists/2/live", dummyToken)
+
+		assertTodo(t, err, websocket.ErrBadHandshake)
+		assertStatus(t, response.StatusCode, http.StatusForbidden)
+	})
+	t.Run("invalid list", func(t *testing.T) {
+		httpServer := newLiveServer(t, &stubStore{Todos: slices.Clone(dummyTodos)})
+
+		_, response, err := dialLiveErr(httpServer, "/lists/foo/live", dummyToken)
+
+		assertTodo(t, err, websocket.ErrBadHandshake)
+		assertStatus(t, response.StatusCode, http.StatusBadRequest)
+	})
+}
+
+// newLiveServer serves on a real connection, the recorder of httptest can't be hijacked.
+func newLiveServer(t *testing.T, store *stubStore) *httptest.Server {
+	t.Helper()
+
+	httpServer := httptest.NewServer(server.New(store))
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+func dialLive(t *testing.T, httpServer *httptest.Server, path, token string) *websocket.Conn {
+	t.Helper()
+
+	ws, _, err := dialLiveErr(httpServer, path, token)
+	assertNoErr(t, err)
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func dialLiveErr(httpServer *httptest.Server, path, token string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+path, header)
+}
+
+// nextLive skips the messages of other types, presence comes and goes between the rest.
+func nextLive(t *testing.T, ws *websocket.Conn, messageType types.LiveMessageType) types.LiveMessage {
+	t.Helper()
+
+	for {
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var message types.LiveMessage
+		assertNoErr(t, ws.ReadJSON(&message))
+		if message.Type == messageType {
+			return message
+		}
+	}
+}
+
+func nextPresence(t *testing.T, ws *websocket.Conn, match func([]types.Presence) bool) []types.Presence {
+	t.Helper()
+
+	for {
+		message := nextLive(t, ws, types.LivePresence)
+		if match(message.Presence) {
+			return message.Presence
+		}
+	}
+}
+
+func postLiveTodo(t *testing.T, httpServer *httptest.Server, content string) {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodPost, httpServer.URL+"/", newRequestBody(t, types.NewTodo{Content: content}))
+	assertNoErr(t, err)
+	authorize(request, dummyToken)
+	response, err := http.DefaultClient.Do(request)
+	assertNoErr(t, err)
+	response.Body.Close()
+	assertStatus(t, response.StatusCode, http.StatusOK)
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestRequestId(t *testing.T) {
+	t.Run("propagates the id of the client", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		authorize(request, dummyToken)
+		request.Header.Set("X-Request-ID", "abc-123")
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, response.Header().Get("X-Request-ID"), "abc-123")
+	})
+	t.Run("assigns an id to requests without a valid one", func(t *testing.T) {
+		srv := server.New(dummyStore)
+
+		for _, requestId := range []string{"", "has spaces", strings.Repeat("a", 129)} {
+			request, err := newGetTodoRequest()
+			assertNoErr(t, err)
+			request.Header.Set("X-Request-ID", requestId)
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			got := response.Header().Get("X-Request-ID")
+			if got == "" || got == requestId {
+				t.Fatalf("Want a new request id instead of %q, but got %q", requestId, got)
+			}
+		}
+	})
+	t.Run("error bodies carry the id", func(t *testing.T) {
+		srv := server.New(dummyStore)
+
+		request, err := newPostTodoRequest(newRequestBody(t, types.NewTodo{Content: ""}))
+		assertNoErr(t, err)
+		request.Header.Set("X-Request-ID", "abc-123")
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+		assertTodo(t, response.Body.String(), server.InvalidContentErrMsg+"\nRequest id: abc-123\n")
+	})
+	t.Run("problem bodies carry the id", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		authorize(request, dummyToken)
+		request.URL.RawQuery = "list=2"
+		request.Header.Set("X-Request-ID", "abc-123")
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		var problem types.Problem
+		err = json.NewDecoder(response.Body).Decode(&problem)
+		assertNoErr(t, err)
+		assertStatus(t, problem.Status, http.StatusForbidden)
+		assertTodo(t, problem.RequestId, "abc-123")
+	})
+	t.Run("logs every request", func(t *testing.T) {
+		logs := new(bytes.Buffer)
+		srv := server.New(&stubStore{Todos: dummyTodos}, server.WithLogger(slog.New(slog.NewJSONHandler(logs, nil))))
+
+		request, err := newDeleteTodoRequest(0)
+		assertNoErr(t, err)
+		request.Header.Set("X-Request-ID", "abc-123")
+		srv.ServeHTTP(httptest.NewRecorder(), request)
+
+		var errLog, requestLog map[string]any
+		lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+		assertTodo(t, len(lines), 2)
+		assertNoErr(t, json.Unmarshal([]byte(lines[0]), &errLog))
+		assertNoErr(t, json.Unmarshal([]byte(lines[1]), &requestLog))
+
+		assertTodo(t, errLog["msg"], any(server.InvalidIdErrMsg))
+		assertTodo(t, errLog["request_id"], any("abc-123"))
+		assertTodo(t, requestLog["msg"], any("request"))
+		assertTodo(t, requestLog["request_id"], any("abc-123"))
+		assertTodo(t, requestLog["method"], any("DELETE"))
+		assertTodo(t, requestLog["path"], any("/delete/0"))
+		assertTodo(t, requestLog["status"], any(float64(http.StatusBadRequest)))
+	})
+}
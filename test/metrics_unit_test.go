@@ -0,0 +1,50 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorgemul/todos/pkg/server"
+)
+
+func TestMetrics(t *testing.T) {
+	store := &stubStore{Todos: slices.Clone(dummyTodos)}
+	srv := server.New(store)
+
+	getWithToken(t, srv, dummyToken)
+	getWithToken(t, srv, dummyToken)
+	getWithToken(t, srv, "wrong-token")
+
+	request, err := newDeleteTodoRequest(1)
+	assertNoErr(t, err)
+	srv.ServeHTTP(httptest.NewRecorder(), request)
+
+	response := getPath(t, srv, "/metrics")
+	assertStatus(t, response.Code, http.StatusOK)
+	body := response.Body.String()
+
+	for _, want := range []string{
+		`todos_http_requests_total{code="200",method="GET",route="GET /"} 2`,
+		`todos_http_requests_total{code="401",method="GET",route="GET /"} 1`,
+		// ids in paths are folded into the route pattern
+		`todos_http_request_duration_seconds_count{code="200",method="DELETE",route="DELETE /delete/{id}"} 1`,
+		`todos_db_pool_conns{state="acquired"} 1`,
+		`todos_db_pool_conns{state="idle"} 2`,
+		`todos_db_pool_max_conns 10`,
+		`todos_todos{workspace="default"} 1`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Fatalf("Want metric %s in:\n%s", want, body)
+		}
+	}
+
+	// counting takes a transaction per workspace, scrapes in between reuse the counts
+	store.Todos = nil
+	body = getPath(t, srv, "/metrics").Body.String()
+	if !strings.Contains(body, `todos_todos{workspace="default"} 1`+"\n") {
+		t.Fatalf("Want the cached todo count in:\n%s", body)
+	}
+}
@@ -0,0 +1,33 @@
+package test
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/gorgemul/todos/internal/db/migrations"
+	"github.com/gorgemul/todos/pkg/db"
+)
+
+func TestMigrations(t *testing.T) {
+	versions, err := db.MigrationVersions()
+	assertNoErr(t, err)
+
+	t.Run("latest migration is the schema version the store expects", func(t *testing.T) {
+		assertTodo(t, versions[len(versions)-1], uint(db.SchemaVersion))
+	})
+
+	t.Run("versions are consecutive", func(t *testing.T) {
+		for i, version := range versions {
+			assertTodo(t, version, uint(i+1))
+		}
+	})
+
+	t.Run("every up migration can be rolled back", func(t *testing.T) {
+		for _, version := range versions {
+			downs, err := fs.Glob(migrations.FS, fmt.Sprintf("%06d_*.down.sql", version))
+			assertNoErr(t, err)
+			assertTodo(t, len(downs), 1)
+		}
+	})
+}
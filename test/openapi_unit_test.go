@@ -0,0 +1,126 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorgemul/todos/pkg/server"
+)
+
+type openAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]openAPISchema `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	OperationId string         `json:"operationId"`
+	Responses   map[string]any `json:"responses"`
+}
+
+type openAPISchema struct {
+	Properties map[string]map[string]any `json:"properties"`
+	Required   []string                  `json:"required"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	srv := server.New(&stubStore{})
+
+	getDocument := func(t *testing.T) openAPIDocument {
+		t.Helper()
+		request, err := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, response.Header().Get("Content-Type"), "application/json")
+
+		var document openAPIDocument
+		assertNoErr(t, json.NewDecoder(response.Body).Decode(&document))
+		return document
+	}
+
+	t.Run("every route is documented and nothing else", func(t *testing.T) {
+		document := getDocument(t)
+
+		var documented []string
+		for path, pathItem := range document.Paths {
+			for method := range pathItem {
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+		slices.Sort(documented)
+
+		routes := srv.Routes()
+		slices.Sort(routes)
+
+		for _, route := range routes {
+			if !slices.Contains(documented, route) {
+				t.Errorf("route %s is missing from the spec", route)
+			}
+		}
+		for _, route := range documented {
+			if !slices.Contains(routes, route) {
+				t.Errorf("spec documents %s which is not a route", route)
+			}
+		}
+	})
+	t.Run("operations are unique and answer", func(t *testing.T) {
+		document := getDocument(t)
+
+		assertTodo(t, strings.HasPrefix(document.OpenAPI, "3."), true)
+		ids := make(map[string]bool)
+		for path, pathItem := range document.Paths {
+			for method, operation := range pathItem {
+				if ids[operation.OperationId] {
+					t.Errorf("operation id %s of %s %s is used twice", operation.OperationId, method, path)
+				}
+				ids[operation.OperationId] = true
+				_, ok := operation.Responses["200"]
+				if _, upgrades := operation.Responses["101"]; !ok && !upgrades {
+					t.Errorf("%s %s has no 200 or 101 response", method, path)
+				}
+			}
+		}
+	})
+	t.Run("todo schemas follow the types", func(t *testing.T) {
+		schemas := getDocument(t).Components.Schemas
+
+		assertTodo(t, sortedKeys(schemas["Todo"].Properties), []string{"content", "createdAt", "id"})
+		assertTodo(t, schemas["Todo"].Properties["createdAt"]["format"], any("date-time"))
+		assertTodo(t, sortedKeys(schemas["NewTodo"].Properties), []string{"content"})
+		assertTodo(t, schemas["NewTodo"].Required, []string{"content"})
+		assertTodo(t, sortedKeys(schemas["UpdateTodo"].Properties), []string{"content", "id"})
+		for _, name := range []string{"Todo", "NewTodo", "UpdateTodo"} {
+			assertTodo(t, schemas[name].Properties["content"]["minLength"], any(float64(1)))
+			assertTodo(t, schemas[name].Properties["content"]["maxLength"], any(float64(server.MaxContentLength)))
+		}
+		assertTodo(t, schemas["Token"].Properties["expiresAt"]["nullable"], any(true))
+		assertTodo(t, sortedKeys(schemas["CreatedToken"].Properties), []string{"createdAt", "expiresAt", "id", "lastUsedAt", "name", "revokedAt", "scopes", "token", "workspace"})
+	})
+	t.Run("docs page", func(t *testing.T) {
+		request, err := http.NewRequest(http.MethodGet, "/docs", nil)
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, strings.Contains(response.Body.String(), `fetch("openapi.json")`), true)
+	})
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -2,25 +2,32 @@ package test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gorgemul/todos/pkg/auth"
 	"github.com/gorgemul/todos/pkg/db"
 	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/pkg/webhook"
 	"github.com/gorgemul/todos/types"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
 var (
@@ -60,11 +67,17 @@ func TestHappyPath(t *testing.T) {
 
 	defer dropAllTables(m)
 
-	dbStore := &db.DBStore{Pool: database}
+	dbStore := openStore(t, database)
+	loginDummyUser(t, dbStore)
 	srv := server.New(dbStore)
 	expected := types.Todos{}
 	counter := &idCounter{current: 1}
 
+	t.Run("ready", func(t *testing.T) {
+		response := getPath(t, srv, "/readyz")
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
 	t.Run("init state", func(t *testing.T) {
 		got := get(t, srv)
 		assertTodos(t, got, expected)
@@ -106,7 +119,8 @@ func TestErrorPath(t *testing.T) {
 
 	defer dropAllTables(m)
 
-	dbStore := &db.DBStore{Pool: database}
+	dbStore := openStore(t, database)
+	loginDummyUser(t, dbStore)
 	srv := server.New(dbStore)
 	expected := types.Todos{}
 	counter := &idCounter{current: 1}
@@ -162,6 +176,663 @@ func TestErrorPath(t *testing.T) {
 	})
 }
 
+func TestOwnership(t *testing.T) {
+	m, err := createTables()
+	assertNoErr(t, err)
+
+	defer dropAllTables(m)
+
+	dbStore := openStore(t, database)
+	dummy := loginDummyUser(t, dbStore)
+	srv := server.New(dbStore)
+	counter := &idCounter{current: 1}
+	expected := add(t, srv, counter, "dummy's todo", types.Todos{})
+
+	other, err := dbStore.CreateUser(context.Background(), "other", "irrelevant hash")
+	assertNoErr(t, err)
+	ctx := inWorkspace(t, dbStore, db.DefaultWorkspace)
+
+	t.Run("other user sees nothing", func(t *testing.T) {
+		todos, err := dbStore.GetTodos(ctx, other.Id, other.Id)
+		assertNoErr(t, err)
+		assertTodo(t, len(todos), 0)
+
+		_, err = dbStore.GetTodos(ctx, other.Id, dummy.Id)
+		assertTodo(t, err, db.PermissionDeniedErr)
+	})
+
+	t.Run("other user can't update or delete", func(t *testing.T) {
+		_, err := dbStore.UpdateTodo(ctx, other.Id, dummy.Id, 1, "hijacked")
+		assertTodo(t, err, db.PermissionDeniedErr)
+		_, err = dbStore.UpdateTodo(ctx, other.Id, other.Id, 1, "hijacked")
+		assertTodo(t, err, db.UpdatedIdNotExistErr)
+		err = dbStore.DeleteTodo(ctx, other.Id, dummy.Id, 1)
+		assertTodo(t, err, db.PermissionDeniedErr)
+		err = dbStore.DeleteTodo(ctx, other.Id, other.Id, 1)
+		assertTodo(t, err, db.DeleteIdNotExistErr)
+		got := get(t, srv)
+		assertTodos(t, got, expected)
+	})
+
+	t.Run("viewer can only read", func(t *testing.T) {
+		_, err := dbStore.PutShare(context.Background(), dummy.Id, dummy.Id, types.NewShare{Username: other.Username, Role: types.RoleViewer})
+		assertNoErr(t, err)
+
+		todos, err := dbStore.GetTodos(ctx, other.Id, dummy.Id)
+		assertNoErr(t, err)
+		assertTodos(t, todos, expected)
+
+		_, err = dbStore.PostTodo(ctx, other.Id, dummy.Id, "from other")
+		assertTodo(t, err, db.PermissionDeniedErr)
+		_, err = dbStore.GetShares(context.Background(), other.Id, dummy.Id)
+		assertTodo(t, err, db.PermissionDeniedErr)
+	})
+
+	t.Run("batch of lists leaves out unreadable lists", func(t *testing.T) {
+		todosOfLists, err := dbStore.GetTodosOfLists(ctx, other.Id, []int{other.Id, dummy.Id, other.Id + 1})
+		assertNoErr(t, err)
+		assertTodo(t, len(todosOfLists), 2)
+		assertTodo(t, len(todosOfLists[other.Id]), 0)
+		assertTodos(t, todosOfLists[dummy.Id], expected)
+	})
+
+	t.Run("editor can write", func(t *testing.T) {
+		_, err := dbStore.PutShare(context.Background(), dummy.Id, dummy.Id, types.NewShare{Username: other.Username, Role: types.RoleEditor})
+		assertNoErr(t, err)
+
+		updated, err := dbStore.UpdateTodo(ctx, other.Id, dummy.Id, 1, "edited by other")
+		assertNoErr(t, err)
+		expected[0].Content = "edited by other"
+		assertTodo(t, updated.Content, expected[0].Content)
+		got := get(t, srv)
+		assertTodos(t, got, expected)
+	})
+
+	t.Run("leaving the list revokes access", func(t *testing.T) {
+		err := dbStore.DeleteShare(context.Background(), other.Id, dummy.Id, other.Id)
+		assertNoErr(t, err)
+
+		_, err = dbStore.GetTodos(ctx, other.Id, dummy.Id)
+		assertTodo(t, err, db.PermissionDeniedErr)
+	})
+}
+
+func TestSchemaCompatibility(t *testing.T) {
+	m, err := createTables()
+	assertNoErr(t, err)
+
+	defer dropAllTables(m)
+
+	t.Run("runs before and after the todozz rename", func(t *testing.T) {
+		assertNoErr(t, m.Migrate(db.MinSchemaVersion))
+
+		legacyStore := openStore(t, database)
+		dummy := loginDummyUser(t, legacyStore)
+		ctx := inWorkspace(t, legacyStore, db.DefaultWorkspace)
+		_, err = legacyStore.PostTodo(ctx, dummy.Id, dummy.Id, "before rename")
+		assertNoErr(t, err)
+
+		assertNoErr(t, m.Migrate(db.SchemaVersion))
+
+		// the store opened before the rename goes through the todozz view
+		_, err = legacyStore.PostTodo(ctx, dummy.Id, dummy.Id, "through the view")
+		assertNoErr(t, err)
+		_, err := legacyStore.CheckSchema(context.Background())
+		assertNoErr(t, err)
+
+		dbStore := openStore(t, database)
+		todos, err := dbStore.GetTodos(ctx, dummy.Id, dummy.Id)
+		assertNoErr(t, err)
+		assertTodo(t, len(todos), 2)
+		assertTodo(t, todos[1].Content, "through the view")
+	})
+
+	t.Run("refuses a schema rolled back below the one it started on", func(t *testing.T) {
+		dbStore := openStore(t, database)
+
+		assertNoErr(t, m.Migrate(db.MinSchemaVersion))
+		defer m.Migrate(db.SchemaVersion)
+
+		_, err := dbStore.CheckSchema(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "rolled back") {
+			t.Errorf("got error %v, want one saying the schema is rolled back", err)
+		}
+	})
+
+	t.Run("refuses to open a schema older than it supports", func(t *testing.T) {
+		assertNoErr(t, m.Migrate(db.MinSchemaVersion-1))
+		defer m.Migrate(db.SchemaVersion)
+
+		_, err := db.Open(context.Background(), database)
+		if err == nil || !strings.Contains(err.Error(), "older than") {
+			t.Errorf("got error %v, want one saying the schema is older than", err)
+		}
+	})
+}
+
+func TestWorkspaceIsolation(t *testing.T) {
+	m, err := createTables()
+	assertNoErr(t, err)
+
+	defer dropAllTables(m)
+
+	// superusers bypass row level security, so connect the way the server should: as a regular role
+	appPool := connectAsAppRole(t)
+	defer appPool.Close()
+
+	dbStore := openStore(t, appPool)
+	dummy := loginDummyUser(t, dbStore)
+
+	_, err = database.Exec(context.Background(), "INSERT INTO workspaces (slug, todo_quota) VALUES ('team', 2)")
+	assertNoErr(t, err)
+
+	defaultCtx := inWorkspace(t, dbStore, db.DefaultWorkspace)
+	teamCtx := inWorkspace(t, dbStore, "team")
+
+	t.Run("todos stay in their workspace", func(t *testing.T) {
+		_, err := dbStore.PostTodo(defaultCtx, dummy.Id, dummy.Id, "default todo")
+		assertNoErr(t, err)
+		_, err = dbStore.PostTodo(teamCtx, dummy.Id, dummy.Id, "team todo")
+		assertNoErr(t, err)
+
+		todos, err := dbStore.GetTodos(teamCtx, dummy.Id, dummy.Id)
+		assertNoErr(t, err)
+		assertTodo(t, len(todos), 1)
+		assertTodo(t, todos[0].Content, "team todo")
+
+		err = dbStore.DeleteTodo(teamCtx, dummy.Id, dummy.Id, 1)
+		assertTodo(t, err, db.DeleteIdNotExistErr)
+	})
+
+	t.Run("row level security hides other workspaces without a filter", func(t *testing.T) {
+		var count int
+		err := pgx.BeginFunc(context.Background(), appPool, func(tx pgx.Tx) error {
+			workspace, err := dbStore.GetWorkspaceBySlug(context.Background(), "team")
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(context.Background(), fmt.Sprintf("SET LOCAL app.workspace_id = %d", workspace.Id)); err != nil {
+				return err
+			}
+			return tx.QueryRow(context.Background(), "SELECT COUNT(*) FROM todos").Scan(&count)
+		})
+		assertNoErr(t, err)
+		assertTodo(t, count, 1)
+
+		err = appPool.QueryRow(context.Background(), "SELECT COUNT(*) FROM todos").Scan(&count)
+		assertNoErr(t, err)
+		assertTodo(t, count, 0)
+	})
+
+	t.Run("todozz view of the previous release hides other workspaces even to a superuser", func(t *testing.T) {
+		var count int
+		err := pgx.BeginFunc(context.Background(), database, func(tx pgx.Tx) error {
+			workspace, err := dbStore.GetWorkspaceBySlug(context.Background(), "team")
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(context.Background(), fmt.Sprintf("SET LOCAL app.workspace_id = %d", workspace.Id)); err != nil {
+				return err
+			}
+			return tx.QueryRow(context.Background(), "SELECT COUNT(*) FROM todozz").Scan(&count)
+		})
+		assertNoErr(t, err)
+		assertTodo(t, count, 1)
+
+		err = database.QueryRow(context.Background(), "SELECT COUNT(*) FROM todozz").Scan(&count)
+		assertNoErr(t, err)
+		assertTodo(t, count, 0)
+	})
+
+	t.Run("quota is enforced per workspace", func(t *testing.T) {
+		_, err := dbStore.PostTodo(teamCtx, dummy.Id, dummy.Id, "second team todo")
+		assertNoErr(t, err)
+		_, err = dbStore.PostTodo(teamCtx, dummy.Id, dummy.Id, "one too many")
+		assertTodo(t, err, db.TodoQuotaExceededErr)
+		_, err = dbStore.PostTodo(defaultCtx, dummy.Id, dummy.Id, "default has no quota")
+		assertNoErr(t, err)
+
+		workspace, err := dbStore.GetWorkspace(teamCtx)
+		assertNoErr(t, err)
+		assertTodo(t, workspace.TodoCount, 2)
+	})
+
+	t.Run("no workspace no rows", func(t *testing.T) {
+		_, err := dbStore.GetTodos(context.Background(), dummy.Id, dummy.Id)
+		assertTodo(t, err, db.NoWorkspaceErr)
+	})
+
+	t.Run("only members reach a workspace", func(t *testing.T) {
+		_, err := dbStore.GetMemberWorkspace(context.Background(), dummy.Id, db.DefaultWorkspace)
+		assertNoErr(t, err)
+		_, err = dbStore.GetMemberWorkspace(context.Background(), dummy.Id, "team")
+		assertTodo(t, err, db.NotWorkspaceMemberErr)
+		_, err = dbStore.GetMemberWorkspace(context.Background(), dummy.Id, "nope")
+		assertTodo(t, err, db.WorkspaceNotExistErr)
+
+		assertNoErr(t, dbStore.AddWorkspaceMember(context.Background(), "team", dummy.Username))
+		assertNoErr(t, dbStore.AddWorkspaceMember(context.Background(), "team", dummy.Username))
+		workspace, err := dbStore.GetMemberWorkspace(context.Background(), dummy.Id, "team")
+		assertNoErr(t, err)
+		assertTodo(t, workspace.Slug, "team")
+
+		assertNoErr(t, dbStore.RemoveWorkspaceMember(context.Background(), "team", dummy.Username))
+		_, err = dbStore.GetMemberWorkspace(context.Background(), dummy.Id, "team")
+		assertTodo(t, err, db.NotWorkspaceMemberErr)
+		assertTodo(t, dbStore.RemoveWorkspaceMember(context.Background(), "team", dummy.Username), db.MemberNotExistErr)
+	})
+}
+
+func TestEventLog(t *testing.T) {
+	m, err := createTables()
+	assertNoErr(t, err)
+
+	defer dropAllTables(m)
+
+	appPool := connectAsAppRole(t)
+	defer appPool.Close()
+
+	dbStore := openStore(t, appPool)
+	dummy := loginDummyUser(t, dbStore)
+	srv := server.New(dbStore)
+	counter := &idCounter{current: 1}
+
+	other, err := dbStore.CreateUser(context.Background(), "other", "irrelevant hash")
+	assertNoErr(t, err)
+	ctx := inWorkspace(t, dbStore, db.DefaultWorkspace)
+
+	expected := add(t, srv, counter, "buy milk", types.Todos{})
+	expected = updateById(t, srv, 1, "buy eggs", expected)
+	deleteById(t, srv, 1, expected)
+
+	t.Run("writes are logged in order", func(t *testing.T) {
+		events, err := dbStore.GetEvents(ctx, dummy.Id, 0, 10)
+		assertNoErr(t, err)
+		assertTodo(t, len(events), 3)
+		assertTodo(t, []types.EventType{events[0].Type, events[1].Type, events[2].Type}, []types.EventType{types.EventTodoCreated, types.EventTodoUpdated, types.EventTodoDeleted})
+		assertTodo(t, events[1].Content, "buy eggs")
+		assertTodo(t, *events[2].UserId, dummy.Id)
+
+		lastId, err := dbStore.GetLastEventId(ctx)
+		assertNoErr(t, err)
+		assertTodo(t, lastId, events[2].Id)
+
+		resumed, err := dbStore.GetEvents(ctx, dummy.Id, events[0].Id, 10)
+		assertNoErr(t, err)
+		assertTodo(t, resumed, events[1:])
+	})
+
+	t.Run("failed writes aren't logged", func(t *testing.T) {
+		lastId, err := dbStore.GetLastEventId(ctx)
+		assertNoErr(t, err)
+
+		_, err = dbStore.UpdateTodo(ctx, dummy.Id, dummy.Id, 999, "buy bread")
+		assertTodo(t, err, db.UpdatedIdNotExistErr)
+		_, err = dbStore.PostTodo(ctx, other.Id, dummy.Id, "not mine")
+		assertTodo(t, err, db.PermissionDeniedErr)
+
+		events, err := dbStore.GetEvents(ctx, dummy.Id, lastId, 10)
+		assertNoErr(t, err)
+		assertTodo(t, len(events), 0)
+	})
+
+	t.Run("events committing late aren't skipped", func(t *testing.T) {
+		lastId, err := dbStore.GetLastEventId(ctx)
+		assertNoErr(t, err)
+
+		// the superuser bypasses row level security, the workspace is set by hand
+		late, err := database.Begin(context.Background())
+		assertNoErr(t, err)
+		defer late.Rollback(context.Background())
+		_, err = late.Exec(
+			context.Background(),
+			"INSERT INTO todo_events (workspace_id, list_id, user_id, type, todo_id, content) SELECT id, $1, $1, 'todo.created', 100, 'late' FROM workspaces WHERE slug = $2",
+			dummy.Id, db.DefaultWorkspace,
+		)
+		assertNoErr(t, err)
+
+		// committed first with a greater id
+		_, err = dbStore.PostTodo(ctx, dummy.Id, dummy.Id, "early")
+		assertNoErr(t, err)
+
+		events, err := dbStore.GetEvents(ctx, dummy.Id, lastId, 10)
+		assertNoErr(t, err)
+		assertTodo(t, len(events), 0)
+		held, err := dbStore.GetLastEventId(ctx)
+		assertNoErr(t, err)
+		assertTodo(t, held, lastId)
+
+		assertNoErr(t, late.Commit(context.Background()))
+
+		events, err = dbStore.GetEvents(ctx, dummy.Id, lastId, 10)
+		assertNoErr(t, err)
+		assertTodo(t, len(events), 2)
+		assertTodo(t, []string{events[0].Content, events[1].Content}, []string{"late", "early"})
+
+		resumed, err := dbStore.GetEvents(ctx, dummy.Id, events[0].Id, 10)
+		assertNoErr(t, err)
+		assertTodo(t, resumed, events[1:])
+	})
+
+	t.Run("events follow the shares of their list", func(t *testing.T) {
+		events, err := dbStore.GetEvents(ctx, other.Id, 0, 10)
+		assertNoErr(t, err)
+		assertTodo(t, len(events), 0)
+
+		_, err = dbStore.PutShare(context.Background(), dummy.Id, dummy.Id, types.NewShare{Username: other.Username, Role: types.RoleViewer})
+		assertNoErr(t, err)
+
+		events, err = dbStore.GetEvents(ctx, other.Id, 0, 10)
+		assertNoErr(t, err)
+		assertTodo(t, len(events), 5)
+	})
+
+	t.Run("events stay in their workspace", func(t *testing.T) {
+		_, err := database.Exec(context.Background(), "INSERT INTO workspaces (slug) VALUES ('team')")
+		assertNoErr(t, err)
+
+		events, err := dbStore.GetEvents(inWorkspace(t, dbStore, "team"), dummy.Id, 0, 10)
+		assertNoErr(t, err)
+		assertTodo(t, len(events), 0)
+	})
+}
+
+func TestNotify(t *testing.T) {
+	m, err := createTables()
+	assertNoErr(t, err)
+
+	defer dropAllTables(m)
+
+	appPool := connectAsAppRole(t)
+	defer appPool.Close()
+
+	dbStore := openStore(t, appPool)
+
+	t.Run("listeners of the channel get the payload", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		first, err := dbStore.Listen(ctx, "todos_test")
+		assertNoErr(t, err)
+		second, err := dbStore.Listen(ctx, "todos_other", "todos_test")
+		assertNoErr(t, err)
+		elsewhere, err := dbStore.Listen(ctx, "todos_elsewhere")
+		assertNoErr(t, err)
+
+		assertNoErr(t, dbStore.Notify(context.Background(), "todos_test", `{"listId":1}`))
+
+		for _, notifications := range []<-chan types.Notification{first, second} {
+			select {
+			case notification := <-notifications:
+				assertTodo(t, notification, types.Notification{Channel: "todos_test", Payload: `{"listId":1}`})
+			case <-time.After(5 * time.Second):
+				t.Fatal("no notification")
+			}
+		}
+		select {
+		case notification := <-elsewhere:
+			t.Errorf("got %q notified on another channel", notification.Payload)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+	t.Run("listening stops with its context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		notifications, err := dbStore.Listen(ctx, "todos_test")
+		assertNoErr(t, err)
+		cancel()
+
+		select {
+		case _, ok := <-notifications:
+			assertTodo(t, ok, false)
+		case <-time.After(5 * time.Second):
+			t.Fatal("listening didn't stop")
+		}
+	})
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	m, err := createTables()
+	assertNoErr(t, err)
+
+	defer dropAllTables(m)
+
+	appPool := connectAsAppRole(t)
+	defer appPool.Close()
+
+	dbStore := openStore(t, appPool)
+	dummy := loginDummyUser(t, dbStore)
+	srv := server.New(dbStore)
+	dispatcher := webhook.NewDispatcher(dbStore, slog.Default(), webhook.WithAllowedNetworks(netip.MustParsePrefix("127.0.0.1/32")))
+	counter := &idCounter{current: 1}
+
+	other, err := dbStore.CreateUser(context.Background(), "other", "irrelevant hash")
+	assertNoErr(t, err)
+	ctx := inWorkspace(t, dbStore, db.DefaultWorkspace)
+
+	var (
+		mu       sync.Mutex
+		received []types.WebhookPayload
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !webhook.Verify("shh", body, r.Header.Get(webhook.SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload types.WebhookPayload
+		json.Unmarshal(body, &payload)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, payload)
+	}))
+	defer receiver.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	hook, err := dbStore.CreateWebhook(ctx, dummy.Id, types.NewWebhook{Url: receiver.URL, Events: []types.EventType{types.EventTodoCreated, types.EventTodoUpdated}}, "shh")
+	assertNoErr(t, err)
+	deletesOnly, err := dbStore.CreateWebhook(ctx, dummy.Id, types.NewWebhook{Url: receiver.URL, Events: []types.EventType{types.EventTodoDeleted}}, "shh")
+	assertNoErr(t, err)
+
+	t.Run("mutations are delivered to subscribed webhooks", func(t *testing.T) {
+		add(t, srv, counter, "buy milk", types.Todos{})
+
+		attempted, err := dispatcher.Dispatch(context.Background())
+		assertNoErr(t, err)
+		assertTodo(t, attempted, 1)
+		mu.Lock()
+		assertTodo(t, len(received), 1)
+		assertTodo(t, received[0].Type, types.EventTodoCreated)
+		assertTodo(t, received[0].Content, "buy milk")
+		mu.Unlock()
+
+		deliveries, err := dbStore.GetDeliveries(ctx, dummy.Id, hook.Id)
+		assertNoErr(t, err)
+		assertTodo(t, len(deliveries), 1)
+		assertTodo(t, deliveries[0].Status, types.DeliveryDelivered)
+		assertTodo(t, deliveries[0].Attempts, 1)
+		assertTodo(t, *deliveries[0].ResponseStatus, http.StatusOK)
+
+		deliveries, err = dbStore.GetDeliveries(ctx, dummy.Id, deletesOnly.Id)
+		assertNoErr(t, err)
+		assertTodo(t, len(deliveries), 0)
+	})
+
+	t.Run("failed mutations are not delivered", func(t *testing.T) {
+		_, err := dbStore.UpdateTodo(ctx, dummy.Id, dummy.Id, 999, "buy eggs")
+		assertTodo(t, err, db.UpdatedIdNotExistErr)
+
+		claimed, err := dbStore.ClaimDeliveries(context.Background(), 10, time.Minute)
+		assertNoErr(t, err)
+		assertTodo(t, len(claimed), 0)
+	})
+
+	t.Run("shared lists are delivered to their viewers", func(t *testing.T) {
+		_, err := dbStore.CreateWebhook(ctx, other.Id, types.NewWebhook{Url: receiver.URL}, "shh")
+		assertNoErr(t, err)
+		_, err = dbStore.PutShare(context.Background(), dummy.Id, dummy.Id, types.NewShare{Username: other.Username, Role: types.RoleViewer})
+		assertNoErr(t, err)
+
+		_, err = dbStore.PostTodo(ctx, dummy.Id, dummy.Id, "buy eggs")
+		assertNoErr(t, err)
+
+		attempted, err := dispatcher.Dispatch(context.Background())
+		assertNoErr(t, err)
+		assertTodo(t, attempted, 2)
+	})
+
+	t.Run("failed deliveries are retried later", func(t *testing.T) {
+		flaky, err := dbStore.CreateWebhook(ctx, dummy.Id, types.NewWebhook{Url: broken.URL, Events: []types.EventType{types.EventTodoDeleted}}, "shh")
+		assertNoErr(t, err)
+		assertNoErr(t, dbStore.DeleteTodo(ctx, dummy.Id, dummy.Id, 1))
+
+		attempted, err := dispatcher.Dispatch(context.Background())
+		assertNoErr(t, err)
+		// the webhook deleting only, of the viewer and the broken one
+		assertTodo(t, attempted, 3)
+
+		deliveries, err := dbStore.GetDeliveries(ctx, dummy.Id, flaky.Id)
+		assertNoErr(t, err)
+		assertTodo(t, deliveries[0].Status, types.DeliveryPending)
+		assertTodo(t, *deliveries[0].ResponseStatus, http.StatusInternalServerError)
+		if deliveries[0].NextAttemptAt.Before(time.Now().Add(webhook.RetryBase / 2)) {
+			t.Errorf("retry at %v isn't backed off", deliveries[0].NextAttemptAt)
+		}
+
+		attempted, err = dispatcher.Dispatch(context.Background())
+		assertNoErr(t, err)
+		assertTodo(t, attempted, 0)
+	})
+
+	t.Run("redelivery is a delivery of its own", func(t *testing.T) {
+		deliveries, err := dbStore.GetDeliveries(ctx, dummy.Id, hook.Id)
+		assertNoErr(t, err)
+		first := deliveries[len(deliveries)-1]
+
+		redelivery, err := dbStore.Redeliver(ctx, dummy.Id, hook.Id, first.Id)
+		assertNoErr(t, err)
+		assertTodo(t, redelivery.Status, types.DeliveryPending)
+		assertTodo(t, redelivery.Payload, first.Payload)
+
+		_, err = dbStore.Redeliver(ctx, other.Id, hook.Id, first.Id)
+		assertTodo(t, err, db.DeliveryNotExistErr)
+
+		attempted, err := dispatcher.Dispatch(context.Background())
+		assertNoErr(t, err)
+		assertTodo(t, attempted, 1)
+
+		deliveries, err = dbStore.GetDeliveries(ctx, dummy.Id, hook.Id)
+		assertNoErr(t, err)
+		assertTodo(t, deliveries[0].Id, redelivery.Id)
+		assertTodo(t, deliveries[0].Status, types.DeliveryDelivered)
+	})
+
+	t.Run("deliveries stay in their workspace", func(t *testing.T) {
+		_, err := database.Exec(context.Background(), "INSERT INTO workspaces (slug) VALUES ('team')")
+		assertNoErr(t, err)
+
+		webhooks, err := dbStore.GetWebhooks(inWorkspace(t, dbStore, "team"), dummy.Id)
+		assertNoErr(t, err)
+		assertTodo(t, len(webhooks), 0)
+
+		_, err = dbStore.GetDeliveries(inWorkspace(t, dbStore, "team"), dummy.Id, hook.Id)
+		assertTodo(t, err, db.WebhookNotExistErr)
+	})
+
+	t.Run("busy workspaces don't starve the others", func(t *testing.T) {
+		teamCtx := inWorkspace(t, dbStore, "team")
+		_, err := dbStore.CreateWebhook(teamCtx, dummy.Id, types.NewWebhook{Url: receiver.URL}, "shh")
+		assertNoErr(t, err)
+
+		for _, content := range []string{"first", "second", "third"} {
+			_, err := dbStore.PostTodo(ctx, dummy.Id, dummy.Id, content)
+			assertNoErr(t, err)
+		}
+		_, err = dbStore.PostTodo(teamCtx, dummy.Id, dummy.Id, "team")
+		assertNoErr(t, err)
+
+		claimed, err := dbStore.ClaimDeliveries(context.Background(), 2, time.Minute)
+		assertNoErr(t, err)
+		assertTodo(t, len(claimed), 2)
+		if claimed[0].WorkspaceId == claimed[1].WorkspaceId {
+			t.Errorf("claimed deliveries of workspace %d only", claimed[0].WorkspaceId)
+		}
+	})
+}
+
+func TestAdmin(t *testing.T) {
+	m, err := createTables()
+	assertNoErr(t, err)
+
+	defer dropAllTables(m)
+
+	appPool := connectAsAppRole(t)
+	defer appPool.Close()
+
+	dbStore := openStore(t, appPool)
+	dummy := loginDummyUser(t, dbStore)
+
+	_, err = database.Exec(context.Background(), "INSERT INTO workspaces (slug, todo_quota) VALUES ('team', 2)")
+	assertNoErr(t, err)
+
+	defaultCtx := inWorkspace(t, dbStore, db.DefaultWorkspace)
+	teamCtx := inWorkspace(t, dbStore, "team")
+
+	t.Run("export and import todos between workspaces", func(t *testing.T) {
+		_, err = dbStore.PostTodo(defaultCtx, dummy.Id, dummy.Id, "first")
+		assertNoErr(t, err)
+		_, err = dbStore.PostTodo(defaultCtx, dummy.Id, dummy.Id, "second")
+		assertNoErr(t, err)
+
+		exported, err := dbStore.ExportTodos(defaultCtx)
+		assertNoErr(t, err)
+		assertTodo(t, len(exported), 2)
+		assertTodo(t, exported[0].Owner, dummy.Username)
+
+		assertNoErr(t, dbStore.ImportTodos(teamCtx, exported))
+
+		imported, err := dbStore.ExportTodos(teamCtx)
+		assertNoErr(t, err)
+		assertTodo(t, imported, exported)
+	})
+
+	t.Run("import is all or nothing", func(t *testing.T) {
+		err := dbStore.ImportTodos(teamCtx, types.ExportedTodos{{Owner: dummy.Username, Content: "over quota"}})
+		assertTodo(t, err, db.TodoQuotaExceededErr)
+
+		err = dbStore.ImportTodos(defaultCtx, types.ExportedTodos{
+			{Owner: dummy.Username, Content: "kept out"},
+			{Owner: "nobody", Content: "unknown owner"},
+		})
+		assertTodo(t, err, db.UserNotExistErr)
+
+		todos, err := dbStore.GetTodos(defaultCtx, dummy.Id, dummy.Id)
+		assertNoErr(t, err)
+		assertTodo(t, len(todos), 2)
+	})
+
+	t.Run("purge trash keeps what is still usable", func(t *testing.T) {
+		expired := time.Now().Add(-time.Hour)
+		assertNoErr(t, dbStore.CreateSession(context.Background(), dummy.Id, auth.HashToken("expired"), expired))
+		revoked, err := dbStore.CreateToken(context.Background(), dummy.Id, auth.HashToken("revoked"), types.NewToken{Name: "revoked", Scopes: auth.Scopes})
+		assertNoErr(t, err)
+		assertNoErr(t, dbStore.RevokeToken(context.Background(), dummy.Id, revoked.Id))
+		_, err = dbStore.CreateToken(context.Background(), dummy.Id, auth.HashToken("kept"), types.NewToken{Name: "kept", Scopes: auth.Scopes})
+		assertNoErr(t, err)
+
+		purged, err := dbStore.PurgeTrash(context.Background(), time.Now().Add(time.Minute))
+		assertNoErr(t, err)
+		assertTodo(t, purged, types.Purged{Sessions: 1, Tokens: 1})
+
+		stats, err := dbStore.GetStats(context.Background())
+		assertNoErr(t, err)
+		assertTodo(t, stats, types.Stats{Users: 1, Sessions: 1, Tokens: 1, Todos: map[string]int{db.DefaultWorkspace: 2, "team": 2}})
+	})
+}
+
 func createDockerPool() (*dockertest.Pool, error) {
 	pool, err := dockertest.NewPool("")
 	if err != nil {
@@ -235,10 +906,7 @@ func removeContainerFromPool(pool *dockertest.Pool, resource *dockertest.Resourc
 
 func createTables() (*migrate.Migrate, error) {
 	connInfo := database.Config().ConnString()
-	m, err := migrate.New(
-		"file://../internal/db/migrations",
-		connInfo,
-	)
+	m, err := db.NewMigrator(connInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -253,6 +921,58 @@ func dropAllTables(m *migrate.Migrate) {
 	m.Down()
 }
 
+func openStore(t *testing.T, pool *pgxpool.Pool) *db.DBStore {
+	t.Helper()
+
+	dbStore, err := db.Open(context.Background(), pool)
+	assertNoErr(t, err)
+
+	return dbStore
+}
+
+func inWorkspace(t *testing.T, dbStore *db.DBStore, slug string) context.Context {
+	t.Helper()
+
+	workspace, err := dbStore.GetWorkspaceBySlug(context.Background(), slug)
+	assertNoErr(t, err)
+
+	return db.WithWorkspace(context.Background(), workspace.Id)
+}
+
+func connectAsAppRole(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	_, err := database.Exec(context.Background(), `DO $$ BEGIN
+		IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'todos_app') THEN
+			CREATE ROLE todos_app LOGIN PASSWORD 'secret';
+		END IF;
+	END $$`)
+	assertNoErr(t, err)
+	_, err = database.Exec(context.Background(), "GRANT ALL ON ALL TABLES IN SCHEMA public TO todos_app")
+	assertNoErr(t, err)
+	_, err = database.Exec(context.Background(), "GRANT ALL ON ALL SEQUENCES IN SCHEMA public TO todos_app")
+	assertNoErr(t, err)
+
+	config := database.Config().ConnConfig
+	pool, err := pgxpool.New(context.Background(), fmt.Sprintf("postgres://todos_app:secret@%s:%d/%s?sslmode=disable", config.Host, config.Port, config.Database))
+	assertNoErr(t, err)
+
+	return pool
+}
+
+// loginDummyUser makes dummyToken a valid session so the request helpers are authenticated.
+func loginDummyUser(t *testing.T, dbStore *db.DBStore) types.User {
+	t.Helper()
+
+	user, err := dbStore.CreateUser(context.Background(), dummyUser.Username, "irrelevant hash")
+	assertNoErr(t, err)
+
+	err = dbStore.CreateSession(context.Background(), user.Id, auth.HashToken(dummyToken), time.Now().UTC().Add(auth.SessionTTL))
+	assertNoErr(t, err)
+
+	return user
+}
+
 func get(t *testing.T, srv *server.Server) types.Todos {
 	getRequest, err := newGetTodoRequest()
 	assertNoErr(t, err)
@@ -332,7 +1052,7 @@ func updateMistypeId(t *testing.T, srv *server.Server, id int, content string) {
 	response := httptest.NewRecorder()
 	srv.ServeHTTP(response, putRequest)
 	assertStatus(t, response.Code, http.StatusBadRequest)
-	assertErrMsg(t, response.Body.String(), server.InvalidIdErrMsg)
+	assertErrMsg(t, response.Body.String(), server.InvalidBodyErrMsg+` Unknown field "Ids".`)
 }
 
 func updateMistypeContent(t *testing.T, srv *server.Server, id int, content string) {
@@ -366,7 +1086,7 @@ func updateMistypeIdAndContent(t *testing.T, srv *server.Server, id int, content
 	response := httptest.NewRecorder()
 	srv.ServeHTTP(response, putRequest)
 	assertStatus(t, response.Code, http.StatusBadRequest)
-	assertErrMsg(t, response.Body.String(), server.InvalidIdErrMsg)
+	assertErrMsg(t, response.Body.String(), server.InvalidBodyErrMsg+` Unknown field "Ids".`)
 }
 
 func deleteById(t *testing.T, srv *server.Server, id int, expected types.Todos) types.Todos {
@@ -75,7 +75,7 @@ func TestPost(t *testing.T) {
 
 		srv.ServeHTTP(response, request)
 
-		assertErrMsg(t, response.Body.String(), server.InvalidContentErrMsg)
+		assertErrMsg(t, response.Body.String(), server.InvalidBodyErrMsg+` Unknown field "contnt".`)
 		assertStatus(t, response.Code, http.StatusBadRequest)
 	})
 	t.Run("Post empty content", func(t *testing.T) {
@@ -144,7 +144,7 @@ func TestPut(t *testing.T) {
 
 		srv.ServeHTTP(response, request)
 
-		assertErrMsg(t, response.Body.String(), server.InvalidIdErrMsg)
+		assertErrMsg(t, response.Body.String(), server.InvalidBodyErrMsg+` Unknown field "Ids".`)
 		assertStatus(t, response.Code, http.StatusBadRequest)
 	})
 	t.Run("valid id but empty invalid content", func(t *testing.T) {
@@ -181,7 +181,7 @@ func TestPut(t *testing.T) {
 
 		srv.ServeHTTP(response, request)
 
-		assertErrMsg(t, response.Body.String(), server.InvalidContentErrMsg)
+		assertErrMsg(t, response.Body.String(), server.InvalidBodyErrMsg+` Unknown field "Contnt".`)
 		assertStatus(t, response.Code, http.StatusBadRequest)
 	})
 	t.Run("invalid id and invalid content", func(t *testing.T) {
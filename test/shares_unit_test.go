@@ -0,0 +1,188 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestShares(t *testing.T) {
+	bobCredentials := types.Credentials{Username: "bob", Password: "correct horse"}
+
+	t.Run("viewer can read but not write", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		srv := server.New(store)
+		bob := loginAs(t, srv, bobCredentials)
+		share(t, srv, dummyUser.Id, types.NewShare{Username: "bob", Role: types.RoleViewer})
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		withList(request, dummyUser.Id)
+		authorize(request, bob)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, getTodosFromResponse(t, response), dummyTodos)
+
+		request, err = newPostTodoRequest(newRequestBody(t, types.NewTodo{Content: "something"}))
+		assertNoErr(t, err)
+		withList(request, dummyUser.Id)
+		authorize(request, bob)
+		response = httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusForbidden, db.PermissionDeniedErr.Error())
+	})
+	t.Run("editor can write", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		srv := server.New(store)
+		bob := loginAs(t, srv, bobCredentials)
+		share(t, srv, dummyUser.Id, types.NewShare{Username: "bob", Role: types.RoleViewer})
+		share(t, srv, dummyUser.Id, types.NewShare{Username: "bob", Role: types.RoleEditor})
+
+		newTodo := types.NewTodo{Content: "from bob"}
+		request, err := newPostTodoRequest(newRequestBody(t, newTodo))
+		assertNoErr(t, err)
+		withList(request, dummyUser.Id)
+		authorize(request, bob)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, store.newTodo, newTodo)
+		assertTodo(t, store.listId, dummyUser.Id)
+	})
+	t.Run("not shared list is forbidden", func(t *testing.T) {
+		srv := server.New(&stubStore{Todos: dummyTodos})
+		bob := loginAs(t, srv, bobCredentials)
+
+		request, err := newDeleteTodoRequest(1)
+		assertNoErr(t, err)
+		withList(request, dummyUser.Id)
+		authorize(request, bob)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusForbidden, db.PermissionDeniedErr.Error())
+	})
+	t.Run("only admins manage shares", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+		bob := loginAs(t, srv, bobCredentials)
+		register(t, srv, types.Credentials{Username: "carol", Password: "correct horse"})
+		share(t, srv, dummyUser.Id, types.NewShare{Username: "bob", Role: types.RoleEditor})
+
+		request, err := newPutShareRequest(dummyUser.Id, newRequestBody(t, types.NewShare{Username: "carol", Role: types.RoleViewer}))
+		assertNoErr(t, err)
+		authorize(request, bob)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusForbidden, db.PermissionDeniedErr.Error())
+
+		share(t, srv, dummyUser.Id, types.NewShare{Username: "bob", Role: types.RoleAdmin})
+
+		request, err = newPutShareRequest(dummyUser.Id, newRequestBody(t, types.NewShare{Username: "carol", Role: types.RoleViewer}))
+		assertNoErr(t, err)
+		authorize(request, bob)
+		response = httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+	t.Run("shared list shows up in lists", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+		bob := loginAs(t, srv, bobCredentials)
+		share(t, srv, dummyUser.Id, types.NewShare{Username: "bob", Role: types.RoleViewer})
+
+		request, err := http.NewRequest("GET", "/lists", nil)
+		assertNoErr(t, err)
+		authorize(request, bob)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var lists types.Lists
+		err = json.NewDecoder(response.Body).Decode(&lists)
+		assertNoErr(t, err)
+		assertTodo(t, len(lists), 2)
+		assertTodo(t, lists[1], types.List{Id: dummyUser.Id, Role: types.RoleViewer})
+	})
+	t.Run("user can leave a shared list", func(t *testing.T) {
+		store := new(stubStore)
+		srv := server.New(store)
+		bob := loginAs(t, srv, bobCredentials)
+		shared := share(t, srv, dummyUser.Id, types.NewShare{Username: "bob", Role: types.RoleViewer})
+
+		request, err := newDeleteShareRequest(dummyUser.Id, shared.UserId)
+		assertNoErr(t, err)
+		authorize(request, bob)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, len(store.shares), 0)
+	})
+	t.Run("invalid shares", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			newShare types.NewShare
+			want     string
+		}{
+			{"unknown role", types.NewShare{Username: "bob", Role: types.RoleOwner}, server.InvalidRoleErrMsg},
+			{"unknown user", types.NewShare{Username: "nobody", Role: types.RoleViewer}, db.UserNotExistErr.Error()},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				srv := server.New(new(stubStore))
+				loginAs(t, srv, bobCredentials)
+
+				request, err := newPutShareRequest(dummyUser.Id, newRequestBody(t, c.newShare))
+				assertNoErr(t, err)
+				response := httptest.NewRecorder()
+				srv.ServeHTTP(response, request)
+
+				assertStatus(t, response.Code, http.StatusBadRequest)
+				assertErrMsg(t, response.Body.String(), c.want)
+			})
+		}
+	})
+}
+
+// loginAs registers and logs in a user, returning their session token.
+func loginAs(t *testing.T, srv *server.Server, credentials types.Credentials) string {
+	t.Helper()
+
+	register(t, srv, credentials)
+	response := login(t, srv, credentials)
+	assertStatus(t, response.Code, http.StatusOK)
+
+	var session types.Session
+	err := json.NewDecoder(response.Body).Decode(&session)
+	assertNoErr(t, err)
+
+	return session.Token
+}
+
+// share shares a list on behalf of dummyUser.
+func share(t *testing.T, srv *server.Server, listId int, newShare types.NewShare) types.Share {
+	t.Helper()
+
+	request, err := newPutShareRequest(listId, newRequestBody(t, newShare))
+	assertNoErr(t, err)
+	response := httptest.NewRecorder()
+	srv.ServeHTTP(response, request)
+	assertStatus(t, response.Code, http.StatusOK)
+
+	var shared types.Share
+	err = json.NewDecoder(response.Body).Decode(&shared)
+	assertNoErr(t, err)
+
+	return shared
+}
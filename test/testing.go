@@ -2,6 +2,7 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,48 +10,164 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gorgemul/todos/pkg/auth"
 	"github.com/gorgemul/todos/pkg/db"
 	"github.com/gorgemul/todos/types"
 )
 
 type stubStore struct {
 	types.Todos
-	newTodo types.NewTodo
+	newTodo  types.NewTodo
+	users    []types.User
+	sessions map[string]int
+	tokens   []stubToken
+	refresh  map[string]*stubRefreshToken
+	shares   []stubShare
+	// workspaces besides the default one
+	workspaces []types.Workspace
+	// members are the user ids of the workspaces besides the default one, by workspace id
+	members     map[int][]int
+	userId      int
+	listId      int
+	workspaceId int
+	// todoBatches are the list ids of every GetTodosOfLists call
+	todoBatches [][]int
+	// getTodosCalls counts GetTodos calls, batches don't count
+	getTodosCalls int
+	// events is the event log, its lock lets /events streams read it while the test writes
+	events     types.Events
+	eventsMu   sync.Mutex
+	webhooks   []stubWebhook
+	deliveries types.WebhookDeliveries
+	// listeners are the Listen channels by channel name, live connections listen while the test writes
+	listeners map[string][]chan types.Notification
+	notifyMu  sync.Mutex
+	// writeErr fails PostTodo and UpdateTodo as the db would
+	writeErr error
+	// readErr fails GetTodos, GetTodosOfLists and GetLists as the db would
+	readErr error
+	// afterGetTodos runs once GetTodos read the todos, to change them behind the back of the caller
+	afterGetTodos func(ctx context.Context)
+	// pingErr and schemaErr fail the readiness checks
+	pingErr   error
+	schemaErr error
 }
 
+type stubShare struct {
+	types.Share
+	listId int
+}
+
+type stubRefreshToken struct {
+	userId    int
+	familyId  string
+	expiresAt time.Time
+	used      bool
+	revoked   bool
+}
+
+type stubWebhook struct {
+	types.Webhook
+	userId int
+	secret string
+}
+
+type stubToken struct {
+	types.Token
+	userId    int
+	tokenHash string
+}
+
+const dummyToken = "dummy-session-token"
+
 var (
 	dummyStore = new(stubStore)
 	dummyTime  = time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	dummyUser  = types.User{Id: 1, Username: "dummy", CreatedAt: dummyTime}
 	dummyTodos = types.Todos{
 		{Id: 1, Content: "foo", CreatedAt: dummyTime},
 		{Id: 2, Content: "bar", CreatedAt: dummyTime},
 	}
 )
 
-func (s *stubStore) GetTodos() (types.Todos, error) {
-	return s.Todos, nil
+func (s *stubStore) GetTodos(ctx context.Context, userId, listId int) (types.Todos, error) {
+	s.record(ctx, userId, listId)
+	s.getTodosCalls++
+	if s.readErr != nil {
+		return nil, s.readErr
+	}
+	if !s.hasRole(userId, listId, types.RoleViewer, types.RoleEditor, types.RoleAdmin) {
+		return nil, db.PermissionDeniedErr
+	}
+	todos := slices.Clone(s.Todos)
+	if s.afterGetTodos != nil {
+		s.afterGetTodos(ctx)
+	}
+	return todos, nil
 }
 
-func (s *stubStore) PostTodo(content string) error {
+// GetTodosOfLists gives every readable list the todos of the stub.
+func (s *stubStore) GetTodosOfLists(ctx context.Context, userId int, listIds []int) (map[int]types.Todos, error) {
+	s.todoBatches = append(s.todoBatches, listIds)
+	if s.readErr != nil {
+		return nil, s.readErr
+	}
+	todosOfLists := make(map[int]types.Todos)
+	for _, listId := range listIds {
+		if s.hasRole(userId, listId, types.RoleViewer, types.RoleEditor, types.RoleAdmin) {
+			todosOfLists[listId] = s.Todos
+		}
+	}
+	return todosOfLists, nil
+}
+
+// PostTodo only remembers the new todo, the todo it returns isn't added to the todos of the stub.
+func (s *stubStore) PostTodo(ctx context.Context, userId, listId int, content string) (types.Todo, error) {
+	s.record(ctx, userId, listId)
+	if s.writeErr != nil {
+		return types.Todo{}, s.writeErr
+	}
+	if !s.hasRole(userId, listId, types.RoleEditor, types.RoleAdmin) {
+		return types.Todo{}, db.PermissionDeniedErr
+	}
+	if workspace, err := s.GetWorkspace(ctx); err == nil && workspace.TodoQuota != nil && len(s.Todos) >= *workspace.TodoQuota {
+		return types.Todo{}, db.TodoQuotaExceededErr
+	}
 	s.newTodo = types.NewTodo{Content: content}
-	return nil
+	todo := types.Todo{Id: len(s.Todos) + 1, Content: content, CreatedAt: dummyTime}
+	s.appendEvent(ctx, types.NewEvent{Type: types.EventTodoCreated, ListId: listId, UserId: userId, TodoId: todo.Id, Content: content})
+	return todo, nil
 }
 
-func (s *stubStore) UpdateTodo(id int, content string) error {
+func (s *stubStore) UpdateTodo(ctx context.Context, userId, listId, id int, content string) (types.Todo, error) {
+	s.record(ctx, userId, listId)
+	if s.writeErr != nil {
+		return types.Todo{}, s.writeErr
+	}
+	if !s.hasRole(userId, listId, types.RoleEditor, types.RoleAdmin) {
+		return types.Todo{}, db.PermissionDeniedErr
+	}
 	for i, todo := range s.Todos {
 		if todo.Id == id {
 			s.Todos[i].Content = content
-			return nil
+			s.appendEvent(ctx, types.NewEvent{Type: types.EventTodoUpdated, ListId: listId, UserId: userId, TodoId: id, Content: content})
+			return s.Todos[i], nil
 		}
 	}
-	return db.UpdatedIdNotExistErr
+	return types.Todo{}, db.UpdatedIdNotExistErr
 }
 
-func (s *stubStore) DeleteTodo(id int) error {
+func (s *stubStore) DeleteTodo(ctx context.Context, userId, listId, id int) error {
+	s.record(ctx, userId, listId)
+	if !s.hasRole(userId, listId, types.RoleEditor, types.RoleAdmin) {
+		return db.PermissionDeniedErr
+	}
 	lenBeforeDelete := len(s.Todos)
 
 	s.Todos = slices.DeleteFunc(s.Todos, func(todo types.Todo) bool {
@@ -61,6 +178,432 @@ func (s *stubStore) DeleteTodo(id int) error {
 		return db.DeleteIdNotExistErr
 	}
 
+	s.appendEvent(ctx, types.NewEvent{Type: types.EventTodoDeleted, ListId: listId, UserId: userId, TodoId: id})
+	return nil
+}
+
+// appendEvent logs a change made by the stub and notifies db.EventsChannel, as the todo mutations
+// of the db do once they commit.
+func (s *stubStore) appendEvent(ctx context.Context, newEvent types.NewEvent) types.Event {
+	s.eventsMu.Lock()
+	event := types.Event{
+		Id:        int64(len(s.events) + 1),
+		Type:      newEvent.Type,
+		ListId:    newEvent.ListId,
+		UserId:    &newEvent.UserId,
+		TodoId:    newEvent.TodoId,
+		Content:   newEvent.Content,
+		CreatedAt: dummyTime,
+	}
+	s.events = append(s.events, event)
+	s.eventsMu.Unlock()
+
+	workspaceId, _ := db.WorkspaceFromContext(ctx)
+	payload, _ := json.Marshal(types.EventNotification{WorkspaceId: workspaceId, Event: event})
+	s.Notify(ctx, db.EventsChannel, string(payload))
+	return event
+}
+
+func (s *stubStore) GetEvents(ctx context.Context, userId int, afterId int64, limit int) (types.Events, error) {
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+	var events types.Events
+	for _, event := range s.events {
+		if event.Id > afterId && len(events) < limit && s.hasRole(userId, event.ListId, types.RoleViewer, types.RoleEditor, types.RoleAdmin) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *stubStore) GetLastEventId(ctx context.Context) (int64, error) {
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+	return int64(len(s.events)), nil
+}
+
+func (s *stubStore) Notify(ctx context.Context, channel, payload string) error {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	for _, listener := range s.listeners[channel] {
+		listener <- types.Notification{Channel: channel, Payload: payload}
+	}
+	return nil
+}
+
+func (s *stubStore) Listen(ctx context.Context, channels ...string) (<-chan types.Notification, error) {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	if s.listeners == nil {
+		s.listeners = make(map[string][]chan types.Notification)
+	}
+	listener := make(chan types.Notification, 100)
+	for _, channel := range channels {
+		s.listeners[channel] = append(s.listeners[channel], listener)
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.notifyMu.Lock()
+		defer s.notifyMu.Unlock()
+		for _, channel := range channels {
+			s.listeners[channel] = slices.DeleteFunc(s.listeners[channel], func(l chan types.Notification) bool { return l == listener })
+		}
+		close(listener)
+	}()
+
+	return listener, nil
+}
+
+func (s *stubStore) CreateUser(ctx context.Context, username, passwordHash string) (types.User, error) {
+	for _, user := range s.users {
+		if user.Username == username {
+			return types.User{}, db.UsernameTakenErr
+		}
+	}
+
+	// ids continue after dummyUser so registered users never act as them
+	user := types.User{Id: dummyUser.Id + len(s.users) + 1, Username: username, PasswordHash: passwordHash, CreatedAt: dummyTime}
+	s.users = append(s.users, user)
+	return user, nil
+}
+
+func (s *stubStore) GetUserByUsername(ctx context.Context, username string) (types.User, error) {
+	for _, user := range s.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return types.User{}, db.UserNotExistErr
+}
+
+func (s *stubStore) CreateSession(ctx context.Context, userId int, tokenHash string, expiresAt time.Time) error {
+	if s.sessions == nil {
+		s.sessions = make(map[string]int)
+	}
+	s.sessions[tokenHash] = userId
+	return nil
+}
+
+// GetUserBySession always knows dummyToken so tests don't need to login first.
+func (s *stubStore) GetUserBySession(ctx context.Context, tokenHash string) (types.User, error) {
+	if tokenHash == auth.HashToken(dummyToken) {
+		return dummyUser, nil
+	}
+
+	userId, ok := s.sessions[tokenHash]
+	if !ok {
+		return types.User{}, db.SessionNotExistErr
+	}
+
+	for _, user := range s.users {
+		if user.Id == userId {
+			return user, nil
+		}
+	}
+	return types.User{}, db.SessionNotExistErr
+}
+
+func (s *stubStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	if _, ok := s.sessions[tokenHash]; !ok {
+		return db.SessionNotExistErr
+	}
+	delete(s.sessions, tokenHash)
+	return nil
+}
+
+func (s *stubStore) CreateWebhook(ctx context.Context, userId int, newWebhook types.NewWebhook, secret string) (types.Webhook, error) {
+	webhook := types.Webhook{Id: len(s.webhooks) + 1, Url: newWebhook.Url, Events: newWebhook.Events, CreatedAt: dummyTime}
+	s.webhooks = append(s.webhooks, stubWebhook{Webhook: webhook, userId: userId, secret: secret})
+	return webhook, nil
+}
+
+func (s *stubStore) GetWebhooks(ctx context.Context, userId int) (types.Webhooks, error) {
+	var webhooks types.Webhooks
+	for _, webhook := range s.webhooks {
+		if webhook.userId == userId {
+			webhooks = append(webhooks, webhook.Webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (s *stubStore) DeleteWebhook(ctx context.Context, userId, id int) error {
+	for i, webhook := range s.webhooks {
+		if webhook.Id == id && webhook.userId == userId {
+			s.webhooks = slices.Delete(s.webhooks, i, i+1)
+			return nil
+		}
+	}
+	return db.WebhookNotExistErr
+}
+
+func (s *stubStore) GetDeliveries(ctx context.Context, userId, webhookId int) (types.WebhookDeliveries, error) {
+	if !s.ownsWebhook(userId, webhookId) {
+		return nil, db.WebhookNotExistErr
+	}
+	var deliveries types.WebhookDeliveries
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		if s.deliveries[i].WebhookId == webhookId {
+			deliveries = append(deliveries, s.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (s *stubStore) Redeliver(ctx context.Context, userId, webhookId int, deliveryId int64) (types.WebhookDelivery, error) {
+	for _, delivery := range s.deliveries {
+		if delivery.Id == deliveryId && delivery.WebhookId == webhookId && s.ownsWebhook(userId, webhookId) {
+			redelivery := types.WebhookDelivery{
+				Id:            int64(len(s.deliveries) + 1),
+				WebhookId:     webhookId,
+				Payload:       delivery.Payload,
+				Status:        types.DeliveryPending,
+				NextAttemptAt: &dummyTime,
+				CreatedAt:     dummyTime,
+			}
+			s.deliveries = append(s.deliveries, redelivery)
+			return redelivery, nil
+		}
+	}
+	return types.WebhookDelivery{}, db.DeliveryNotExistErr
+}
+
+func (s *stubStore) ownsWebhook(userId, webhookId int) bool {
+	return slices.ContainsFunc(s.webhooks, func(webhook stubWebhook) bool { return webhook.Id == webhookId && webhook.userId == userId })
+}
+
+func (s *stubStore) CreateToken(ctx context.Context, userId int, tokenHash string, newToken types.NewToken) (types.Token, error) {
+	token := types.Token{
+		Id:        len(s.tokens) + 1,
+		Name:      newToken.Name,
+		Scopes:    newToken.Scopes,
+		ExpiresAt: newToken.ExpiresAt,
+		Workspace: newToken.Workspace,
+		CreatedAt: dummyTime,
+	}
+	s.tokens = append(s.tokens, stubToken{Token: token, userId: userId, tokenHash: tokenHash})
+	return token, nil
+}
+
+func (s *stubStore) GetTokens(ctx context.Context, userId int) (types.Tokens, error) {
+	var tokens types.Tokens
+	for _, token := range s.tokens {
+		if token.userId == userId {
+			tokens = append(tokens, token.Token)
+		}
+	}
+	return tokens, nil
+}
+
+func (s *stubStore) RevokeToken(ctx context.Context, userId, id int) error {
+	for i, token := range s.tokens {
+		if token.Id == id && token.userId == userId && token.RevokedAt == nil {
+			s.tokens[i].RevokedAt = &dummyTime
+			return nil
+		}
+	}
+	return db.RevokedIdNotExistErr
+}
+
+func (s *stubStore) GetUserByToken(ctx context.Context, tokenHash string) (types.User, types.Token, error) {
+	for _, token := range s.tokens {
+		if token.tokenHash != tokenHash || token.RevokedAt != nil {
+			continue
+		}
+		if token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now()) {
+			continue
+		}
+		if token.userId == dummyUser.Id {
+			return dummyUser, token.Token, nil
+		}
+		for _, user := range s.users {
+			if user.Id == token.userId {
+				return user, token.Token, nil
+			}
+		}
+	}
+	return types.User{}, types.Token{}, db.TokenNotExistErr
+}
+
+func (s *stubStore) CreateRefreshToken(ctx context.Context, userId int, familyId, tokenHash string, expiresAt time.Time) error {
+	if s.refresh == nil {
+		s.refresh = make(map[string]*stubRefreshToken)
+	}
+	s.refresh[tokenHash] = &stubRefreshToken{userId: userId, familyId: familyId, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *stubStore) RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt time.Time) (types.User, error) {
+	token, ok := s.refresh[tokenHash]
+	if !ok || token.revoked || token.expiresAt.Before(time.Now()) {
+		return types.User{}, db.RefreshTokenNotExistErr
+	}
+
+	if token.used {
+		s.revokeRefreshFamily(token.familyId)
+		return types.User{}, db.RefreshTokenReusedErr
+	}
+
+	token.used = true
+	s.refresh[newTokenHash] = &stubRefreshToken{userId: token.userId, familyId: token.familyId, expiresAt: expiresAt}
+
+	for _, user := range s.users {
+		if user.Id == token.userId {
+			return user, nil
+		}
+	}
+	return types.User{}, db.RefreshTokenNotExistErr
+}
+
+func (s *stubStore) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	token, ok := s.refresh[tokenHash]
+	if !ok || !s.revokeRefreshFamily(token.familyId) {
+		return db.RefreshTokenNotExistErr
+	}
+	return nil
+}
+
+func (s *stubStore) revokeRefreshFamily(familyId string) bool {
+	revoked := false
+	for _, token := range s.refresh {
+		if token.familyId == familyId && !token.revoked {
+			token.revoked = true
+			revoked = true
+		}
+	}
+	return revoked
+}
+
+func (s *stubStore) record(ctx context.Context, userId, listId int) {
+	s.userId, s.listId = userId, listId
+	s.workspaceId, _ = db.WorkspaceFromContext(ctx)
+}
+
+func (s *stubStore) Ping(ctx context.Context) error {
+	return s.pingErr
+}
+
+func (s *stubStore) CheckSchema(ctx context.Context) (int, error) {
+	return db.SchemaVersion, s.schemaErr
+}
+
+func (s *stubStore) PoolStats() types.PoolStats {
+	return types.PoolStats{AcquiredConns: 1, IdleConns: 2, TotalConns: 3, MaxConns: 10}
+}
+
+// CountTodos counts the todos of the stub as the default workspace.
+func (s *stubStore) CountTodos(ctx context.Context) (map[string]int, error) {
+	return map[string]int{db.DefaultWorkspace: len(s.Todos)}, nil
+}
+
+func (s *stubStore) GetWorkspaceBySlug(ctx context.Context, slug string) (types.Workspace, error) {
+	if slug == db.DefaultWorkspace {
+		return types.Workspace{Id: 1, Slug: db.DefaultWorkspace, CreatedAt: dummyTime}, nil
+	}
+	for _, workspace := range s.workspaces {
+		if workspace.Slug == slug {
+			return workspace, nil
+		}
+	}
+	return types.Workspace{}, db.WorkspaceNotExistErr
+}
+
+// GetMemberWorkspace lets every user into the default workspace.
+func (s *stubStore) GetMemberWorkspace(ctx context.Context, userId int, slug string) (types.Workspace, error) {
+	workspace, err := s.GetWorkspaceBySlug(ctx, slug)
+	if err != nil {
+		return types.Workspace{}, err
+	}
+	if slug != db.DefaultWorkspace && !slices.Contains(s.members[workspace.Id], userId) {
+		return types.Workspace{}, db.NotWorkspaceMemberErr
+	}
+	return workspace, nil
+}
+
+func (s *stubStore) GetWorkspace(ctx context.Context) (types.Workspace, error) {
+	workspaceId, _ := db.WorkspaceFromContext(ctx)
+	for _, workspace := range s.workspaces {
+		if workspace.Id == workspaceId {
+			workspace.TodoCount = len(s.Todos)
+			return workspace, nil
+		}
+	}
+	return types.Workspace{Id: 1, Slug: db.DefaultWorkspace, TodoCount: len(s.Todos), CreatedAt: dummyTime}, nil
+}
+
+func (s *stubStore) hasRole(userId, listId int, roles ...types.Role) bool {
+	if userId == listId {
+		return true
+	}
+	for _, share := range s.shares {
+		if share.listId == listId && share.UserId == userId && slices.Contains(roles, share.Role) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *stubStore) GetLists(ctx context.Context, userId int) (types.Lists, error) {
+	if s.readErr != nil {
+		return nil, s.readErr
+	}
+	lists := types.Lists{{Id: userId, Role: types.RoleOwner}}
+	for _, share := range s.shares {
+		if share.UserId == userId {
+			lists = append(lists, types.List{Id: share.listId, Role: share.Role})
+		}
+	}
+	return lists, nil
+}
+
+func (s *stubStore) GetShares(ctx context.Context, userId, listId int) (types.Shares, error) {
+	if !s.hasRole(userId, listId, types.RoleAdmin) {
+		return nil, db.PermissionDeniedErr
+	}
+	var shares types.Shares
+	for _, share := range s.shares {
+		if share.listId == listId {
+			shares = append(shares, share.Share)
+		}
+	}
+	return shares, nil
+}
+
+func (s *stubStore) PutShare(ctx context.Context, userId, listId int, newShare types.NewShare) (types.Share, error) {
+	if !s.hasRole(userId, listId, types.RoleAdmin) {
+		return types.Share{}, db.PermissionDeniedErr
+	}
+	user, err := s.GetUserByUsername(ctx, newShare.Username)
+	if err != nil {
+		return types.Share{}, err
+	}
+	if user.Id == listId {
+		return types.Share{}, db.ShareWithOwnerErr
+	}
+
+	share := types.Share{UserId: user.Id, Username: user.Username, Role: newShare.Role, CreatedAt: dummyTime}
+	for i := range s.shares {
+		if s.shares[i].listId == listId && s.shares[i].UserId == user.Id {
+			s.shares[i].Role = newShare.Role
+			return share, nil
+		}
+	}
+	s.shares = append(s.shares, stubShare{Share: share, listId: listId})
+	return share, nil
+}
+
+func (s *stubStore) DeleteShare(ctx context.Context, userId, listId, shareUserId int) error {
+	if shareUserId != userId && !s.hasRole(userId, listId, types.RoleAdmin) {
+		return db.PermissionDeniedErr
+	}
+	lenBeforeDelete := len(s.shares)
+	s.shares = slices.DeleteFunc(s.shares, func(share stubShare) bool {
+		return share.listId == listId && share.UserId == shareUserId
+	})
+	if len(s.shares) == lenBeforeDelete {
+		return db.DeletedShareNotExistErr
+	}
 	return nil
 }
 
@@ -87,6 +630,7 @@ func newGetTodoRequest() (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
+	authorize(request, dummyToken)
 
 	return request, nil
 }
@@ -96,6 +640,7 @@ func newPostTodoRequest(body io.Reader) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
+	authorize(request, dummyToken)
 	return request, nil
 }
 
@@ -104,6 +649,7 @@ func newPutTodoRequest(body io.Reader) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
+	authorize(request, dummyToken)
 	return request, nil
 }
 
@@ -112,9 +658,81 @@ func newDeleteTodoRequest(deleteId int) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
+	authorize(request, dummyToken)
+	return request, nil
+}
+
+func newRegisterRequest(body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest("POST", "/register", body)
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func newLoginRequest(body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest("POST", "/login", body)
+	if err != nil {
+		return nil, err
+	}
 	return request, nil
 }
 
+func newPostTokenRequest(body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest("POST", "/tokens", body)
+	if err != nil {
+		return nil, err
+	}
+	authorize(request, dummyToken)
+	return request, nil
+}
+
+func newGetTokensRequest() (*http.Request, error) {
+	request, err := http.NewRequest("GET", "/tokens", nil)
+	if err != nil {
+		return nil, err
+	}
+	authorize(request, dummyToken)
+	return request, nil
+}
+
+func newDeleteTokenRequest(revokeId int) (*http.Request, error) {
+	request, err := http.NewRequest("DELETE", fmt.Sprintf("/tokens/%d", revokeId), nil)
+	if err != nil {
+		return nil, err
+	}
+	authorize(request, dummyToken)
+	return request, nil
+}
+
+func newPutShareRequest(listId int, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest("PUT", fmt.Sprintf("/lists/%d/shares", listId), body)
+	if err != nil {
+		return nil, err
+	}
+	authorize(request, dummyToken)
+	return request, nil
+}
+
+func newDeleteShareRequest(listId, userId int) (*http.Request, error) {
+	request, err := http.NewRequest("DELETE", fmt.Sprintf("/lists/%d/shares/%d", listId, userId), nil)
+	if err != nil {
+		return nil, err
+	}
+	authorize(request, dummyToken)
+	return request, nil
+}
+
+func withList(request *http.Request, listId int) {
+	query := request.URL.Query()
+	query.Set("list", strconv.Itoa(listId))
+	request.URL.RawQuery = query.Encode()
+}
+
+func authorize(request *http.Request, token string) {
+	request.Header.Set("Authorization", "Bearer "+token)
+}
+
 func newRequestBody(t *testing.T, v any) *bytes.Buffer {
 	body := new(bytes.Buffer)
 	err := populateRequestBody(body, v)
@@ -136,14 +754,19 @@ func assertTodo[T any](t testing.TB, got, want T) {
 func assertErrMsg(t testing.TB, got, want string) {
 	t.Helper()
 
-	// NOTE: small workaounrd since http.Error() write w with Fprintln()
-	comparedGot := strings.TrimSuffix(got, "\n")
+	comparedGot := errMsgOf(got)
 
 	if want != comparedGot {
 		t.Fatalf("Want %v, but got %v", want, comparedGot)
 	}
 }
 
+// errMsgOf strips the request id line following the message of error bodies.
+func errMsgOf(body string) string {
+	errMsg, _, _ := strings.Cut(body, "\n")
+	return errMsg
+}
+
 func assertNoErr(t testing.TB, err error) {
 	t.Helper()
 
@@ -203,11 +826,29 @@ func assertTodos(t testing.TB, gots, wants types.Todos) {
 	}
 }
 
+func assertProblem(t testing.TB, response *httptest.ResponseRecorder, status int, detailPrefix string) {
+	t.Helper()
+
+	assertStatus(t, response.Code, status)
+
+	if got := response.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Fatalf("Want problem content type but got %q", got)
+	}
+
+	var problem types.Problem
+	if err := json.NewDecoder(response.Body).Decode(&problem); err != nil {
+		t.Fatalf("problem decoding problem body, %v", err)
+	}
+
+	if problem.Status != status || !strings.HasPrefix(problem.Detail, detailPrefix) {
+		t.Fatalf("Want problem with status %d and detail %q..., but got %+v", status, detailPrefix, problem)
+	}
+}
+
 func assertErrMsgIn(t testing.TB, got string, wants ...string) {
 	t.Helper()
 
-	// NOTE: small workaounrd since http.Error() write w with Fprintln()
-	comparedGot := strings.TrimSuffix(got, "\n")
+	comparedGot := errMsgOf(got)
 
 	for _, want := range wants {
 		if comparedGot == want {
@@ -0,0 +1,175 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestTokens(t *testing.T) {
+	readWrite := []string{auth.ScopeTodosRead, auth.ScopeTodosWrite}
+
+	t.Run("mint token and use it", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		srv := server.New(store)
+
+		created := mintToken(t, srv, types.NewToken{Name: "ci", Scopes: readWrite})
+		if !strings.HasPrefix(created.Secret, auth.TokenPrefix) {
+			t.Fatalf("token %q doesn't start with %q", created.Secret, auth.TokenPrefix)
+		}
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		authorize(request, created.Secret)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, store.userId, dummyUser.Id)
+	})
+	t.Run("list tokens", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+		mintToken(t, srv, types.NewToken{Name: "ci", Scopes: readWrite})
+		mintToken(t, srv, types.NewToken{Name: "script", Scopes: []string{auth.ScopeTodosRead}})
+
+		request, err := newGetTokensRequest()
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var tokens types.Tokens
+		err = json.NewDecoder(response.Body).Decode(&tokens)
+		assertNoErr(t, err)
+		assertTodo(t, len(tokens), 2)
+		assertTodo(t, tokens[1].Name, "script")
+	})
+	t.Run("read only token can't write", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+		created := mintToken(t, srv, types.NewToken{Name: "ro", Scopes: []string{auth.ScopeTodosRead}})
+
+		request, err := newPostTodoRequest(newRequestBody(t, types.NewTodo{Content: "something"}))
+		assertNoErr(t, err)
+		authorize(request, created.Secret)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusForbidden, server.InsufficientScopeErrMsg)
+	})
+	t.Run("token can't mint tokens", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+		created := mintToken(t, srv, types.NewToken{Name: "ci", Scopes: readWrite})
+
+		request, err := newPostTokenRequest(newRequestBody(t, types.NewToken{Name: "escalate", Scopes: readWrite}))
+		assertNoErr(t, err)
+		authorize(request, created.Secret)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusForbidden, server.SessionRequiredErrMsg)
+	})
+	t.Run("revoked token is rejected", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+		created := mintToken(t, srv, types.NewToken{Name: "ci", Scopes: readWrite})
+
+		request, err := newDeleteTokenRequest(created.Id)
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		request, err = newGetTodoRequest()
+		assertNoErr(t, err)
+		authorize(request, created.Secret)
+		response = httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		assertErrMsg(t, response.Body.String(), server.UnauthorizedErrMsg)
+	})
+	t.Run("revoke unknown token", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+
+		request, err := newDeleteTokenRequest(7)
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+		assertErrMsg(t, response.Body.String(), db.RevokedIdNotExistErr.Error())
+	})
+	t.Run("revoke invalid id", func(t *testing.T) {
+		srv := server.New(new(stubStore))
+
+		for _, id := range []string{"abc", "0"} {
+			request, err := http.NewRequest("DELETE", "/tokens/"+id, nil)
+			assertNoErr(t, err)
+			authorize(request, dummyToken)
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusBadRequest)
+			assertErrMsg(t, response.Body.String(), server.InvalidIdErrMsg)
+		}
+	})
+	t.Run("invalid new tokens", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		cases := []struct {
+			name     string
+			newToken types.NewToken
+			want     string
+		}{
+			{"empty name", types.NewToken{Scopes: readWrite}, server.InvalidTokenNameErrMsg},
+			{"no scopes", types.NewToken{Name: "ci"}, server.InvalidScopesErrMsg},
+			{"unknown scope", types.NewToken{Name: "ci", Scopes: []string{"admin"}}, server.InvalidScopesErrMsg},
+			{"already expired", types.NewToken{Name: "ci", Scopes: readWrite, ExpiresAt: &past}, server.InvalidExpiresAtErrMsg},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				srv := server.New(new(stubStore))
+
+				request, err := newPostTokenRequest(newRequestBody(t, c.newToken))
+				assertNoErr(t, err)
+				response := httptest.NewRecorder()
+
+				srv.ServeHTTP(response, request)
+
+				assertStatus(t, response.Code, http.StatusBadRequest)
+				assertErrMsg(t, response.Body.String(), c.want)
+			})
+		}
+	})
+}
+
+func mintToken(t *testing.T, srv *server.Server, newToken types.NewToken) types.CreatedToken {
+	t.Helper()
+
+	request, err := newPostTokenRequest(newRequestBody(t, newToken))
+	assertNoErr(t, err)
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+	assertStatus(t, response.Code, http.StatusOK)
+
+	var created types.CreatedToken
+	err = json.NewDecoder(response.Body).Decode(&created)
+	assertNoErr(t, err)
+
+	return created
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorgemul/todos/pkg/config"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	t.Run("continues the trace of the caller", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		srv := server.New(dummyStore, server.WithTracerProvider(provider))
+
+		request, err := newDeleteTodoRequest(1)
+		assertNoErr(t, err)
+		request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		srv.ServeHTTP(httptest.NewRecorder(), request)
+
+		spans := recorder.Ended()
+		assertTodo(t, len(spans), 1)
+		span := spans[0]
+
+		assertTodo(t, span.Name(), "DELETE /delete/{id}")
+		assertTodo(t, span.SpanContext().TraceID().String(), "4bf92f3577b34da6a3ce929d0e0e4736")
+		assertTodo(t, span.Parent().SpanID().String(), "00f067aa0ba902b7")
+		assertTodo(t, spanAttribute(span, "http.route"), attribute.StringValue("DELETE /delete/{id}"))
+		assertTodo(t, spanAttribute(span, "http.response.status_code"), attribute.IntValue(http.StatusBadRequest))
+	})
+	t.Run("starts a trace without a caller", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		srv := server.New(dummyStore, server.WithTracerProvider(provider))
+
+		getPath(t, srv, "/healthz")
+
+		spans := recorder.Ended()
+		assertTodo(t, len(spans), 1)
+		assertTodo(t, spans[0].Name(), "GET /healthz")
+		assertTodo(t, spans[0].Parent().IsValid(), false)
+	})
+	t.Run("exports to an otlp collector", func(t *testing.T) {
+		var exported atomic.Int32
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" && r.Header.Get("Content-Type") == "application/x-protobuf" {
+				exported.Add(1)
+			}
+		}))
+		defer collector.Close()
+
+		previous := otel.GetTracerProvider()
+		t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+		shutdown, err := tracing.Setup(context.Background(), config.Tracing{Exporter: config.TracingOTLP, Endpoint: collector.URL, SampleRatio: 1})
+		assertNoErr(t, err)
+
+		srv := server.New(dummyStore)
+		getPath(t, srv, "/healthz")
+
+		err = shutdown(context.Background())
+		assertNoErr(t, err)
+		assertTodo(t, exported.Load(), int32(1))
+	})
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
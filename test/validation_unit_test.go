@@ -0,0 +1,172 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestRequestValidation(t *testing.T) {
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		wantMsg string
+	}{
+		{
+			name:    "unknown field",
+			method:  http.MethodPost,
+			path:    "/",
+			body:    `{"contnt": "buy milk"}`,
+			wantMsg: `Invalid request body! Unknown field "contnt".`,
+		},
+		{
+			name:    "wrong type",
+			method:  http.MethodPut,
+			path:    "/update",
+			body:    `{"id": "1", "content": "buy milk"}`,
+			wantMsg: `Invalid request body! Field "id" must be an integer, got string.`,
+		},
+		{
+			name:    "wrong type of an element",
+			method:  http.MethodPost,
+			path:    "/tokens",
+			body:    `{"name": "ci", "scopes": [1]}`,
+			wantMsg: `Invalid request body! Field "scopes.0" must be a string, got number.`,
+		},
+		{
+			name:    "malformed date-time",
+			method:  http.MethodPost,
+			path:    "/tokens",
+			body:    `{"name": "ci", "scopes": ["todos:read"], "expiresAt": "tomorrow"}`,
+			wantMsg: `Invalid request body! Malformed date-time "tomorrow", expected RFC 3339.`,
+		},
+		{
+			name:    "malformed json",
+			method:  http.MethodPost,
+			path:    "/register",
+			body:    `{"username": "alice",}`,
+			wantMsg: "Invalid request body! Malformed JSON at offset 22.",
+		},
+		{
+			name:    "truncated json",
+			method:  http.MethodPost,
+			path:    "/login",
+			body:    `{"username": "alice"`,
+			wantMsg: "Invalid request body! Malformed JSON, unexpected end of body.",
+		},
+		{
+			name:    "empty body",
+			method:  http.MethodPost,
+			path:    "/auth/refresh",
+			body:    "",
+			wantMsg: "Invalid request body! Expected a JSON object.",
+		},
+		{
+			name:    "not an object",
+			method:  http.MethodPut,
+			path:    "/lists/1/shares",
+			body:    `["bob"]`,
+			wantMsg: "Invalid request body! Expected a JSON object, got array.",
+		},
+		{
+			name:    "trailing data",
+			method:  http.MethodPost,
+			path:    "/",
+			body:    `{"content": "buy milk"} {"content": "buy eggs"}`,
+			wantMsg: "Invalid request body! Unexpected data after the JSON value.",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := server.New(&stubStore{Todos: dummyTodos})
+
+			request, err := http.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			assertNoErr(t, err)
+			authorize(request, dummyToken)
+			response := httptest.NewRecorder()
+			srv.ServeHTTP(response, request)
+
+			assertStatus(t, response.Code, http.StatusBadRequest)
+			assertErrMsg(t, response.Body.String(), c.wantMsg)
+		})
+	}
+
+	t.Run("valid body", func(t *testing.T) {
+		store := &stubStore{Todos: dummyTodos}
+		srv := server.New(store)
+
+		request, err := newPostTodoRequest(strings.NewReader(`{"content": "buy milk"}` + "\n"))
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, store.newTodo.Content, "buy milk")
+	})
+	t.Run("too large body", func(t *testing.T) {
+		srv := server.New(dummyStore, server.WithMaxBodyBytes(16))
+
+		request, err := newPostTodoRequest(strings.NewReader(`{"content": "way more than sixteen bytes"}`))
+		assertNoErr(t, err)
+		request.ContentLength = -1
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+		assertErrMsg(t, response.Body.String(), server.RequestTooLargeErrMsg)
+	})
+}
+
+func TestContentLength(t *testing.T) {
+	tooLong := server.InvalidContentErrMsg + " Content can't be longer than 50 characters."
+	cases := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"50 characters", strings.Repeat("a", 50), ""},
+		{"51 characters", strings.Repeat("a", 51), tooLong},
+		// the db counts characters, not bytes
+		{"50 multibyte characters", strings.Repeat("é", 50), ""},
+		{"51 multibyte characters", strings.Repeat("é", 51), tooLong},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := server.ValidateContent(c.content); c.wantErr == "" {
+				assertNoErr(t, err)
+			} else {
+				assertTodo(t, err.Error(), c.wantErr)
+			}
+
+			srv := server.New(&stubStore{Todos: types.Todos{{Id: 1, Content: "foo", CreatedAt: dummyTime}}})
+			for _, newRequest := range []func() (*http.Request, error){
+				func() (*http.Request, error) {
+					return newPostTodoRequest(newRequestBody(t, types.NewTodo{Content: c.content}))
+				},
+				func() (*http.Request, error) {
+					return newPutTodoRequest(newRequestBody(t, types.UpdateTodo{Id: 1, Content: c.content}))
+				},
+			} {
+				request, err := newRequest()
+				assertNoErr(t, err)
+				response := httptest.NewRecorder()
+				srv.ServeHTTP(response, request)
+
+				if c.wantErr == "" {
+					assertStatus(t, response.Code, http.StatusOK)
+				} else {
+					assertStatus(t, response.Code, http.StatusBadRequest)
+					assertErrMsg(t, response.Body.String(), c.wantErr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorgemul/todos/pkg/auth"
+	"github.com/gorgemul/todos/pkg/db"
+	"github.com/gorgemul/todos/pkg/server"
+	"github.com/gorgemul/todos/types"
+)
+
+func TestWorkspaces(t *testing.T) {
+	quota := 2
+	newStore := func() *stubStore {
+		return &stubStore{
+			Todos:      dummyTodos,
+			workspaces: []types.Workspace{{Id: 2, Slug: "team", TodoQuota: &quota, CreatedAt: dummyTime}, {Id: 3, Slug: "other", CreatedAt: dummyTime}},
+			members:    map[int][]int{2: {dummyUser.Id}},
+		}
+	}
+
+	t.Run("default workspace", func(t *testing.T) {
+		store := newStore()
+		srv := server.New(store)
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, store.workspaceId, 1)
+	})
+	t.Run("workspace from header", func(t *testing.T) {
+		store := newStore()
+		srv := server.New(store)
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		request.Header.Set("X-Workspace", "team")
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, store.workspaceId, 2)
+	})
+	t.Run("workspace from subdomain", func(t *testing.T) {
+		store := newStore()
+		srv := server.New(store, server.WithBaseDomain("todos.example.com"))
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		request.Host = "team.todos.example.com:8080"
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, store.workspaceId, 2)
+	})
+	t.Run("unknown workspace", func(t *testing.T) {
+		srv := server.New(newStore())
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		request.Header.Set("X-Workspace", "nope")
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+		assertErrMsg(t, response.Body.String(), db.WorkspaceNotExistErr.Error())
+	})
+	t.Run("workspace of others from header", func(t *testing.T) {
+		store := newStore()
+		srv := server.New(store)
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		request.Header.Set("X-Workspace", "other")
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusForbidden, db.NotWorkspaceMemberErr.Error())
+		assertTodo(t, store.workspaceId, 0)
+	})
+	t.Run("workspace of others from subdomain", func(t *testing.T) {
+		srv := server.New(newStore(), server.WithBaseDomain("todos.example.com"))
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		request.Host = "other.todos.example.com"
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusForbidden, db.NotWorkspaceMemberErr.Error())
+	})
+	t.Run("token bound to a workspace of others", func(t *testing.T) {
+		srv := server.New(newStore())
+		other := "other"
+
+		request, err := http.NewRequest(http.MethodPost, "/tokens", newRequestBody(t, types.NewToken{Name: "ci", Scopes: []string{auth.ScopeTodosRead}, Workspace: &other}))
+		assertNoErr(t, err)
+		authorize(request, dummyToken)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusForbidden, db.NotWorkspaceMemberErr.Error())
+	})
+	t.Run("token bound to a workspace", func(t *testing.T) {
+		store := newStore()
+		srv := server.New(store)
+		team := "team"
+		created := mintToken(t, srv, types.NewToken{Name: "ci", Scopes: []string{auth.ScopeTodosRead}, Workspace: &team})
+
+		request, err := newGetTodoRequest()
+		assertNoErr(t, err)
+		authorize(request, created.Secret)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		assertTodo(t, store.workspaceId, 2)
+
+		request, err = newGetTodoRequest()
+		assertNoErr(t, err)
+		authorize(request, created.Secret)
+		request.Header.Set("X-Workspace", db.DefaultWorkspace)
+		response = httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusForbidden, "Token is bound to workspace team!")
+	})
+	t.Run("quota exceeded", func(t *testing.T) {
+		srv := server.New(newStore())
+
+		request, err := newPostTodoRequest(newRequestBody(t, types.NewTodo{Content: "one too many"}))
+		assertNoErr(t, err)
+		request.Header.Set("X-Workspace", "team")
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertProblem(t, response, http.StatusForbidden, db.TodoQuotaExceededErr.Error())
+	})
+	t.Run("workspace usage", func(t *testing.T) {
+		srv := server.New(newStore())
+
+		request, err := http.NewRequest("GET", "/workspace", nil)
+		assertNoErr(t, err)
+		authorize(request, dummyToken)
+		request.Header.Set("X-Workspace", "team")
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		var workspace types.Workspace
+		err = json.NewDecoder(response.Body).Decode(&workspace)
+		assertNoErr(t, err)
+		assertTodo(t, workspace.Slug, "team")
+		assertTodo(t, workspace.TodoCount, len(dummyTodos))
+	})
+}
@@ -0,0 +1,29 @@
+package types
+
+import "time"
+
+type ExportedTodos []ExportedTodo
+
+// ExportedTodo is a todo as written by export and read back by import, owners are matched by
+// username since ids differ between databases.
+type ExportedTodo struct {
+	Owner     string    `json:"owner"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Purged counts the rows removed by purging the trash.
+type Purged struct {
+	Sessions      int `json:"sessions"`
+	Tokens        int `json:"tokens"`
+	RefreshTokens int `json:"refreshTokens"`
+}
+
+type Stats struct {
+	Users int `json:"users"`
+	// Sessions and Tokens only count the ones still usable
+	Sessions int `json:"sessions"`
+	Tokens   int `json:"tokens"`
+	// Todos counts the todos of every workspace by slug
+	Todos map[string]int `json:"todos"`
+}
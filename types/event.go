@@ -0,0 +1,46 @@
+package types
+
+import "time"
+
+type EventType string
+
+const (
+	EventTodoCreated EventType = "todo.created"
+	EventTodoUpdated EventType = "todo.updated"
+	EventTodoDeleted EventType = "todo.deleted"
+)
+
+type Events []Event
+
+// Event is a change to a todo of a list, clients resume after the last one they saw.
+type Event struct {
+	Id     int64     `json:"id"`
+	Type   EventType `json:"type"`
+	ListId int       `json:"listId"`
+	// UserId made the change, nil once they are deleted
+	UserId *int `json:"userId"`
+	TodoId int  `json:"todoId"`
+	// Content is empty for deleted todos
+	Content   string    `json:"content,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type NewEvent struct {
+	Type    EventType
+	ListId  int
+	UserId  int
+	TodoId  int
+	Content string
+}
+
+// EventNotification tells the servers sharing the db of an event once its change commits.
+type EventNotification struct {
+	WorkspaceId int   `json:"workspaceId"`
+	Event       Event `json:"event"`
+}
+
+// Notification is a payload notified on Channel.
+type Notification struct {
+	Channel string
+	Payload string
+}
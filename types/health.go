@@ -0,0 +1,18 @@
+package types
+
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+)
+
+// Health is the body of /healthz and /readyz, Checks is only filled in by /readyz.
+type Health struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type HealthCheck struct {
+	Status string `json:"status"`
+	// Detail is the error of failed checks
+	Detail string `json:"detail,omitempty"`
+}
@@ -0,0 +1,45 @@
+package types
+
+type LiveMessageType string
+
+const (
+	// LiveSnapshot is the first message of a subscription, with the todos of the list
+	LiveSnapshot LiveMessageType = "snapshot"
+	LiveEvent    LiveMessageType = "event"
+	// LivePresence carries everyone viewing the list whenever it changes, clients send it to
+	// tell which todo they are looking at or editing
+	LivePresence LiveMessageType = "presence"
+	// LiveUpdate is sent by clients to update a todo of the list
+	LiveUpdate LiveMessageType = "update"
+	// LiveError answers a message of the client which failed
+	LiveError LiveMessageType = "error"
+)
+
+// LiveMessage is a message the server sends on the websocket of /lists/{list}/live, Type says
+// which of the other fields are set.
+type LiveMessage struct {
+	Type     LiveMessageType `json:"type"`
+	Todos    Todos           `json:"todos,omitempty"`
+	Event    *Event          `json:"event,omitempty"`
+	Presence []Presence      `json:"presence,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// LiveRequest is a message clients send on the websocket of /lists/{list}/live.
+type LiveRequest struct {
+	Type LiveMessageType `json:"type"`
+	// Id and Content are the todo to update
+	Id      int    `json:"id,omitempty"`
+	Content string `json:"content,omitempty"`
+	// TodoId and Editing are the presence of the client, no todo when it only views the list
+	TodoId  *int `json:"todoId,omitempty"`
+	Editing bool `json:"editing,omitempty"`
+}
+
+// Presence is a client connected to a list, users connected more than once appear once per connection.
+type Presence struct {
+	UserId   int    `json:"userId"`
+	Username string `json:"username"`
+	TodoId   *int   `json:"todoId"`
+	Editing  bool   `json:"editing"`
+}
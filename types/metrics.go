@@ -0,0 +1,16 @@
+package types
+
+import "time"
+
+// PoolStats is a snapshot of the db connection pool.
+type PoolStats struct {
+	AcquiredConns int32
+	IdleConns     int32
+	TotalConns    int32
+	MaxConns      int32
+	AcquireCount  int64
+	// EmptyAcquireCount counts acquires which had to wait for a connection
+	EmptyAcquireCount int64
+	// AcquireDuration is the total time spent acquiring connections
+	AcquireDuration time.Duration
+}
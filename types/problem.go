@@ -0,0 +1,12 @@
+package types
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance,omitempty"`
+	// RequestId is an extension member, the X-Request-ID of the failed request
+	RequestId string `json:"requestId,omitempty"`
+}
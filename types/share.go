@@ -0,0 +1,36 @@
+package types
+
+import "time"
+
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+	// RoleOwner is implied by owning a list, it can't be shared
+	RoleOwner Role = "owner"
+)
+
+type Shares []Share
+
+type Share struct {
+	UserId    int       `json:"userId"`
+	Username  string    `json:"username"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type NewShare struct {
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+}
+
+type Lists []List
+
+// List is identified by the id of its owner.
+type List struct {
+	Id    int    `json:"id"`
+	Owner string `json:"owner"`
+	Role  Role   `json:"role"`
+}
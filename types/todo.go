@@ -11,7 +11,7 @@ type Todo struct {
 }
 
 type NewTodo struct {
-	Content string
+	Content string `json:"content"`
 }
 
 type UpdateTodo struct {
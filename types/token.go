@@ -0,0 +1,41 @@
+package types
+
+import "time"
+
+type Tokens []Token
+
+type Token struct {
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	// Workspace is the slug of the only workspace the token works in, nil for any workspace
+	Workspace *string   `json:"workspace"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type NewToken struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Workspace *string    `json:"workspace"`
+}
+
+// CreatedToken is the only time the plain token is handed out, it can't be recovered later.
+type CreatedToken struct {
+	Token
+	Secret string `json:"token"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RefreshToken struct {
+	RefreshToken string `json:"refreshToken"`
+}
@@ -0,0 +1,84 @@
+package types
+
+import "time"
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed is a delivery which ran out of attempts
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// NewWebhook subscribes Url to the events of every list its user can read, no events means all of them.
+type NewWebhook struct {
+	Url    string      `json:"url"`
+	Events []EventType `json:"events,omitempty"`
+}
+
+type Webhooks []Webhook
+
+type Webhook struct {
+	Id        int         `json:"id"`
+	Url       string      `json:"url"`
+	Events    []EventType `json:"events"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+// CreatedWebhook carries the secret signing the payloads, it is only shown once.
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookPayload is the body posted to webhooks.
+type WebhookPayload struct {
+	Type   EventType `json:"type"`
+	ListId int       `json:"listId"`
+	UserId int       `json:"userId"`
+	TodoId int       `json:"todoId"`
+	// Content is empty for deleted todos
+	Content   string    `json:"content,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type WebhookDeliveries []WebhookDelivery
+
+// WebhookDelivery is an entry of the delivery log of a webhook, redeliveries are entries of their own.
+type WebhookDelivery struct {
+	Id        int64          `json:"id"`
+	WebhookId int            `json:"webhookId"`
+	Payload   WebhookPayload `json:"payload"`
+	Status    DeliveryStatus `json:"status"`
+	Attempts  int            `json:"attempts"`
+	// ResponseStatus and Error are of the last attempt, nil when no receiver answered
+	ResponseStatus *int       `json:"responseStatus"`
+	Error          string     `json:"error,omitempty"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// PendingDelivery is a delivery claimed by a dispatcher with what it takes to send it, Attempts
+// counts the one about to be made.
+type PendingDelivery struct {
+	Id          int64
+	WorkspaceId int
+	Url         string
+	Secret      string
+	Payload     WebhookPayload
+	Attempts    int
+}
+
+// DeliveryAttempt is the outcome of sending a pending delivery, RetryIn is when a delivery still
+// pending is attempted again.
+type DeliveryAttempt struct {
+	DeliveryId     int64
+	WorkspaceId    int
+	Status         DeliveryStatus
+	ResponseStatus *int
+	Error          string
+	RetryIn        time.Duration
+}
@@ -0,0 +1,14 @@
+package types
+
+import "time"
+
+type Workspaces []Workspace
+
+type Workspace struct {
+	Id   int    `json:"id"`
+	Slug string `json:"slug"`
+	// TodoQuota is nil for workspaces without a limit
+	TodoQuota *int      `json:"todoQuota"`
+	TodoCount int       `json:"todoCount"`
+	CreatedAt time.Time `json:"createdAt"`
+}